@@ -1,17 +1,35 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/ZondaF12/logbook-backend/service/account"
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/blob"
+	"github.com/ZondaF12/logbook-backend/service/export"
+	"github.com/ZondaF12/logbook-backend/service/feed"
 	"github.com/ZondaF12/logbook-backend/service/follower"
 	"github.com/ZondaF12/logbook-backend/service/garage"
+	"github.com/ZondaF12/logbook-backend/service/lockout"
 	"github.com/ZondaF12/logbook-backend/service/logbook"
+	"github.com/ZondaF12/logbook-backend/service/mailer"
 	"github.com/ZondaF12/logbook-backend/service/media"
+	"github.com/ZondaF12/logbook-backend/service/notification"
+	"github.com/ZondaF12/logbook-backend/service/privacy"
 	"github.com/ZondaF12/logbook-backend/service/profile"
+	"github.com/ZondaF12/logbook-backend/service/safety"
+	"github.com/ZondaF12/logbook-backend/service/search"
+	"github.com/ZondaF12/logbook-backend/service/social"
+	"github.com/ZondaF12/logbook-backend/service/stream"
+	"github.com/ZondaF12/logbook-backend/service/upload"
 	"github.com/ZondaF12/logbook-backend/service/user"
 	"github.com/ZondaF12/logbook-backend/service/vehicle"
+	"github.com/ZondaF12/logbook-backend/types"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
@@ -33,33 +51,129 @@ func (s *APIServer) Start() error {
 	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
 		Format: "method=${method}, uri=${uri}, status=${status}\n",
 	}))
+
+	// Fail fast on a misconfigured keyring rather than on the first login
+	if _, err := auth.Keys(); err != nil {
+		return err
+	}
+	e.GET("/.well-known/jwks.json", auth.HandleJWKS)
+
+	// Uploads go to S3 or the local filesystem depending on the config
+	blobStore, err := blob.New(context.Background())
+	if err != nil {
+		return err
+	}
+	if local, ok := blobStore.(*blob.LocalStore); ok {
+		e.GET("/blobs/*", local.HandleServe)
+		e.PUT("/blobs/*", local.HandleUpload)
+	}
+
 	subrouter := e.Group("/api/v1")
 
+	mailSender := mailer.New()
+
+	// Login attempts can be kept in memory for single instance deployments,
+	// security events always go to the database
+	lockoutStore := lockout.NewStore(s.db)
+	var attemptStore types.LoginAttemptStore = lockoutStore
+	if config.Envs.LoginAttemptStore == "memory" {
+		attemptStore = lockout.NewMemoryStore()
+	}
+	loginTracker := lockout.NewTracker(attemptStore, lockoutStore)
+
 	userStore := user.NewStore(s.db)
-	userHandler := user.NewHandler(userStore)
+	userHandler := user.NewHandler(userStore, mailSender, loginTracker)
 	userHandler.RegisterRoutes(subrouter)
 
+	accountStore := account.NewStore(s.db)
+	accountHandler := account.NewHandler(accountStore, userStore, mailSender)
+	accountHandler.RegisterRoutes(subrouter)
+
+	go account.NewPurger(accountStore, blobStore).Run(context.Background(), time.Hour)
+
+	exportStore := export.NewStore(s.db)
+	exporter := export.NewExporter(exportStore, mailSender, blobStore)
+	exportHandler := export.NewHandler(exportStore, userStore, exporter, blobStore)
+	exportHandler.RegisterRoutes(subrouter)
+
+	go exporter.Run(context.Background(), time.Minute)
+
 	profileStore := profile.NewStore(s.db)
-	profileHandler := profile.NewHandler(profileStore, userStore)
+	followStore := follower.NewStore(s.db)
+
+	// Feeds are built on every read unless caching is turned on
+	var feedStore types.FeedStore = feed.NewStore(s.db, blobStore)
+	if config.Envs.FeedMode == "cached" {
+		ttl := time.Second * time.Duration(config.Envs.FeedCacheTTLInSeconds)
+		feedStore = feed.NewCachedStore(feedStore, ttl, int(config.Envs.FeedCacheMaxEntries))
+	}
+
+	safetyStore := safety.NewStore(s.db)
+	safetyHandler := safety.NewHandler(safetyStore, userStore, feedStore)
+	safetyHandler.RegisterRoutes(subrouter)
+
+	// Every read of another user's data goes through the privacy policy
+	privacyPolicy := privacy.NewPolicy(profileStore, followStore, safetyStore)
+
+	// Events are pushed to connected clients through an in-process hub
+	hub := stream.NewMemoryHub(int(config.Envs.StreamBacklog), time.Second*time.Duration(config.Envs.StreamRetentionInSeconds))
+	go hub.Run(context.Background(), time.Minute)
+
+	streamHandler := stream.NewHandler(hub, userStore, time.Second*time.Duration(config.Envs.StreamHeartbeatInSeconds))
+	streamHandler.RegisterRoutes(subrouter)
+
+	notificationStore := notification.NewStore(s.db)
+	notifier := notification.NewNotifier(notificationStore, safetyStore, profileStore, hub)
+	notificationHandler := notification.NewHandler(notificationStore, userStore)
+	notificationHandler.RegisterRoutes(subrouter)
+
+	reminderLead := time.Second * time.Duration(config.Envs.VehicleReminderLeadInSeconds)
+	go notification.NewReminder(notificationStore, notifier, reminderLead).Run(context.Background(), time.Hour)
+
+	profileHandler := profile.NewHandler(profileStore, userStore, privacyPolicy, blobStore)
 	profileHandler.RegisterRoutes(subrouter)
 
-	followStore := follower.NewStore(s.db)
-	followHandler := follower.NewHandler(followStore, userStore)
+	followHandler := follower.NewHandler(followStore, userStore, profileStore, privacyPolicy, notifier, feedStore)
 	followHandler.RegisterRoutes(subrouter)
 
+	searchStore := search.NewStore(s.db)
+	searchHandler := search.NewHandler(searchStore, userStore)
+	searchHandler.RegisterRoutes(subrouter)
+
+	feedHandler := feed.NewHandler(feedStore, userStore)
+	feedHandler.RegisterRoutes(subrouter)
+
+	feedPublisher := feed.NewPublisher(feedStore, profileStore, hub)
+
 	mediaStore := media.NewStore(s.db)
+	imageProcessor := media.NewProcessor(blobStore)
 
 	garageStore := garage.NewStore(s.db)
-	garageHandler := garage.NewHandler(garageStore, userStore, mediaStore)
+	garageHandler := garage.NewHandler(garageStore, userStore, mediaStore, privacyPolicy, feedPublisher, blobStore, imageProcessor)
 	garageHandler.RegisterRoutes(subrouter)
 
 	vehicleHandler := vehicle.NewHandler(userStore)
 	vehicleHandler.RegisterRoutes(subrouter)
 
 	logbookStore := logbook.NewStore(s.db)
-	logHandler := logbook.NewHandler(logbookStore, userStore, garageStore, mediaStore)
+	logHandler := logbook.NewHandler(logbookStore, userStore, garageStore, mediaStore, privacyPolicy, feedPublisher, blobStore, imageProcessor)
 	logHandler.RegisterRoutes(subrouter)
 
+	mediaHandler := media.NewHandler(mediaStore, userStore, garageStore, logbookStore, privacyPolicy, blobStore)
+	mediaHandler.RegisterRoutes(subrouter)
+
+	// Clients upload straight to storage and confirm once done, unconfirmed
+	// uploads are swept once they expire
+	uploadStore := upload.NewStore(s.db)
+	uploadHandler := upload.NewHandler(uploadStore, userStore, garageStore, logbookStore, mediaStore, profileStore, feedPublisher, blobStore, imageProcessor)
+	uploadHandler.RegisterRoutes(subrouter)
+
+	go upload.NewSweeper(uploadStore, blobStore).Run(context.Background(), time.Minute*10)
+
+	socialStore := social.NewStore(s.db)
+	socialHandler := social.NewHandler(socialStore, userStore, privacyPolicy, notifier)
+	socialHandler.RegisterRoutes(subrouter)
+
 	log.Println("Starting server on", s.addr)
 	return http.ListenAndServe(s.addr, e)
 }
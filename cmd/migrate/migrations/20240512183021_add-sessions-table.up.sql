@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS `sessions` (
+  `id` CHAR(36) NOT NULL,
+  `user_id` CHAR(36) NOT NULL,
+  `refresh_token_hash` CHAR(64) NOT NULL,
+  `user_agent` VARCHAR(255) DEFAULT "",
+  `ip_address` VARCHAR(45) DEFAULT "",
+  `expires_at` TIMESTAMP NOT NULL,
+  `revoked_at` TIMESTAMP NULL DEFAULT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `last_used_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (id),
+  UNIQUE KEY (refresh_token_hash),
+  FOREIGN KEY (user_id) REFERENCES auth(id) ON DELETE CASCADE
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `password_resets` (
+  `id` CHAR(36) NOT NULL,
+  `user_id` CHAR(36) NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `expires_at` TIMESTAMP NOT NULL,
+  `used_at` TIMESTAMP NULL DEFAULT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (id),
+  UNIQUE KEY (token_hash),
+  FOREIGN KEY (user_id) REFERENCES auth(id) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE `auth` DROP COLUMN `email_verified_at`;
\ No newline at end of file
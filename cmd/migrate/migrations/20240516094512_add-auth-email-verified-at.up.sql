@@ -0,0 +1 @@
+ALTER TABLE `auth` ADD COLUMN `email_verified_at` TIMESTAMP NULL DEFAULT NULL;
\ No newline at end of file
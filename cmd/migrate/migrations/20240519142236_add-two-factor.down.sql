@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS `recovery_codes`;
+
+ALTER TABLE `auth`
+  DROP COLUMN `totp_secret`,
+  DROP COLUMN `totp_enabled_at`;
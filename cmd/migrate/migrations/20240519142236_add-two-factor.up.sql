@@ -0,0 +1,15 @@
+ALTER TABLE `auth`
+  ADD COLUMN `totp_secret` VARCHAR(64) NULL DEFAULT NULL,
+  ADD COLUMN `totp_enabled_at` TIMESTAMP NULL DEFAULT NULL;
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+  `id` CHAR(36) NOT NULL,
+  `user_id` CHAR(36) NOT NULL,
+  `code_hash` CHAR(64) NOT NULL,
+  `used_at` TIMESTAMP NULL DEFAULT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (id),
+  UNIQUE KEY (user_id, code_hash),
+  FOREIGN KEY (user_id) REFERENCES auth(id) ON DELETE CASCADE
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS `access_tokens` (
+  `id` CHAR(36) NOT NULL,
+  `user_id` CHAR(36) NOT NULL,
+  `name` VARCHAR(100) NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `scopes` VARCHAR(500) NOT NULL,
+  `last_used_at` TIMESTAMP NULL DEFAULT NULL,
+  `expires_at` TIMESTAMP NULL DEFAULT NULL,
+  `revoked_at` TIMESTAMP NULL DEFAULT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (id),
+  UNIQUE KEY (token_hash),
+  FOREIGN KEY (user_id) REFERENCES auth(id) ON DELETE CASCADE
+);
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS `login_attempts` (
+  `attempt_key` VARCHAR(255) NOT NULL,
+  `failures` INT UNSIGNED NOT NULL DEFAULT 0,
+  `last_failure_at` TIMESTAMP NULL DEFAULT NULL,
+  `locked_until` TIMESTAMP NULL DEFAULT NULL,
+
+  PRIMARY KEY (attempt_key)
+);
+
+CREATE TABLE IF NOT EXISTS `security_events` (
+  `id` CHAR(36) NOT NULL,
+  `user_id` CHAR(36) NOT NULL,
+  `event_type` VARCHAR(50) NOT NULL,
+  `ip_address` VARCHAR(45) DEFAULT "",
+  `user_agent` VARCHAR(255) DEFAULT "",
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (id),
+  KEY (user_id, created_at),
+  FOREIGN KEY (user_id) REFERENCES auth(id) ON DELETE CASCADE
+);
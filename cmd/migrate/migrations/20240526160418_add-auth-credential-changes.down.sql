@@ -0,0 +1,3 @@
+ALTER TABLE `auth`
+  DROP COLUMN `password_changed_at`,
+  DROP COLUMN `pending_email`;
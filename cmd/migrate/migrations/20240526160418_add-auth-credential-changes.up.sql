@@ -0,0 +1,3 @@
+ALTER TABLE `auth`
+  ADD COLUMN `password_changed_at` TIMESTAMP NULL DEFAULT NULL,
+  ADD COLUMN `pending_email` VARCHAR(255) NULL DEFAULT NULL;
@@ -0,0 +1 @@
+ALTER TABLE `auth` ADD COLUMN `deletion_scheduled_at` TIMESTAMP NULL DEFAULT NULL;
\ No newline at end of file
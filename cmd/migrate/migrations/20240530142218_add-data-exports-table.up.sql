@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS `data_exports` (
+  `id` CHAR(36) NOT NULL,
+  `user_id` CHAR(36) NOT NULL,
+  `status` VARCHAR(20) NOT NULL DEFAULT "pending",
+  `object_key` VARCHAR(500) DEFAULT "",
+  `size` BIGINT UNSIGNED NOT NULL DEFAULT 0,
+  `error` VARCHAR(255) DEFAULT "",
+  `expires_at` TIMESTAMP NULL DEFAULT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `completed_at` TIMESTAMP NULL DEFAULT NULL,
+
+  PRIMARY KEY (id),
+  KEY (status, created_at),
+  FOREIGN KEY (user_id) REFERENCES auth(id) ON DELETE CASCADE
+);
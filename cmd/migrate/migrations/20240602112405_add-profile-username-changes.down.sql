@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `reserved_usernames`;
+
+ALTER TABLE `profiles` DROP COLUMN `username_changed_at`;
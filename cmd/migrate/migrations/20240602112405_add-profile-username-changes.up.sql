@@ -0,0 +1,10 @@
+ALTER TABLE `profiles` ADD COLUMN `username_changed_at` TIMESTAMP NULL DEFAULT NULL;
+
+CREATE TABLE IF NOT EXISTS `reserved_usernames` (
+  `username` VARCHAR(255) NOT NULL,
+  `user_id` CHAR(36) NOT NULL,
+  `reserved_until` TIMESTAMP NOT NULL,
+
+  PRIMARY KEY (username),
+  FOREIGN KEY (user_id) REFERENCES auth(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+DROP INDEX `followers_following_status` ON `followers`;
+
+ALTER TABLE `followers` DROP COLUMN `status`;
@@ -0,0 +1,3 @@
+ALTER TABLE `followers` ADD COLUMN `status` VARCHAR(20) NOT NULL DEFAULT "accepted";
+
+CREATE INDEX `followers_following_status` ON `followers` (`following_id`, `status`);
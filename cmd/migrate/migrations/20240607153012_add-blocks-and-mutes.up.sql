@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS `user_blocks` (
+  `blocker_id` CHAR(36) NOT NULL,
+  `blocked_id` CHAR(36) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (blocker_id, blocked_id),
+  KEY (blocked_id),
+  FOREIGN KEY (blocker_id) REFERENCES auth(id) ON DELETE CASCADE,
+  FOREIGN KEY (blocked_id) REFERENCES auth(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `user_mutes` (
+  `muter_id` CHAR(36) NOT NULL,
+  `muted_id` CHAR(36) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (muter_id, muted_id),
+  FOREIGN KEY (muter_id) REFERENCES auth(id) ON DELETE CASCADE,
+  FOREIGN KEY (muted_id) REFERENCES auth(id) ON DELETE CASCADE
+);
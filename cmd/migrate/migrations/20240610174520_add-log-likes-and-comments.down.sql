@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `log_comments`;
+
+DROP TABLE IF EXISTS `log_likes`;
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS `log_likes` (
+  `log_id` CHAR(36) NOT NULL,
+  `user_id` CHAR(36) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (log_id, user_id),
+  KEY (user_id),
+  FOREIGN KEY (log_id) REFERENCES logs(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES auth(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `log_comments` (
+  `id` CHAR(36) NOT NULL,
+  `log_id` CHAR(36) NOT NULL,
+  `user_id` CHAR(36) NOT NULL,
+  `parent_id` CHAR(36) NULL DEFAULT NULL,
+  `body` VARCHAR(1000) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `edited_at` TIMESTAMP NULL DEFAULT NULL,
+
+  PRIMARY KEY (id),
+  KEY (log_id, created_at),
+  KEY (user_id, created_at),
+  FOREIGN KEY (log_id) REFERENCES logs(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES auth(id) ON DELETE CASCADE,
+  FOREIGN KEY (parent_id) REFERENCES log_comments(id) ON DELETE CASCADE
+);
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS `notifications` (
+  `id` CHAR(36) NOT NULL,
+  `user_id` CHAR(36) NOT NULL,
+  `actor_id` CHAR(36) NULL DEFAULT NULL,
+  `type` VARCHAR(32) NOT NULL,
+  `subject_id` CHAR(36) NULL DEFAULT NULL,
+  `message` VARCHAR(255) NOT NULL DEFAULT "",
+  `dedupe_key` VARCHAR(255) NULL DEFAULT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `read_at` TIMESTAMP NULL DEFAULT NULL,
+
+  PRIMARY KEY (id),
+  UNIQUE KEY (user_id, dedupe_key),
+  KEY (user_id, created_at),
+  FOREIGN KEY (user_id) REFERENCES auth(id) ON DELETE CASCADE,
+  FOREIGN KEY (actor_id) REFERENCES auth(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `notification_preferences` (
+  `user_id` CHAR(36) NOT NULL,
+  `type` VARCHAR(32) NOT NULL,
+  `enabled` BOOLEAN NOT NULL,
+
+  PRIMARY KEY (user_id, type),
+  FOREIGN KEY (user_id) REFERENCES auth(id) ON DELETE CASCADE
+);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS `pending_uploads` (
+  `id` CHAR(36) NOT NULL,
+  `user_id` CHAR(36) NOT NULL,
+  `kind` VARCHAR(32) NOT NULL,
+  `target_id` CHAR(36) NULL DEFAULT NULL,
+  `object_key` VARCHAR(512) NOT NULL,
+  `filename` VARCHAR(255) NOT NULL,
+  `content_type` VARCHAR(100) NOT NULL,
+  `size` BIGINT NOT NULL,
+  `checksum` CHAR(64) NOT NULL,
+  `expires_at` TIMESTAMP NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (id),
+  KEY (expires_at),
+  FOREIGN KEY (user_id) REFERENCES auth(id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+ALTER TABLE `media`
+  DROP COLUMN `thumbnail_key`,
+  DROP COLUMN `medium_key`,
+  DROP COLUMN `full_key`;
@@ -0,0 +1,4 @@
+ALTER TABLE `media`
+  ADD COLUMN `thumbnail_key` VARCHAR(512) NULL DEFAULT NULL,
+  ADD COLUMN `medium_key` VARCHAR(512) NULL DEFAULT NULL,
+  ADD COLUMN `full_key` VARCHAR(512) NULL DEFAULT NULL;
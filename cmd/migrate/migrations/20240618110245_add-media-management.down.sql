@@ -0,0 +1,4 @@
+ALTER TABLE `media`
+  DROP COLUMN `caption`,
+  DROP COLUMN `position`,
+  DROP COLUMN `cover`;
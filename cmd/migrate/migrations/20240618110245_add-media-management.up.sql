@@ -0,0 +1,4 @@
+ALTER TABLE `media`
+  ADD COLUMN `caption` VARCHAR(500) NOT NULL DEFAULT '',
+  ADD COLUMN `position` INT NOT NULL DEFAULT 0,
+  ADD COLUMN `cover` BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+ALTER TABLE `auth`
+  DROP COLUMN `totp_last_step`,
+  DROP COLUMN `totp_challenge_id`;
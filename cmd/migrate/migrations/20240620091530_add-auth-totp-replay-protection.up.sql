@@ -0,0 +1,3 @@
+ALTER TABLE `auth`
+  ADD COLUMN `totp_last_step` BIGINT NULL DEFAULT NULL,
+  ADD COLUMN `totp_challenge_id` CHAR(36) NULL DEFAULT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE `data_exports` ADD COLUMN `claimed_at` TIMESTAMP NULL DEFAULT NULL;
+
+UPDATE `data_exports` SET `claimed_at` = `created_at` WHERE `status` = "processing";
@@ -0,0 +1 @@
+ALTER TABLE `pending_uploads` ADD COLUMN `confirmed_at` TIMESTAMP NULL DEFAULT NULL;
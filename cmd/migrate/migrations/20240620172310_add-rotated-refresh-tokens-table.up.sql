@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS `rotated_refresh_tokens` (
+  `token_hash` CHAR(64) NOT NULL,
+  `session_id` CHAR(36) NOT NULL,
+  `rotated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (token_hash),
+  FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
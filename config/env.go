@@ -11,6 +11,7 @@ import (
 type Config struct {
 	PublicHost string
 	Port       string
+	AppURL     string
 
 	DBUser                 string
 	DBPassword             string
@@ -18,6 +19,58 @@ type Config struct {
 	DBName                 string
 	JWTExpirationInSeconds int64
 	JWTSecret              string
+	JWTSigningKeys         string
+	JWTActiveKeyID         string
+	JWTIssuer              string
+	JWTAudience            string
+
+	RefreshTokenExpirationInSeconds      int64
+	PasswordResetExpirationInSeconds     int64
+	EmailVerificationExpirationInSeconds int64
+
+	LoginAttemptStore string
+
+	AccountDeletionGracePeriodInSeconds int64
+
+	UsernameChangeIntervalInSeconds int64
+	UsernameReservationInSeconds    int64
+
+	CommentRateLimit           int64
+	CommentRateWindowInSeconds int64
+
+	VehicleReminderLeadInSeconds int64
+
+	StreamHeartbeatInSeconds int64
+	StreamBacklog            int64
+	StreamRetentionInSeconds int64
+
+	FeedMode              string
+	FeedCacheTTLInSeconds int64
+	FeedCacheMaxEntries   int64
+
+	DataExportRetentionInSeconds      int64
+	DataExportLinkExpirationInSeconds int64
+	DataExportTimeoutInSeconds        int64
+
+	BlobStore         string
+	BlobBucket        string
+	BlobPrefix        string
+	BlobEndpoint      string
+	BlobLocalDir      string
+	BlobBaseURL       string
+	BlobSigningSecret string
+
+	UploadAvatarMaxSize          int64
+	UploadVehicleImageMaxSize    int64
+	UploadLogMediaMaxSize        int64
+	UploadURLExpirationInSeconds int64
+	UploadExpirationInSeconds    int64
+
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string
+	MailFrom     string
 
 	DVLAApiKey string
 	DVSAApiKey string
@@ -31,14 +84,68 @@ func InitConfig() Config {
 	return Config{
 		PublicHost:             getEnv("PUBLIC_HOST", "http://localhost"),
 		Port:                   getEnv("PORT", "8080"),
+		AppURL:                 getEnv("APP_URL", "http://localhost:3000"),
 		DBUser:                 getEnv("DB_USER", "root"),
 		DBPassword:             getEnv("DB_PASSWORD", "password"),
 		DBAddress:              fmt.Sprintf("%s:%s", getEnv("DB_HOST", "127.0.0.1"), getEnv("DB_PORT", "3306")),
 		DBName:                 getEnv("DB_NAME", "logbook"),
-		JWTExpirationInSeconds: getEnvAsInt("JWT_EXPIRATION", 3600*24*7),
+		JWTExpirationInSeconds: getEnvAsInt("JWT_EXPIRATION", 60*15),
 		JWTSecret:              getEnv("JWT_SECRET", "temporary_secret_key?"),
-		DVLAApiKey:             getEnv("DVLA_API_KEY", ""),
-		DVSAApiKey:             getEnv("DVSA_MOT_API_KEY", ""),
+		JWTSigningKeys:         getEnv("JWT_SIGNING_KEYS", ""),
+		JWTActiveKeyID:         getEnv("JWT_ACTIVE_KEY_ID", ""),
+		JWTIssuer:              getEnv("JWT_ISSUER", "logbook-backend"),
+		JWTAudience:            getEnv("JWT_AUDIENCE", "logbook-app"),
+
+		RefreshTokenExpirationInSeconds:      getEnvAsInt("REFRESH_TOKEN_EXPIRATION", 3600*24*30),
+		PasswordResetExpirationInSeconds:     getEnvAsInt("PASSWORD_RESET_EXPIRATION", 3600),
+		EmailVerificationExpirationInSeconds: getEnvAsInt("EMAIL_VERIFICATION_EXPIRATION", 3600*24*2),
+
+		LoginAttemptStore: getEnv("LOGIN_ATTEMPT_STORE", "mysql"),
+
+		AccountDeletionGracePeriodInSeconds: getEnvAsInt("ACCOUNT_DELETION_GRACE_PERIOD", 3600*24*30),
+
+		UsernameChangeIntervalInSeconds: getEnvAsInt("USERNAME_CHANGE_INTERVAL", 3600*24*30),
+		UsernameReservationInSeconds:    getEnvAsInt("USERNAME_RESERVATION", 3600*24*14),
+
+		CommentRateLimit:           getEnvAsInt("COMMENT_RATE_LIMIT", 10),
+		CommentRateWindowInSeconds: getEnvAsInt("COMMENT_RATE_WINDOW", 60),
+
+		VehicleReminderLeadInSeconds: getEnvAsInt("VEHICLE_REMINDER_LEAD", 3600*24*14),
+
+		StreamHeartbeatInSeconds: getEnvAsInt("STREAM_HEARTBEAT", 25),
+		StreamBacklog:            getEnvAsInt("STREAM_BACKLOG", 100),
+		StreamRetentionInSeconds: getEnvAsInt("STREAM_RETENTION", 60*5),
+
+		FeedMode:              getEnv("FEED_MODE", "read"),
+		FeedCacheTTLInSeconds: getEnvAsInt("FEED_CACHE_TTL", 30),
+		FeedCacheMaxEntries:   getEnvAsInt("FEED_CACHE_MAX_ENTRIES", 10000),
+
+		DataExportRetentionInSeconds:      getEnvAsInt("DATA_EXPORT_RETENTION", 3600*24*7),
+		DataExportLinkExpirationInSeconds: getEnvAsInt("DATA_EXPORT_LINK_EXPIRATION", 60*15),
+		DataExportTimeoutInSeconds:        getEnvAsInt("DATA_EXPORT_TIMEOUT", 3600),
+
+		BlobStore:         getEnv("BLOB_STORE", "s3"),
+		BlobBucket:        getEnv("BLOB_BUCKET", "logbook-app"),
+		BlobPrefix:        getEnv("BLOB_PREFIX", ""),
+		BlobEndpoint:      getEnv("BLOB_ENDPOINT", ""),
+		BlobLocalDir:      getEnv("BLOB_LOCAL_DIR", "./uploads"),
+		BlobBaseURL:       getEnv("BLOB_BASE_URL", "http://localhost:8080/blobs"),
+		BlobSigningSecret: getEnv("BLOB_SIGNING_SECRET", "temporary_blob_secret?"),
+
+		UploadAvatarMaxSize:          getEnvAsInt("UPLOAD_AVATAR_MAX_SIZE", 5<<20),
+		UploadVehicleImageMaxSize:    getEnvAsInt("UPLOAD_VEHICLE_IMAGE_MAX_SIZE", 15<<20),
+		UploadLogMediaMaxSize:        getEnvAsInt("UPLOAD_LOG_MEDIA_MAX_SIZE", 20<<20),
+		UploadURLExpirationInSeconds: getEnvAsInt("UPLOAD_URL_EXPIRATION", 60*15),
+		UploadExpirationInSeconds:    getEnvAsInt("UPLOAD_EXPIRATION", 3600),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUser:     getEnv("SMTP_USER", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		MailFrom:     getEnv("MAIL_FROM", "Logbook <no-reply@localhost>"),
+
+		DVLAApiKey: getEnv("DVLA_API_KEY", ""),
+		DVSAApiKey: getEnv("DVSA_MOT_API_KEY", ""),
 	}
 }
 
@@ -0,0 +1,88 @@
+package account
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+// Purger removes accounts whose deletion grace period has passed.
+type Purger struct {
+	store types.AccountStore
+	blobs types.BlobStore
+}
+
+func NewPurger(store types.AccountStore, blobs types.BlobStore) *Purger {
+	return &Purger{store: store, blobs: blobs}
+}
+
+// Run purges due accounts every interval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.PurgeDue(ctx); err != nil {
+			log.Printf("error purging accounts: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Purger) PurgeDue(ctx context.Context) error {
+	now := time.Now()
+
+	ids, err := p.store.GetAccountsDueForPurge(now)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		// One failing account shouldn't block the rest, it is retried next run
+		if err := p.purge(ctx, id, now); err != nil {
+			log.Printf("error purging account %s: %v", id, err)
+			continue
+		}
+
+		log.Printf("purged account %s", id)
+	}
+
+	return nil
+}
+
+// purge deletes the stored files first. If that fails the rows that point to
+// them are still there, so the next run can try again.
+func (p *Purger) purge(ctx context.Context, userId uuid.UUID, now time.Time) error {
+	objects, err := p.store.GetAccountObjects(userId)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(objects.Locations))
+	for _, location := range objects.Locations {
+		keys = append(keys, p.blobs.KeyFromLocation(location))
+	}
+
+	prefixes := []string{fmt.Sprintf("avatars/user/%s/", userId), fmt.Sprintf("exports/%s/", userId)}
+	for _, id := range objects.VehicleIDs {
+		prefixes = append(prefixes, fmt.Sprintf("vehicles/%s/", id))
+	}
+	for _, id := range objects.LogIDs {
+		prefixes = append(prefixes, fmt.Sprintf("logbook/%s/", id))
+	}
+
+	if err := p.blobs.Delete(ctx, keys, prefixes); err != nil {
+		return err
+	}
+
+	return p.store.PurgeAccount(userId, now)
+}
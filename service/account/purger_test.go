@@ -0,0 +1,171 @@
+package account
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/service/blob"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+func TestPurger(t *testing.T) {
+	ctx := context.Background()
+
+	local, err := blob.NewLocalStore(t.TempDir(), "", "http://localhost:8080/blobs", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := &flakyBlobStore{LocalStore: local}
+
+	store := newMockAccountStore()
+	purger := NewPurger(store, blobs)
+
+	// addAccount stores a vehicle image and an avatar for a new account
+	addAccount := func(deleteAt time.Time) (uuid.UUID, []string) {
+		userId, vehicleId := uuid.New(), uuid.New()
+		keys := []string{
+			fmt.Sprintf("vehicles/%s/images/%s/full.jpg", vehicleId, uuid.New()),
+			fmt.Sprintf("avatars/user/%s/%s", userId, uuid.New()),
+		}
+
+		locations := make([]string, 0)
+		for _, key := range keys {
+			location, err := blobs.Put(ctx, key, "image/jpeg", strings.NewReader("image"), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			locations = append(locations, location)
+		}
+
+		store.ScheduleDeletion(userId, deleteAt)
+		store.objects[userId] = &types.AccountObjects{
+			Locations:  locations[1:],
+			VehicleIDs: []uuid.UUID{vehicleId},
+			LogIDs:     []uuid.UUID{},
+		}
+
+		return userId, keys
+	}
+
+	exists := func(key string) bool {
+		_, err := blobs.Stat(ctx, key)
+		return err == nil
+	}
+
+	t.Run("should not purge accounts in or cancelled during the grace period", func(t *testing.T) {
+		waiting, waitingKeys := addAccount(time.Now().Add(time.Hour))
+		cancelled, cancelledKeys := addAccount(time.Now().Add(-time.Minute))
+		store.CancelDeletion(cancelled)
+
+		if err := purger.PurgeDue(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if store.purged[waiting] || store.purged[cancelled] {
+			t.Error("expected neither account to be purged")
+		}
+
+		for _, key := range append(waitingKeys, cancelledKeys...) {
+			if !exists(key) {
+				t.Errorf("expected %s to be kept", key)
+			}
+		}
+	})
+
+	t.Run("should keep an account queued when its files can't be deleted", func(t *testing.T) {
+		userId, keys := addAccount(time.Now().Add(-time.Minute))
+
+		blobs.err = fmt.Errorf("storage unavailable")
+		if err := purger.PurgeDue(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if store.purged[userId] {
+			t.Fatal("expected the account rows to be kept")
+		}
+		if _, ok := store.scheduled[userId]; !ok {
+			t.Fatal("expected the account to still be scheduled for deletion")
+		}
+
+		blobs.err = nil
+		if err := purger.PurgeDue(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if !store.purged[userId] {
+			t.Error("expected the account to be purged on the next run")
+		}
+
+		for _, key := range keys {
+			if exists(key) {
+				t.Errorf("expected %s to be deleted", key)
+			}
+		}
+	})
+}
+
+// flakyBlobStore fails deletes while err is set.
+type flakyBlobStore struct {
+	*blob.LocalStore
+	err error
+}
+
+func (s *flakyBlobStore) Delete(ctx context.Context, keys []string, prefixes []string) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.LocalStore.Delete(ctx, keys, prefixes)
+}
+
+type mockAccountStore struct {
+	scheduled map[uuid.UUID]time.Time
+	objects   map[uuid.UUID]*types.AccountObjects
+	purged    map[uuid.UUID]bool
+}
+
+func newMockAccountStore() *mockAccountStore {
+	return &mockAccountStore{
+		scheduled: make(map[uuid.UUID]time.Time),
+		objects:   make(map[uuid.UUID]*types.AccountObjects),
+		purged:    make(map[uuid.UUID]bool),
+	}
+}
+
+func (m *mockAccountStore) ScheduleDeletion(userId uuid.UUID, at time.Time) error {
+	m.scheduled[userId] = at
+	return nil
+}
+
+func (m *mockAccountStore) CancelDeletion(userId uuid.UUID) error {
+	delete(m.scheduled, userId)
+	return nil
+}
+
+func (m *mockAccountStore) GetAccountsDueForPurge(before time.Time) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0)
+	for id, at := range m.scheduled {
+		if !at.After(before) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *mockAccountStore) GetAccountObjects(userId uuid.UUID) (*types.AccountObjects, error) {
+	return m.objects[userId], nil
+}
+
+func (m *mockAccountStore) PurgeAccount(userId uuid.UUID, before time.Time) error {
+	at, ok := m.scheduled[userId]
+	if !ok || at.After(before) {
+		return fmt.Errorf("account %s is not due for deletion", userId)
+	}
+
+	delete(m.scheduled, userId)
+	m.purged[userId] = true
+	return nil
+}
@@ -0,0 +1,110 @@
+package account
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/ZondaF12/logbook-backend/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	store     types.AccountStore
+	userStore types.UserStore
+	mailer    types.Mailer
+}
+
+func NewHandler(store types.AccountStore, userStore types.UserStore, mailer types.Mailer) *Handler {
+	return &Handler{
+		store:     store,
+		userStore: userStore,
+		mailer:    mailer,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *echo.Group) {
+	router.DELETE("/self", auth.WithJWTAuth(h.HandleDeleteAccount, h.userStore))
+	router.POST("/self/restore", auth.WithJWTAuth(h.HandleCancelDeletion, h.userStore))
+}
+
+func (h *Handler) HandleDeleteAccount(c echo.Context) error {
+	// Parse payload
+	var payload types.DeleteAccountPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	// Get user and session IDs from JWT
+	ctx := c.Request().Context()
+	userId := auth.GetUserIDFromContext(ctx)
+	sessionId := auth.GetSessionIDFromContext(ctx)
+
+	u, err := h.userStore.GetUserByID(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if !auth.ComparePassword(u.Password, payload.Password) {
+		return echo.NewHTTPError(http.StatusBadRequest, "password is incorrect")
+	}
+
+	if u.DeletionScheduledAt != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Account deletion already scheduled")
+	}
+
+	// Nothing is removed until the grace period is over, the background purge
+	// takes care of it after that
+	deleteAt := time.Now().Add(time.Second * time.Duration(config.Envs.AccountDeletionGracePeriodInSeconds))
+	if err := h.store.ScheduleDeletion(u.ID, deleteAt); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if err := h.userStore.RevokeOtherSessions(u.ID, sessionId); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	err = h.mailer.Send(types.Email{
+		To:      u.Email,
+		Subject: "Your Logbook account will be deleted",
+		Body: fmt.Sprintf("Your Logbook account and everything in it will be permanently deleted on %s.\n\n"+
+			"If you change your mind, log in and restore your account before then.",
+			deleteAt.Format("2 January 2006")),
+	})
+	if err != nil {
+		log.Printf("error sending account deletion notice: %v", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"deletion_scheduled_at": deleteAt.Format(time.RFC3339)})
+}
+
+func (h *Handler) HandleCancelDeletion(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	u, err := h.userStore.GetUserByID(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if u.DeletionScheduledAt == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Account deletion not scheduled")
+	}
+
+	if err := h.store.CancelDeletion(u.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, "Account deletion cancelled")
+}
@@ -0,0 +1,182 @@
+package account
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) ScheduleDeletion(userId uuid.UUID, at time.Time) error {
+	_, err := s.db.Exec("UPDATE auth SET deletion_scheduled_at = ? WHERE id = ?", at, userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) CancelDeletion(userId uuid.UUID) error {
+	_, err := s.db.Exec("UPDATE auth SET deletion_scheduled_at = NULL WHERE id = ?", userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) GetAccountsDueForPurge(before time.Time) ([]uuid.UUID, error) {
+	rows, err := s.db.Query("SELECT id FROM auth WHERE deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func (s *Store) GetAccountObjects(userId uuid.UUID) (*types.AccountObjects, error) {
+	objects := &types.AccountObjects{
+		Locations:  make([]string, 0),
+		VehicleIDs: make([]uuid.UUID, 0),
+		LogIDs:     make([]uuid.UUID, 0),
+	}
+
+	rows, err := s.db.Query(`
+		SELECT m.s3_location
+		FROM media m
+		LEFT JOIN vehicles v ON v.id = m.vehicle_id
+		LEFT JOIN logs l ON l.id = m.log_id
+		LEFT JOIN vehicles lv ON lv.id = l.vehicle_id
+		WHERE m.user_id = ? OR v.user_id = ? OR lv.user_id = ?
+		UNION
+		SELECT avatar FROM profiles WHERE user_id = ? AND avatar <> ''`,
+		userId, userId, userId, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var location string
+		if err := rows.Scan(&location); err != nil {
+			return nil, err
+		}
+
+		objects.Locations = append(objects.Locations, location)
+	}
+
+	vehicles, err := s.db.Query("SELECT id FROM vehicles WHERE user_id = ?", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer vehicles.Close()
+
+	for vehicles.Next() {
+		var id uuid.UUID
+		if err := vehicles.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		objects.VehicleIDs = append(objects.VehicleIDs, id)
+	}
+
+	logs, err := s.db.Query("SELECT l.id FROM logs l JOIN vehicles v ON v.id = l.vehicle_id WHERE v.user_id = ?", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer logs.Close()
+
+	for logs.Next() {
+		var id uuid.UUID
+		if err := logs.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		objects.LogIDs = append(objects.LogIDs, id)
+	}
+
+	return objects, nil
+}
+
+// purgeStatements delete the account's rows children first so no foreign key
+// is violated. Tables added with ON DELETE CASCADE are cleaned up by the final
+// delete from auth.
+var purgeStatements = []string{
+	`DELETE m FROM media m
+		LEFT JOIN vehicles v ON v.id = m.vehicle_id
+		LEFT JOIN logs l ON l.id = m.log_id
+		LEFT JOIN vehicles lv ON lv.id = l.vehicle_id
+		WHERE m.user_id = ? OR v.user_id = ? OR lv.user_id = ?`,
+	`DELETE l FROM logs l JOIN vehicles v ON v.id = l.vehicle_id WHERE v.user_id = ?`,
+	`DELETE FROM vehicles WHERE user_id = ?`,
+	`DELETE FROM followers WHERE follower_id = ? OR following_id = ?`,
+	`DELETE FROM profiles WHERE user_id = ?`,
+	`DELETE FROM login_attempts WHERE attempt_key = (SELECT CONCAT('account:', LOWER(email)) FROM auth WHERE id = ?)`,
+	`DELETE FROM auth WHERE id = ?`,
+}
+
+func (s *Store) PurgeAccount(userId uuid.UUID, before time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the account row so a cancellation can't race the purge
+	var scheduledAt sql.NullTime
+	err = tx.QueryRow("SELECT deletion_scheduled_at FROM auth WHERE id = ? FOR UPDATE", userId).Scan(&scheduledAt)
+	if err != nil {
+		return err
+	}
+
+	if !scheduledAt.Valid || scheduledAt.Time.After(before) {
+		return fmt.Errorf("account %s is not due for deletion", userId)
+	}
+
+	for _, statement := range purgeStatements {
+		args := make([]interface{}, 0)
+		for i := 0; i < countPlaceholders(statement); i++ {
+			args = append(args, userId)
+		}
+
+		if _, err := tx.Exec(statement, args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func countPlaceholders(query string) int {
+	count := 0
+	for _, r := range query {
+		if r == '?' {
+			count++
+		}
+	}
+
+	return count
+}
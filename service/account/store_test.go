@@ -0,0 +1,84 @@
+package account
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+var (
+	createTableRe = regexp.MustCompile("(?i)CREATE TABLE (?:IF NOT EXISTS )?`?(\\w+)`?")
+	foreignKeyRe  = regexp.MustCompile(`(?i)FOREIGN KEY \(\w+\) REFERENCES (\w+)\(\w+\)( ON DELETE CASCADE)?`)
+	deleteFromRe  = regexp.MustCompile(`(?i)DELETE (?:\w+ )?FROM (\w+)`)
+)
+
+// restrictingKeys reads the migrations and returns, for each table, the tables
+// whose foreign keys stop its rows being deleted while they still point at
+// them.
+func restrictingKeys(t *testing.T) map[string][]string {
+	files, err := filepath.Glob("../../cmd/migrate/migrations/*.up.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("could not find migrations: %v", err)
+	}
+	sort.Strings(files)
+
+	children := make(map[string][]string)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		table := createTableRe.FindSubmatch(data)
+		if table == nil {
+			continue
+		}
+
+		for _, fk := range foreignKeyRe.FindAllSubmatch(data, -1) {
+			parent, cascade := string(fk[1]), len(fk[2]) > 0
+			if !cascade && parent != string(table[1]) {
+				children[parent] = append(children[parent], string(table[1]))
+			}
+		}
+	}
+
+	return children
+}
+
+func TestPurgeStatementsOrder(t *testing.T) {
+	children := restrictingKeys(t)
+	if len(children["auth"]) == 0 {
+		t.Fatal("expected tables referencing auth without ON DELETE CASCADE")
+	}
+
+	deleted := make(map[string]bool)
+	for _, statement := range purgeStatements {
+		match := deleteFromRe.FindStringSubmatch(statement)
+		if match == nil {
+			continue
+		}
+		table := match[1]
+
+		for _, child := range children[table] {
+			if !deleted[child] {
+				t.Errorf("%s is deleted before %s, which references it", table, child)
+			}
+		}
+
+		deleted[table] = true
+	}
+
+	if !deleted["auth"] {
+		t.Error("expected the auth row to be deleted")
+	}
+}
+
+func TestCountPlaceholders(t *testing.T) {
+	for _, statement := range purgeStatements {
+		if countPlaceholders(statement) == 0 {
+			t.Errorf("expected statement to be scoped to the user: %s", statement)
+		}
+	}
+}
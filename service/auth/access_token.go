@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+// AccessTokenPrefix marks personal access tokens so they can be told apart
+// from JWTs without a lookup, and so leaked tokens are easy to scan for.
+const AccessTokenPrefix = "lbk_pat_"
+
+const (
+	ScopeProfileRead    = "profile:read"
+	ScopeProfileWrite   = "profile:write"
+	ScopeFollowersRead  = "followers:read"
+	ScopeFollowersWrite = "followers:write"
+	ScopeGarageRead     = "garage:read"
+	ScopeGarageWrite    = "garage:write"
+	ScopeLogbookRead    = "logbook:read"
+	ScopeLogbookWrite   = "logbook:write"
+)
+
+var Scopes = []string{
+	ScopeProfileRead,
+	ScopeProfileWrite,
+	ScopeFollowersRead,
+	ScopeFollowersWrite,
+	ScopeGarageRead,
+	ScopeGarageWrite,
+	ScopeLogbookRead,
+	ScopeLogbookWrite,
+}
+
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// NewAccessToken returns a personal access token and the hash to persist.
+func NewAccessToken() (string, string, error) {
+	token, _, err := NewOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	token = AccessTokenPrefix + token
+
+	return token, HashOpaqueToken(token), nil
+}
+
+func authenticateAccessToken(store types.UserStore, tokenString, scope string) (uuid.UUID, error) {
+	if scope == "" {
+		return uuid.Nil, fmt.Errorf("route does not accept access tokens")
+	}
+
+	token, err := store.GetAccessTokenByHash(HashOpaqueToken(tokenString))
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if !token.Active() {
+		return uuid.Nil, fmt.Errorf("access token %s is no longer active", token.ID)
+	}
+
+	if !token.HasScope(scope) {
+		return uuid.Nil, fmt.Errorf("access token %s is missing scope %s", token.ID, scope)
+	}
+
+	if err := store.TouchAccessToken(token.ID); err != nil {
+		return uuid.Nil, err
+	}
+
+	return token.UserID, nil
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+)
+
+func TestNewAccessToken(t *testing.T) {
+	token, hash, err := NewAccessToken()
+	if err != nil {
+		t.Fatalf("error creating access token: %v", err)
+	}
+
+	if !IsAccessToken(token) {
+		t.Errorf("expected token to start with %s", AccessTokenPrefix)
+	}
+
+	if HashOpaqueToken(token) != hash {
+		t.Error("expected hash to match token")
+	}
+}
+
+func TestAccessTokenScopes(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+
+	token := types.AccessToken{Scopes: []string{ScopeGarageRead}}
+	if !token.Active() {
+		t.Error("expected token without expiry to be active")
+	}
+
+	if !token.HasScope(ScopeGarageRead) || token.HasScope(ScopeGarageWrite) {
+		t.Error("expected token to only have garage:read")
+	}
+
+	token.ExpiresAt = &expired
+	if token.Active() {
+		t.Error("expected expired token to be inactive")
+	}
+}
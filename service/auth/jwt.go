@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/ZondaF12/logbook-backend/config"
@@ -16,17 +17,59 @@ import (
 
 type contextKey string
 
-const UserKey contextKey = "userId"
+const (
+	UserKey    contextKey = "userId"
+	SessionKey contextKey = "sessionId"
+)
 
-func CreateJWT(secret []byte, userID uuid.UUID) (string, error) {
-	expiration := time.Second * time.Duration(config.Envs.JWTExpirationInSeconds)
+// Claims are the claims carried by every token we sign. The user ID is stored
+// in the standard sub claim and the session in sid. Access tokens have no
+// purpose, single use tokens such as email verification links set one so they
+// can never be used to authenticate requests.
+type Claims struct {
+	SessionID string `json:"sid,omitempty"`
+	Purpose   string `json:"purpose,omitempty"`
+	Email     string `json:"email,omitempty"`
+	jwt.RegisteredClaims
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId":    userID,
-		"expiredAt": time.Now().Add(expiration).Unix(),
-	})
+type authOptions struct {
+	requireVerifiedEmail bool
+	scope                string
+}
+
+type AuthOption func(*authOptions)
+
+// RequireVerifiedEmail rejects users who have not verified their email address.
+func RequireVerifiedEmail() AuthOption {
+	return func(o *authOptions) {
+		o.requireVerifiedEmail = true
+	}
+}
 
-	tokenString, err := token.SignedString(secret)
+// RequireScope names the scope a personal access token needs to call the
+// route. Routes without a scope only accept session tokens.
+func RequireScope(scope string) AuthOption {
+	return func(o *authOptions) {
+		o.scope = scope
+	}
+}
+
+func CreateJWT(keys *Keyring, userID, sessionID uuid.UUID) (string, error) {
+	expiration := time.Second * time.Duration(config.Envs.JWTExpirationInSeconds)
+	now := time.Now()
+
+	tokenString, err := keys.Sign(Claims{
+		SessionID: sessionID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Envs.JWTIssuer,
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{config.Envs.JWTAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
 	if err != nil {
 		return "", err
 	}
@@ -34,61 +77,154 @@ func CreateJWT(secret []byte, userID uuid.UUID) (string, error) {
 	return tokenString, nil
 }
 
-func WithJWTAuth(next echo.HandlerFunc, store types.UserStore) echo.HandlerFunc {
+func WithJWTAuth(next echo.HandlerFunc, store types.UserStore, opts ...AuthOption) echo.HandlerFunc {
+	options := new(authOptions)
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	return func(c echo.Context) error {
 		// Get Token from request
 		tokenString := getTokenFromRequest(c)
 
-		// Validate JWT Token
-		token, err := validateToken(tokenString)
-		if err != nil {
-			fmt.Println(tokenString)
-			log.Printf("error validating token: %v", err)
-			return permissionDenied()
+		// Personal access tokens are opaque, everything else must be a JWT
+		var userId, sessionId uuid.UUID
+		var err error
+		if IsAccessToken(tokenString) {
+			userId, err = authenticateAccessToken(store, tokenString, options.scope)
+		} else {
+			userId, sessionId, err = authenticateSession(store, tokenString)
 		}
-
-		if !token.Valid {
-			log.Printf("token is invalid")
+		if err != nil {
+			log.Printf("error authenticating request: %v", err)
 			return permissionDenied()
 		}
 
-		// Get User ID from JWT Token if valid
-		claims := token.Claims.(jwt.MapClaims)
-		userId := claims["userId"].(string)
-
-		u, err := store.GetUserByID(uuid.MustParse(userId))
+		u, err := store.GetUserByID(userId)
 		if err != nil {
 			log.Printf("error getting user: %v", err)
 			return permissionDenied()
 		}
 
-		// set context with user ID
+		if options.requireVerifiedEmail && !u.EmailVerified() {
+			return echo.NewHTTPError(http.StatusForbidden, "email address not verified")
+		}
+
+		// set context with user and session IDs
 		ctx := c.Request().Context()
 		ctx = context.WithValue(ctx, UserKey, u.ID)
+		ctx = context.WithValue(ctx, SessionKey, sessionId)
 		c.SetRequest(c.Request().WithContext(ctx))
 
 		return next(c)
 	}
 }
 
+// authenticateSession validates an access JWT and makes sure the session it
+// belongs to has not been revoked or expired.
+func authenticateSession(store types.UserStore, tokenString string) (uuid.UUID, uuid.UUID, error) {
+	keys, err := Keys()
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	// Validate JWT Token
+	claims, err := ParseJWT(keys, tokenString)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	if claims.Purpose != "" {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("%s token used for authentication", claims.Purpose)
+	}
+
+	// Get User and Session IDs from JWT Token if valid
+	userId, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	sessionId, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	session, err := store.GetSessionByID(sessionId)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	if session.UserID != userId || !session.Active() {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("session %s is no longer active", sessionId)
+	}
+
+	return userId, sessionId, nil
+}
+
 func getTokenFromRequest(c echo.Context) string {
 	tokenAuth := c.Request().Header.Get("Authorization")
 	if tokenAuth != "" {
-		return tokenAuth
+		return strings.TrimPrefix(tokenAuth, "Bearer ")
 	}
 
 	return ""
 }
 
-func validateToken(t string) (*jwt.Token, error) {
-	return jwt.Parse(t, func(token *jwt.Token) (interface{}, error) {
-		// Check the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
+// createPurposeJWT signs a short lived token that can only be used for the
+// given purpose.
+func createPurposeJWT(keys *Keyring, purpose string, userID uuid.UUID, email string, ttl time.Duration) (string, error) {
+	return keys.Sign(purposeClaims(purpose, userID, email, ttl))
+}
 
-		return []byte(config.Envs.JWTSecret), nil
-	})
+func purposeClaims(purpose string, userID uuid.UUID, email string, ttl time.Duration) Claims {
+	now := time.Now()
+
+	return Claims{
+		Purpose: purpose,
+		Email:   email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Envs.JWTIssuer,
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{config.Envs.JWTAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+}
+
+// parsePurposeJWT verifies the token and checks it was issued for purpose.
+func parsePurposeJWT(keys *Keyring, purpose, t string) (*Claims, error) {
+	claims, err := ParseJWT(keys, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != purpose {
+		return nil, fmt.Errorf("token is not a %s token", purpose)
+	}
+
+	return claims, nil
+}
+
+// ParseJWT verifies the token against the keyring and enforces the exp, nbf,
+// iat, iss and aud claims.
+func ParseJWT(keys *Keyring, t string) (*Claims, error) {
+	claims := new(Claims)
+
+	_, err := jwt.ParseWithClaims(t, claims, keys.Keyfunc,
+		jwt.WithValidMethods(keys.Methods()),
+		jwt.WithIssuer(config.Envs.JWTIssuer),
+		jwt.WithAudience(config.Envs.JWTAudience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
 }
 
 func permissionDenied() error {
@@ -103,3 +239,12 @@ func GetUserIDFromContext(ctx context.Context) uuid.UUID {
 
 	return userId
 }
+
+func GetSessionIDFromContext(ctx context.Context) uuid.UUID {
+	sessionId, ok := ctx.Value(SessionKey).(uuid.UUID)
+	if !ok {
+		return uuid.Nil
+	}
+
+	return sessionId
+}
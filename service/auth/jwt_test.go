@@ -2,14 +2,23 @@ package auth
 
 import (
 	"testing"
+	"time"
 
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
 func TestCreateJWT(t *testing.T) {
-	secret := []byte("secret")
+	keys, err := NewKeyring("test", NewHMACKey("test", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uuid.New()
+	sessionID := uuid.New()
 
-	token, err := CreateJWT(secret, uuid.New())
+	token, err := CreateJWT(keys, userID, sessionID)
 	if err != nil {
 		t.Errorf("error creating JWT: %v", err)
 	}
@@ -17,4 +26,66 @@ func TestCreateJWT(t *testing.T) {
 	if token == "" {
 		t.Error("expected token to be not empty")
 	}
+
+	claims, err := ParseJWT(keys, token)
+	if err != nil {
+		t.Fatalf("error parsing JWT: %v", err)
+	}
+
+	if claims.Subject != userID.String() {
+		t.Errorf("expected subject %s, got %s", userID, claims.Subject)
+	}
+
+	if claims.SessionID != sessionID.String() {
+		t.Errorf("expected session %s, got %s", sessionID, claims.SessionID)
+	}
+}
+
+func TestParseJWTEnforcesClaims(t *testing.T) {
+	keys, err := NewKeyring("test", NewHMACKey("test", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := jwt.RegisteredClaims{
+		Issuer:    config.Envs.JWTIssuer,
+		Subject:   uuid.NewString(),
+		Audience:  jwt.ClaimStrings{config.Envs.JWTAudience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+
+	tests := map[string]func(c *jwt.RegisteredClaims){
+		"expired": func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+		},
+		"missing expiry": func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = nil
+		},
+		"not yet valid": func(c *jwt.RegisteredClaims) {
+			c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		},
+		"wrong issuer": func(c *jwt.RegisteredClaims) {
+			c.Issuer = "someone-else"
+		},
+		"wrong audience": func(c *jwt.RegisteredClaims) {
+			c.Audience = jwt.ClaimStrings{"someone-else"}
+		},
+	}
+
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := valid
+			mutate(&claims)
+
+			token, err := keys.Sign(Claims{RegisteredClaims: claims})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := ParseJWT(keys, token); err == nil {
+				t.Error("expected token to be rejected")
+			}
+		})
+	}
 }
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// SigningKey is a single entry in the keyring, identified by the kid header
+// of the tokens it signs.
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+func NewHMACKey(id string, secret []byte) *SigningKey {
+	return &SigningKey{
+		ID:        id,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+func NewRSAKey(id string, privatePEM []byte) (*SigningKey, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:        id,
+		Method:    jwt.SigningMethodRS256,
+		signKey:   key,
+		verifyKey: &key.PublicKey,
+	}, nil
+}
+
+func NewEd25519Key(id string, privatePEM []byte) (*SigningKey, error) {
+	key, err := jwt.ParseEdPrivateKeyFromPEM(privatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key %s is not an ed25519 private key", id)
+	}
+
+	return &SigningKey{
+		ID:        id,
+		Method:    jwt.SigningMethodEdDSA,
+		signKey:   private,
+		verifyKey: private.Public(),
+	}, nil
+}
+
+// Keyring holds every key that tokens may currently be verified with. Only the
+// active key is used for signing, so a secret can be rotated by adding a new
+// key, making it active, and removing the old one once its tokens expire.
+type Keyring struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+func NewKeyring(activeID string, keys ...*SigningKey) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]*SigningKey)}
+
+	for _, key := range keys {
+		if _, ok := k.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate signing key id %s", key.ID)
+		}
+		k.keys[key.ID] = key
+	}
+
+	active, ok := k.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %s not found", activeID)
+	}
+	k.active = active
+
+	return k, nil
+}
+
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.active.Method, claims)
+	token.Header["kid"] = k.active.ID
+
+	return token.SignedString(k.active.signKey)
+}
+
+// Keyfunc resolves the verification key from the token's kid header and makes
+// sure the token was signed with the algorithm that key is meant for.
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, fmt.Errorf("token is missing a kid header")
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %s", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.verifyKey, nil
+}
+
+// Methods lists the algorithms of every key in the keyring.
+func (k *Keyring) Methods() []string {
+	seen := make(map[string]bool)
+	methods := make([]string, 0, len(k.keys))
+	for _, key := range k.keys {
+		if !seen[key.Method.Alg()] {
+			seen[key.Method.Alg()] = true
+			methods = append(methods, key.Method.Alg())
+		}
+	}
+
+	return methods
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public verification keys. Symmetric keys are never
+// published.
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+
+	for _, key := range k.keys {
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.ID,
+				Alg: key.Method.Alg(),
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.ID,
+				Alg: key.Method.Alg(),
+				Use: "sig",
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+
+	return set
+}
+
+// ParseKeyring builds a keyring from a spec of comma separated
+// "kid=ALG:value" entries. For HS256 the value is the secret itself, for RS256
+// and EdDSA it is the path to a PEM encoded private key. An empty spec falls
+// back to a single HS256 key using fallbackSecret.
+func ParseKeyring(spec, activeID, fallbackSecret string) (*Keyring, error) {
+	if strings.TrimSpace(spec) == "" {
+		return NewKeyring("default", NewHMACKey("default", []byte(fallbackSecret)))
+	}
+
+	keys := make([]*SigningKey, 0)
+	for _, entry := range strings.Split(spec, ",") {
+		kid, rest, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid signing key entry %q", entry)
+		}
+
+		alg, value, ok := strings.Cut(rest, ":")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid signing key entry for %s", kid)
+		}
+
+		key, err := parseSigningKey(kid, alg, value)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if activeID == "" {
+		activeID = keys[len(keys)-1].ID
+	}
+
+	return NewKeyring(activeID, keys...)
+}
+
+func parseSigningKey(kid, alg, value string) (*SigningKey, error) {
+	switch alg {
+	case jwt.SigningMethodHS256.Alg():
+		return NewHMACKey(kid, []byte(value)), nil
+	case jwt.SigningMethodRS256.Alg():
+		pem, err := os.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+		return NewRSAKey(kid, pem)
+	case jwt.SigningMethodEdDSA.Alg():
+		pem, err := os.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+		return NewEd25519Key(kid, pem)
+	}
+
+	return nil, fmt.Errorf("unsupported signing algorithm %s for key %s", alg, kid)
+}
+
+var (
+	keyringOnce sync.Once
+	keyring     *Keyring
+	keyringErr  error
+)
+
+// Keys returns the process wide keyring configured through config.Envs.
+func Keys() (*Keyring, error) {
+	keyringOnce.Do(func() {
+		keyring, keyringErr = ParseKeyring(config.Envs.JWTSigningKeys, config.Envs.JWTActiveKeyID, config.Envs.JWTSecret)
+	})
+
+	return keyring, keyringErr
+}
+
+func HandleJWKS(c echo.Context) error {
+	keys, err := Keys()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, keys.JWKS())
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	oldKey := NewHMACKey("old", []byte("old-secret"))
+	newKey := NewHMACKey("new", []byte("new-secret"))
+
+	before, err := NewKeyring("old", oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := CreateJWT(before, uuid.New(), uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After rotation tokens signed with the old key must still verify
+	after, err := NewKeyring("new", oldKey, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseJWT(after, token); err != nil {
+		t.Errorf("expected token signed with old key to verify: %v", err)
+	}
+
+	// Once the old key is dropped its tokens are rejected
+	retired, err := NewKeyring("new", newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseJWT(retired, token); err == nil {
+		t.Error("expected token signed with retired key to be rejected")
+	}
+}
+
+func TestKeyringEd25519AndJWKS(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := NewEd25519Key("ed", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := NewKeyring("ed", key, NewHMACKey("hmac", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := CreateJWT(keys, uuid.New(), uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseJWT(keys, token); err != nil {
+		t.Errorf("expected EdDSA token to verify: %v", err)
+	}
+
+	set := keys.JWKS()
+	if len(set.Keys) != 1 {
+		t.Fatalf("expected only the public key to be published, got %d keys", len(set.Keys))
+	}
+
+	if set.Keys[0].Kid != "ed" || set.Keys[0].Kty != "OKP" {
+		t.Errorf("unexpected jwk %+v", set.Keys[0])
+	}
+}
+
+func TestParseKeyringFallback(t *testing.T) {
+	keys, err := ParseKeyring("", "", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CreateJWT(keys, uuid.New(), uuid.New()); err != nil {
+		t.Errorf("expected fallback keyring to sign tokens: %v", err)
+	}
+
+	if _, err := ParseKeyring("broken", "", "secret"); err == nil {
+		t.Error("expected malformed key spec to be rejected")
+	}
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+// NewOpaqueToken returns a random opaque token along with the hash that should
+// be persisted. The raw token is only ever handed to the client. It backs
+// refresh tokens and one-time tokens such as password resets.
+func NewOpaqueToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	return token, HashOpaqueToken(token), nil
+}
+
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func RefreshTokenExpiry() time.Time {
+	return time.Now().Add(time.Second * time.Duration(config.Envs.RefreshTokenExpirationInSeconds))
+}
+
+// NewSession creates a session for the user and returns it together with the
+// raw refresh token.
+func NewSession(userID uuid.UUID, userAgent, ipAddress string) (types.Session, string, error) {
+	token, hash, err := NewOpaqueToken()
+	if err != nil {
+		return types.Session{}, "", err
+	}
+
+	session := types.Session{
+		ID:               uuid.New(),
+		UserID:           userID,
+		RefreshTokenHash: hash,
+		UserAgent:        userAgent,
+		IPAddress:        ipAddress,
+		ExpiresAt:        RefreshTokenExpiry(),
+	}
+
+	return session, token, nil
+}
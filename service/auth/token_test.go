@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNewOpaqueToken(t *testing.T) {
+	token, hash, err := NewOpaqueToken()
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+
+	if token == "" || hash == "" {
+		t.Fatal("expected token and hash to be not empty")
+	}
+
+	if token == hash {
+		t.Error("expected hash to be different from token")
+	}
+
+	if HashOpaqueToken(token) != hash {
+		t.Error("expected hashing the token to match the returned hash")
+	}
+
+	other, _, err := NewOpaqueToken()
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+
+	if other == token {
+		t.Error("expected tokens to be unique")
+	}
+}
+
+func TestNewSession(t *testing.T) {
+	userID := uuid.New()
+
+	session, token, err := NewSession(userID, "test-agent", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("error creating session: %v", err)
+	}
+
+	if session.UserID != userID {
+		t.Errorf("expected session user %s, got %s", userID, session.UserID)
+	}
+
+	if session.RefreshTokenHash != HashOpaqueToken(token) {
+		t.Error("expected session to store the refresh token hash")
+	}
+
+	if !session.Active() {
+		t.Error("expected new session to be active")
+	}
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B SHA1 test vectors, truncated to six digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, expected := range tests {
+		code, err := TOTPCode(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("error generating code: %v", err)
+		}
+
+		if code != expected {
+			t.Errorf("at %d expected %s, got %s", unix, expected, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ValidateTOTP(secret, code, now) {
+		t.Error("expected current code to be valid")
+	}
+
+	if !ValidateTOTP(secret, code, now.Add(totpPeriod*time.Second)) {
+		t.Error("expected code from the previous period to be valid")
+	}
+
+	if ValidateTOTP(secret, code, now.Add(5*totpPeriod*time.Second)) {
+		t.Error("expected stale code to be rejected")
+	}
+
+	step, ok := MatchTOTP(secret, code, now.Add(totpPeriod*time.Second))
+	if !ok || step != now.Unix()/totpPeriod {
+		t.Errorf("expected code to match step %d, got %d", now.Unix()/totpPeriod, step)
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("expected %d codes, got %d", recoveryCodeCount, len(codes))
+	}
+
+	if HashRecoveryCode(strings.ToUpper(codes[0])) != hashes[0] {
+		t.Error("expected recovery code hashing to ignore case")
+	}
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/google/uuid"
+)
+
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposeEmailChange       = "email_change"
+)
+
+// CreateEmailVerificationToken signs a token binding the user to the address
+// being verified. Changing the email invalidates links sent to the old one.
+func CreateEmailVerificationToken(keys *Keyring, userID uuid.UUID, email string) (string, error) {
+	ttl := time.Second * time.Duration(config.Envs.EmailVerificationExpirationInSeconds)
+
+	return createPurposeJWT(keys, PurposeEmailVerification, userID, email, ttl)
+}
+
+func ParseEmailVerificationToken(keys *Keyring, token string) (uuid.UUID, string, error) {
+	claims, err := parsePurposeJWT(keys, PurposeEmailVerification, token)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	return userID, claims.Email, nil
+}
+
+// CreateEmailChangeToken signs the link sent to a new address. It is kept
+// separate from verification tokens so a verification link can never be used
+// to confirm an email change.
+func CreateEmailChangeToken(keys *Keyring, userID uuid.UUID, newEmail string) (string, error) {
+	ttl := time.Second * time.Duration(config.Envs.EmailVerificationExpirationInSeconds)
+
+	return createPurposeJWT(keys, PurposeEmailChange, userID, newEmail, ttl)
+}
+
+func ParseEmailChangeToken(keys *Keyring, token string) (uuid.UUID, string, error) {
+	claims, err := parsePurposeJWT(keys, PurposeEmailChange, token)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	return userID, claims.Email, nil
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestEmailVerificationToken(t *testing.T) {
+	keys, err := NewKeyring("test", NewHMACKey("test", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uuid.New()
+
+	token, err := CreateEmailVerificationToken(keys, userID, "foo@email.com")
+	if err != nil {
+		t.Fatalf("error creating verification token: %v", err)
+	}
+
+	gotID, gotEmail, err := ParseEmailVerificationToken(keys, token)
+	if err != nil {
+		t.Fatalf("error parsing verification token: %v", err)
+	}
+
+	if gotID != userID || gotEmail != "foo@email.com" {
+		t.Errorf("expected %s/%s, got %s/%s", userID, "foo@email.com", gotID, gotEmail)
+	}
+
+	// An access token must not be accepted as a verification token
+	access, err := CreateJWT(keys, userID, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := ParseEmailVerificationToken(keys, access); err == nil {
+		t.Error("expected access token to be rejected")
+	}
+}
+
+func TestEmailChangeToken(t *testing.T) {
+	keys, err := NewKeyring("test", NewHMACKey("test", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uuid.New()
+
+	verification, err := CreateEmailVerificationToken(keys, userID, "new@email.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A verification link must not be able to confirm an email change
+	if _, _, err := ParseEmailChangeToken(keys, verification); err == nil {
+		t.Error("expected verification token to be rejected")
+	}
+
+	change, err := CreateEmailChangeToken(keys, userID, "new@email.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotID, gotEmail, err := ParseEmailChangeToken(keys, change)
+	if err != nil {
+		t.Fatalf("error parsing email change token: %v", err)
+	}
+
+	if gotID != userID || gotEmail != "new@email.com" {
+		t.Errorf("expected %s/%s, got %s/%s", userID, "new@email.com", gotID, gotEmail)
+	}
+}
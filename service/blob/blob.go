@@ -0,0 +1,59 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/ZondaF12/logbook-backend/types"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// privatePrefixes hold keys that are only ever handed out as signed URLs.
+var privatePrefixes = []string{"exports/"}
+
+func isPrivate(key string) bool {
+	for _, prefix := range privatePrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// New returns the blob store configured through config.Envs.
+func New(ctx context.Context) (types.BlobStore, error) {
+	switch config.Envs.BlobStore {
+	case "s3":
+		return NewS3Store(ctx, config.Envs.BlobBucket, config.Envs.BlobPrefix, config.Envs.BlobEndpoint)
+	case "local":
+		return NewLocalStore(config.Envs.BlobLocalDir, config.Envs.BlobPrefix, config.Envs.BlobBaseURL, []byte(config.Envs.BlobSigningSecret))
+	}
+
+	return nil, fmt.Errorf("unknown blob store %s", config.Envs.BlobStore)
+}
+
+// joinPrefix puts the configured prefix in front of a key. Keys can't climb
+// out of the prefix.
+func joinPrefix(prefix, key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." || part == "." {
+			return "", fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+
+	if prefix == "" {
+		return key, nil
+	}
+
+	return path.Join(prefix, key), nil
+}
@@ -0,0 +1,389 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/labstack/echo/v4"
+)
+
+// inlineTypes are the content types served for display. Anything else, such
+// as a page uploaded in place of an image that hasn't been confirmed yet, is
+// only offered as a download.
+var inlineTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+// LocalStore keeps blobs on the local filesystem so uploads work without
+// AWS. Files are served by HandleServe from baseURL. Like a public-read
+// bucket anyone with a location can read the file, signed URLs add an expiry
+// and a download filename. Private keys such as exports need a signed URL.
+type LocalStore struct {
+	dir     string
+	prefix  string
+	baseURL string
+	secret  []byte
+}
+
+func NewLocalStore(dir, prefix, baseURL string, secret []byte) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{
+		dir:     dir,
+		prefix:  strings.Trim(prefix, "/"),
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  secret,
+	}, nil
+}
+
+func (s *LocalStore) path(key string) (string, string, error) {
+	objectKey, err := joinPrefix(s.prefix, key)
+	if err != nil {
+		return "", "", err
+	}
+
+	return objectKey, filepath.Join(s.dir, filepath.FromSlash(objectKey)), nil
+}
+
+// Put writes to a temporary file first so readers never see a partial file.
+func (s *LocalStore) Put(ctx context.Context, key, contentType string, body io.Reader, size int64) (string, error) {
+	objectKey, name, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return "", err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(f.Name(), name); err != nil {
+		return "", err
+	}
+
+	return s.baseURL + "/" + objectKey, nil
+}
+
+func (s *LocalStore) Location(key string) string {
+	objectKey, err := joinPrefix(s.prefix, key)
+	if err != nil {
+		return ""
+	}
+
+	return s.baseURL + "/" + objectKey
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	_, name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return f, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, keys []string, prefixes []string) error {
+	for _, key := range keys {
+		_, name, err := s.path(key)
+		if err != nil {
+			continue
+		}
+
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	for _, prefix := range prefixes {
+		objectPrefix, _, err := s.path(prefix)
+		if err != nil {
+			return err
+		}
+
+		// path.Join drops a trailing slash when the store has a prefix
+		if strings.HasSuffix(prefix, "/") {
+			objectPrefix = strings.TrimSuffix(objectPrefix, "/") + "/"
+		}
+
+		// Only the directory holding the prefix can contain matching objects
+		root := filepath.Join(s.dir, filepath.FromSlash(path.Dir(objectPrefix)))
+		err = filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			rel, err := filepath.Rel(s.dir, name)
+			if err != nil {
+				return err
+			}
+
+			if strings.HasPrefix(filepath.ToSlash(rel), objectPrefix) {
+				return os.Remove(name)
+			}
+
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (*types.BlobInfo, error) {
+	_, name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	contentType, err := detectContentType(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.BlobInfo{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: contentType,
+		ModifiedAt:  info.ModTime(),
+	}, nil
+}
+
+// detectContentType goes by the extension and falls back to sniffing, there
+// is nowhere to keep the type given to Put.
+func detectContentType(name string) (string, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		return contentType, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return http.DetectContentType(buf[:n]), nil
+}
+
+func (s *LocalStore) SignedURL(ctx context.Context, key, filename string, expires time.Duration) (string, error) {
+	objectKey, _, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expiresAt)
+	query.Set("filename", filename)
+	query.Set("signature", s.sign(http.MethodGet, objectKey, expiresAt, filename))
+
+	return s.baseURL + "/" + objectKey + "?" + query.Encode(), nil
+}
+
+func (s *LocalStore) SignedUploadURL(ctx context.Context, key, contentType string, size int64, expires time.Duration) (string, error) {
+	objectKey, _, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	sizeParam := strconv.FormatInt(size, 10)
+
+	query := url.Values{}
+	query.Set("expires", expiresAt)
+	query.Set("content_type", contentType)
+	query.Set("size", sizeParam)
+	query.Set("signature", s.sign(http.MethodPut, objectKey, expiresAt, contentType, sizeParam))
+
+	return s.baseURL + "/" + objectKey + "?" + query.Encode(), nil
+}
+
+// sign covers the method so a download link can't be used to upload.
+func (s *LocalStore) sign(method, objectKey, expiresAt string, params ...string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s", method, objectKey, expiresAt)
+	for _, param := range params {
+		fmt.Fprintf(mac, "\n%s", param)
+	}
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks a signed URL's signature and expiry.
+func (s *LocalStore) verify(c echo.Context, objectKey string, params ...string) error {
+	expiresAt := c.QueryParam("expires")
+
+	expected := s.sign(c.Request().Method, objectKey, expiresAt, params...)
+	if !hmac.Equal([]byte(c.QueryParam("signature")), []byte(expected)) {
+		return echo.NewHTTPError(http.StatusForbidden, "Invalid signature")
+	}
+
+	unix, err := strconv.ParseInt(expiresAt, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return echo.NewHTTPError(http.StatusForbidden, "Link expired")
+	}
+
+	return nil
+}
+
+func (s *LocalStore) KeyFromLocation(location string) string {
+	if !strings.HasPrefix(location, s.baseURL+"/") {
+		return ""
+	}
+
+	key := strings.TrimPrefix(location, s.baseURL+"/")
+	if i := strings.IndexByte(key, '?'); i >= 0 {
+		key = key[:i]
+	}
+
+	if s.prefix != "" {
+		key = strings.TrimPrefix(key, s.prefix+"/")
+	}
+
+	return key
+}
+
+// HandleServe serves files from the store. Signed URLs are checked for
+// tampering and expiry, and private files are only served through them.
+func (s *LocalStore) HandleServe(c echo.Context) error {
+	objectKey := path.Clean(c.Param("*"))
+
+	key, ok := s.keyFromObjectKey(objectKey)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "File not found")
+	}
+
+	if c.QueryParam("signature") != "" {
+		filename := c.QueryParam("filename")
+		if err := s.verify(c, objectKey, filename); err != nil {
+			return err
+		}
+
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	} else if isPrivate(key) {
+		return echo.NewHTTPError(http.StatusForbidden, "Missing signature")
+	}
+
+	_, name, err := s.path(key)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "File not found")
+	}
+
+	if _, err := os.Stat(name); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "File not found")
+	}
+
+	contentType, err := detectContentType(name)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	// Private files are already downloads with their own filename
+	header := c.Response().Header()
+	header.Set("X-Content-Type-Options", "nosniff")
+	if contentType, _, _ = strings.Cut(contentType, ";"); !inlineTypes[contentType] && !isPrivate(key) {
+		contentType = "application/octet-stream"
+		header.Set(echo.HeaderContentDisposition, "attachment")
+	}
+	header.Set(echo.HeaderContentType, contentType)
+
+	return c.File(name)
+}
+
+// HandleUpload accepts uploads to signed upload URLs. The body has to match
+// the size and type the URL was signed for.
+func (s *LocalStore) HandleUpload(c echo.Context) error {
+	objectKey := path.Clean(c.Param("*"))
+	contentType := c.QueryParam("content_type")
+	sizeParam := c.QueryParam("size")
+
+	if err := s.verify(c, objectKey, contentType, sizeParam); err != nil {
+		return err
+	}
+
+	size, err := strconv.ParseInt(sizeParam, 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid size")
+	}
+
+	req := c.Request()
+	if req.ContentLength != size || req.Header.Get(echo.HeaderContentType) != contentType {
+		return echo.NewHTTPError(http.StatusBadRequest, "Upload does not match the signed size and type")
+	}
+
+	key, ok := s.keyFromObjectKey(objectKey)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "File not found")
+	}
+
+	if _, err := s.Put(req.Context(), key, contentType, io.LimitReader(req.Body, size), size); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (s *LocalStore) keyFromObjectKey(objectKey string) (string, bool) {
+	if s.prefix == "" {
+		return objectKey, true
+	}
+
+	key, ok := strings.CutPrefix(objectKey, s.prefix+"/")
+	return key, ok
+}
@@ -0,0 +1,288 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func newTestLocalStore(t *testing.T) *LocalStore {
+	t.Helper()
+
+	store, err := NewLocalStore(t.TempDir(), "dev", "http://localhost:8080/blobs", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestLocalStore(t)
+
+	t.Run("should store and read back a file", func(t *testing.T) {
+		location, err := store.Put(ctx, "vehicles/1/images/car.png", "image/png", strings.NewReader("png data"), 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if location != "http://localhost:8080/blobs/dev/vehicles/1/images/car.png" {
+			t.Errorf("unexpected location %s", location)
+		}
+
+		key := store.KeyFromLocation(location)
+		if key != "vehicles/1/images/car.png" {
+			t.Errorf("unexpected key %s", key)
+		}
+
+		r, err := store.Get(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		if data, _ := io.ReadAll(r); string(data) != "png data" {
+			t.Errorf("unexpected contents %q", data)
+		}
+
+		info, err := store.Stat(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Size != 8 || info.ContentType != "image/png" {
+			t.Errorf("unexpected info %+v", info)
+		}
+	})
+
+	t.Run("should report missing files", func(t *testing.T) {
+		if _, err := store.Stat(ctx, "nope.png"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("should not let keys escape the directory", func(t *testing.T) {
+		if _, err := store.Put(ctx, "../escape.txt", "text/plain", strings.NewReader("x"), 1); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("should delete keys and prefixes", func(t *testing.T) {
+		for _, key := range []string{"logbook/1/a.jpg", "logbook/1/b.jpg", "logbook/10/c.jpg", "avatars/me.jpg"} {
+			if _, err := store.Put(ctx, key, "image/jpeg", strings.NewReader("x"), 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := store.Delete(ctx, []string{"avatars/me.jpg", "missing.jpg"}, []string{"logbook/1/"}); err != nil {
+			t.Fatal(err)
+		}
+
+		for key, exists := range map[string]bool{"logbook/1/a.jpg": false, "logbook/1/b.jpg": false, "logbook/10/c.jpg": true, "avatars/me.jpg": false} {
+			if _, err := store.Stat(ctx, key); (err == nil) != exists {
+				t.Errorf("expected %s to exist: %v", key, exists)
+			}
+		}
+	})
+
+	t.Run("should delete prefixes without a store prefix", func(t *testing.T) {
+		store, err := NewLocalStore(t.TempDir(), "", "http://localhost:8080/blobs", []byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.Put(ctx, "logbook/1/a.jpg", "image/jpeg", strings.NewReader("x"), 1); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.Delete(ctx, nil, []string{"logbook/1/"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.Stat(ctx, "logbook/1/a.jpg"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected logbook/1/a.jpg to be deleted, got %v", err)
+		}
+
+		// Nothing was ever stored under this prefix
+		if err := store.Delete(ctx, nil, []string{"exports/9/"}); err != nil {
+			t.Errorf("expected a missing prefix to be ignored, got %v", err)
+		}
+	})
+}
+
+func TestLocalStoreSignedURL(t *testing.T) {
+	ctx := context.Background()
+	store := newTestLocalStore(t)
+
+	if _, err := store.Put(ctx, "exports/1.zip", "application/zip", strings.NewReader("zip"), 3); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, strings.TrimPrefix(target, "http://localhost:8080"), nil)
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.GET("/blobs/*", store.HandleServe)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should download with a valid link", func(t *testing.T) {
+		signed, err := store.SignedURL(ctx, "exports/1.zip", "export.zip", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := serve(signed)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if cd := rr.Header().Get(echo.HeaderContentDisposition); cd != `attachment; filename="export.zip"` {
+			t.Errorf("unexpected content disposition %q", cd)
+		}
+	})
+
+	t.Run("should reject a tampered link", func(t *testing.T) {
+		signed, _ := store.SignedURL(ctx, "exports/1.zip", "export.zip", time.Minute)
+
+		rr := serve(strings.Replace(signed, "export.zip", "other.zip", 1))
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should reject an expired link", func(t *testing.T) {
+		signed, _ := store.SignedURL(ctx, "exports/1.zip", "export.zip", -time.Minute)
+
+		rr := serve(signed)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should not serve private files without a signature", func(t *testing.T) {
+		signed, _ := store.SignedURL(ctx, "exports/1.zip", "export.zip", time.Minute)
+
+		rr := serve(strings.SplitN(signed, "?", 2)[0])
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should serve public files without a signature", func(t *testing.T) {
+		if _, err := store.Put(ctx, "avatars/me.jpg", "image/jpeg", strings.NewReader("jpg"), 3); err != nil {
+			t.Fatal(err)
+		}
+
+		rr := serve(store.Location("avatars/me.jpg"))
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if ct := rr.Header().Get(echo.HeaderContentType); ct != "image/jpeg" {
+			t.Errorf("unexpected content type %q", ct)
+		}
+	})
+
+	t.Run("should only offer other content as a download", func(t *testing.T) {
+		page := "<html><script>alert(1)</script></html>"
+		if _, err := store.Put(ctx, "avatars/user/1/original", "image/png", strings.NewReader(page), int64(len(page))); err != nil {
+			t.Fatal(err)
+		}
+
+		rr := serve(store.Location("avatars/user/1/original"))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		header := rr.Header()
+		if header.Get(echo.HeaderContentType) != "application/octet-stream" || header.Get(echo.HeaderContentDisposition) != "attachment" {
+			t.Errorf("expected a download, got %q and %q", header.Get(echo.HeaderContentType), header.Get(echo.HeaderContentDisposition))
+		}
+
+		if header.Get("X-Content-Type-Options") != "nosniff" {
+			t.Error("expected sniffing to be disabled")
+		}
+	})
+}
+
+func TestS3KeyFromLocation(t *testing.T) {
+	store := &S3Store{bucket: "logbook-app", prefix: "prod"}
+
+	tests := map[string]string{
+		"https://logbook-app.s3.eu-west-2.amazonaws.com/prod/avatars/user/1/me.jpg":   "avatars/user/1/me.jpg",
+		"https://s3.eu-west-2.amazonaws.com/logbook-app/prod/vehicles/1/images/a.png": "vehicles/1/images/a.png",
+		"http://minio:9000/logbook-app/prod/logbook/1/media/b.png":                    "logbook/1/media/b.png",
+		"not a url": "",
+	}
+
+	for location, want := range tests {
+		if got := store.KeyFromLocation(location); got != want {
+			t.Errorf("KeyFromLocation(%q) = %q, want %q", location, got, want)
+		}
+	}
+}
+
+func TestLocalStoreHandleUpload(t *testing.T) {
+	ctx := context.Background()
+	store := newTestLocalStore(t)
+
+	upload := func(target, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, strings.TrimPrefix(target, "http://localhost:8080"), strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.PUT("/blobs/*", store.HandleUpload)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should store a matching upload", func(t *testing.T) {
+		signed, err := store.SignedUploadURL(ctx, "avatars/user/1/a", "image/png", 8, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := upload(signed, "image/png", "png data")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		info, err := store.Stat(ctx, "avatars/user/1/a")
+		if err != nil || info.Size != 8 {
+			t.Errorf("expected the upload to be stored, got %+v, %v", info, err)
+		}
+	})
+
+	t.Run("should reject a different size or type", func(t *testing.T) {
+		signed, _ := store.SignedUploadURL(ctx, "avatars/user/1/b", "image/png", 8, time.Minute)
+
+		if rr := upload(signed, "image/png", "too long data"); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if rr := upload(signed, "image/jpeg", "png data"); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should not accept a download link", func(t *testing.T) {
+		signed, _ := store.SignedURL(ctx, "avatars/user/1/a", "a.png", time.Minute)
+
+		if rr := upload(signed, "image/png", "png data"); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+}
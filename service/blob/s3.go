@@ -0,0 +1,264 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// s3DeleteBatchSize is the most keys DeleteObjects accepts in one call.
+const s3DeleteBatchSize = 1000
+
+// S3Store keeps blobs in an S3 bucket, or any S3 compatible service such as
+// MinIO when an endpoint is set.
+type S3Store struct {
+	client   *s3.Client
+	bucket   string
+	prefix   string
+	endpoint string
+	region   string
+}
+
+func NewS3Store(ctx context.Context, bucket, prefix, endpoint string) (*S3Store, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		// Self hosted services rarely support virtual hosted buckets
+		if endpoint != "" {
+			o.EndpointResolver = s3.EndpointResolverFromURL(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	return &S3Store{
+		client:   client,
+		bucket:   bucket,
+		prefix:   strings.Trim(prefix, "/"),
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		region:   cfg.Region,
+	}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key, contentType string, body io.Reader, size int64) (string, error) {
+	objectKey, err := joinPrefix(s.prefix, key)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := manager.NewUploader(s.client).Upload(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(objectKey),
+		Body:          body,
+		ContentLength: size,
+		ContentType:   aws.String(contentType),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return result.Location, nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	objectKey, err := joinPrefix(s.prefix, key)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return out.Body, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, keys []string, prefixes []string) error {
+	objectKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if objectKey, err := joinPrefix(s.prefix, key); err == nil {
+			objectKeys = append(objectKeys, objectKey)
+		}
+	}
+
+	for _, prefix := range prefixes {
+		objectPrefix, err := joinPrefix(s.prefix, prefix)
+		if err != nil {
+			return err
+		}
+
+		// path.Join drops the trailing slash that stops vehicles/1 matching
+		// vehicles/10
+		if strings.HasSuffix(prefix, "/") {
+			objectPrefix += "/"
+		}
+
+		paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(s.bucket),
+			Prefix: aws.String(objectPrefix),
+		})
+
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return err
+			}
+
+			for _, object := range page.Contents {
+				objectKeys = append(objectKeys, aws.ToString(object.Key))
+			}
+		}
+	}
+
+	for start := 0; start < len(objectKeys); start += s3DeleteBatchSize {
+		end := start + s3DeleteBatchSize
+		if end > len(objectKeys) {
+			end = len(objectKeys)
+		}
+
+		objects := make([]s3types.ObjectIdentifier, 0, end-start)
+		for _, key := range objectKeys[start:end] {
+			objects = append(objects, s3types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		out, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.bucket),
+			Delete: &s3types.Delete{Objects: objects, Quiet: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(out.Errors) > 0 {
+			return fmt.Errorf("error deleting %s: %s", aws.ToString(out.Errors[0].Key), aws.ToString(out.Errors[0].Message))
+		}
+	}
+
+	return nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (*types.BlobInfo, error) {
+	objectKey, err := joinPrefix(s.prefix, key)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &types.BlobInfo{
+		Key:         key,
+		Size:        out.ContentLength,
+		ContentType: aws.ToString(out.ContentType),
+		ModifiedAt:  aws.ToTime(out.LastModified),
+	}, nil
+}
+
+func (s *S3Store) SignedURL(ctx context.Context, key, filename string, expires time.Duration) (string, error) {
+	objectKey, err := joinPrefix(s.prefix, key)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := s3.NewPresignClient(s.client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     aws.String(s.bucket),
+		Key:                        aws.String(objectKey),
+		ResponseContentDisposition: aws.String(fmt.Sprintf("attachment; filename=%q", filename)),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", err
+	}
+
+	return req.URL, nil
+}
+
+func (s *S3Store) SignedUploadURL(ctx context.Context, key, contentType string, size int64, expires time.Duration) (string, error) {
+	objectKey, err := joinPrefix(s.prefix, key)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := s3.NewPresignClient(s.client).PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(objectKey),
+		ContentType:   aws.String(contentType),
+		ContentLength: size,
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", err
+	}
+
+	return req.URL, nil
+}
+
+// Location builds the same URLs the uploader returns, path style when an
+// endpoint is set.
+func (s *S3Store) Location(key string) string {
+	objectKey, err := joinPrefix(s.prefix, key)
+	if err != nil {
+		return ""
+	}
+
+	if s.endpoint != "" {
+		return s.endpoint + (&url.URL{Path: "/" + s.bucket + "/" + objectKey}).EscapedPath()
+	}
+
+	u := url.URL{
+		Scheme: "https",
+		Host:   fmt.Sprintf("%s.s3.%s.amazonaws.com", s.bucket, s.region),
+		Path:   "/" + objectKey,
+	}
+
+	return u.String()
+}
+
+// KeyFromLocation handles both virtual hosted and path style URLs.
+func (s *S3Store) KeyFromLocation(location string) string {
+	u, err := url.Parse(location)
+	if err != nil || u.Host == "" || u.Path == "" {
+		return ""
+	}
+
+	key := strings.TrimPrefix(u.Path, "/")
+	if !strings.HasPrefix(u.Host, s.bucket+".") {
+		key = strings.TrimPrefix(key, s.bucket+"/")
+	}
+
+	if s.prefix != "" {
+		key = strings.TrimPrefix(key, s.prefix+"/")
+	}
+
+	return key
+}
+
+func notFound(err error) error {
+	var noSuchKey *s3types.NoSuchKey
+	var notFound *s3types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return ErrNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,404 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+const readme = `This archive contains the personal data Logbook holds about your account.
+
+data.json holds everything in one document. The CSV files hold the same
+records as tables. Photos and other uploads are in the media folder, media.csv
+maps each record to its file.
+`
+
+// OpenFunc opens a stored media file from its location.
+type OpenFunc func(location string) (io.ReadCloser, error)
+
+// WriteArchive writes the data and its media files to w as a ZIP archive. A
+// media file that can't be read is left out and has an empty archive_path in
+// media.csv rather than failing the whole export.
+func WriteArchive(w io.Writer, data *types.PersonalData, open OpenFunc) error {
+	zw := zip.NewWriter(w)
+
+	if err := writeFile(zw, "README.txt", []byte(readme)); err != nil {
+		return err
+	}
+
+	paths := make(map[uuid.UUID]string)
+	for _, m := range data.Media {
+		if m.ID == nil || m.S3Location == nil {
+			continue
+		}
+
+		name := fmt.Sprintf("media/%s-%s", m.ID, safeFilename(deref(m.Filename)))
+		if err := copyMedia(zw, name, *m.S3Location, open); err != nil {
+			log.Printf("error adding %s to export: %v", *m.S3Location, err)
+			continue
+		}
+
+		paths[*m.ID] = name
+	}
+
+	body, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(zw, "data.json", body); err != nil {
+		return err
+	}
+
+	tables := []struct {
+		name   string
+		header []string
+		rows   [][]string
+	}{
+		{"account.csv", accountHeader, [][]string{accountRow(&data.Account)}},
+		{"profile.csv", profileHeader, profileRows(data.Profile)},
+		{"followers.csv", followerHeader, followerRows(data.Followers)},
+		{"following.csv", followerHeader, followerRows(data.Following)},
+		{"blocks.csv", relationHeader, relationRows(data.Blocks)},
+		{"mutes.csv", relationHeader, relationRows(data.Mutes)},
+		{"vehicles.csv", vehicleHeader, vehicleRows(data.Vehicles)},
+		{"logs.csv", logHeader, logRows(data.Logs)},
+		{"media.csv", mediaHeader, mediaRows(data.Media, paths)},
+		{"likes.csv", likeHeader, likeRows(data.Likes)},
+		{"comments.csv", commentHeader, commentRows(data.Comments)},
+		{"notifications.csv", notificationHeader, notificationRows(data.Notifications)},
+		{"sessions.csv", sessionHeader, sessionRows(data.Sessions)},
+		{"access_tokens.csv", accessTokenHeader, accessTokenRows(data.AccessTokens)},
+		{"security_events.csv", securityEventHeader, securityEventRows(data.SecurityEvents)},
+	}
+
+	for _, table := range tables {
+		if err := writeCSV(zw, table.name, table.header, table.rows); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeFile(zw *zip.Writer, name string, body []byte) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(body)
+	return err
+}
+
+func writeCSV(zw *zip.Writer, name string, header []string, rows [][]string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(f)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+
+	return cw.Error()
+}
+
+func copyMedia(zw *zip.Writer, name, location string, open OpenFunc) error {
+	body, err := open(location)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// Images are already compressed, storing them saves the CPU
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, body)
+	return err
+}
+
+// safeFilename keeps user supplied names from escaping the media folder.
+func safeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		return "file"
+	}
+
+	return name
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return formatTime(*t)
+}
+
+func formatUUIDPtr(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+
+	return id.String()
+}
+
+var accountHeader = []string{"id", "email", "created_at", "email_verified_at", "totp_enabled_at", "password_changed_at", "pending_email", "deletion_scheduled_at"}
+
+func accountRow(a *types.AccountData) []string {
+	return []string{
+		a.ID.String(),
+		a.Email,
+		formatTime(a.CreatedAt),
+		formatTimePtr(a.EmailVerifiedAt),
+		formatTimePtr(a.TOTPEnabledAt),
+		formatTimePtr(a.PasswordChangedAt),
+		deref(a.PendingEmail),
+		formatTimePtr(a.DeletionScheduledAt),
+	}
+}
+
+var profileHeader = []string{"id", "username", "name", "bio", "avatar", "public", "followers", "following"}
+
+func profileRows(p *types.Profile) [][]string {
+	if p == nil {
+		return nil
+	}
+
+	return [][]string{{
+		p.ID.String(),
+		p.Username,
+		p.Name,
+		p.Bio,
+		p.Avatar,
+		strconv.FormatBool(p.Public),
+		strconv.Itoa(p.Followers),
+		strconv.Itoa(p.Following),
+	}}
+}
+
+var followerHeader = []string{"id", "follower_id", "following_id", "created_at", "status"}
+
+func followerRows(followers []*types.Follower) [][]string {
+	rows := make([][]string, 0, len(followers))
+	for _, f := range followers {
+		rows = append(rows, []string{f.ID.String(), f.FollowerID.String(), f.FollowingID.String(), formatTime(f.CreatedAt), f.Status})
+	}
+
+	return rows
+}
+
+var relationHeader = []string{"user_id", "created_at"}
+
+func relationRows(relations []*types.UserRelation) [][]string {
+	rows := make([][]string, 0, len(relations))
+	for _, r := range relations {
+		rows = append(rows, []string{r.UserID.String(), formatTime(r.CreatedAt)})
+	}
+
+	return rows
+}
+
+var vehicleHeader = []string{"id", "registration", "make", "model", "year", "engine_size", "color", "registered", "tax_date", "mot_date", "insurance_date", "service_date", "description", "mileage", "nickname", "created_at"}
+
+func vehicleRows(vehicles []*types.Vehicle) [][]string {
+	rows := make([][]string, 0, len(vehicles))
+	for _, v := range vehicles {
+		rows = append(rows, []string{
+			v.ID.String(),
+			v.Registration,
+			v.Make,
+			v.Model,
+			strconv.Itoa(int(v.Year)),
+			strconv.Itoa(int(v.EngineSize)),
+			v.Color,
+			v.Registered,
+			v.TaxDate,
+			v.MotDate,
+			v.InsuranceDate,
+			v.ServiceDate,
+			v.Description,
+			strconv.FormatUint(uint64(v.Mileage), 10),
+			v.Nickname,
+			formatTime(v.CreatedAt),
+		})
+	}
+
+	return rows
+}
+
+var logHeader = []string{"id", "vehicle_id", "title", "category", "date", "description", "notes", "cost", "created_at"}
+
+func logRows(logs []*types.Log) [][]string {
+	rows := make([][]string, 0, len(logs))
+	for _, l := range logs {
+		rows = append(rows, []string{
+			l.ID.String(),
+			l.VehicleID.String(),
+			l.Title,
+			strconv.Itoa(l.Category),
+			l.Date,
+			l.Description,
+			l.Notes,
+			strconv.FormatFloat(float64(l.Cost), 'f', 2, 32),
+			formatTime(l.CreatedAt),
+		})
+	}
+
+	return rows
+}
+
+var likeHeader = []string{"log_id", "created_at"}
+
+func likeRows(likes []*types.LogLike) [][]string {
+	rows := make([][]string, 0, len(likes))
+	for _, l := range likes {
+		rows = append(rows, []string{l.LogID.String(), formatTime(l.CreatedAt)})
+	}
+
+	return rows
+}
+
+var commentHeader = []string{"id", "log_id", "parent_id", "body", "created_at", "edited_at"}
+
+func commentRows(comments []*types.Comment) [][]string {
+	rows := make([][]string, 0, len(comments))
+	for _, c := range comments {
+		rows = append(rows, []string{
+			c.ID.String(),
+			c.LogID.String(),
+			formatUUIDPtr(c.ParentID),
+			c.Body,
+			formatTime(c.CreatedAt),
+			formatTimePtr(c.EditedAt),
+		})
+	}
+
+	return rows
+}
+
+var notificationHeader = []string{"id", "type", "actor_id", "subject_id", "message", "created_at", "read_at"}
+
+func notificationRows(notifications []*types.Notification) [][]string {
+	rows := make([][]string, 0, len(notifications))
+	for _, n := range notifications {
+		rows = append(rows, []string{
+			n.ID.String(),
+			n.Type,
+			formatUUIDPtr(n.ActorID),
+			formatUUIDPtr(n.SubjectID),
+			n.Message,
+			formatTime(n.CreatedAt),
+			formatTimePtr(n.ReadAt),
+		})
+	}
+
+	return rows
+}
+
+var mediaHeader = []string{"id", "filename", "file_type", "uploaded_at", "vehicle_id", "log_id", "archive_path"}
+
+func mediaRows(media []*types.Media, paths map[uuid.UUID]string) [][]string {
+	rows := make([][]string, 0, len(media))
+	for _, m := range media {
+		var archivePath string
+		if m.ID != nil {
+			archivePath = paths[*m.ID]
+		}
+
+		rows = append(rows, []string{
+			formatUUIDPtr(m.ID),
+			deref(m.Filename),
+			deref(m.FileType),
+			formatTimePtr(m.UploadedAt),
+			formatUUIDPtr(m.VehicleID),
+			formatUUIDPtr(m.LogID),
+			archivePath,
+		})
+	}
+
+	return rows
+}
+
+var sessionHeader = []string{"id", "user_agent", "ip_address", "created_at", "last_used_at", "expires_at", "revoked_at"}
+
+func sessionRows(sessions []*types.Session) [][]string {
+	rows := make([][]string, 0, len(sessions))
+	for _, s := range sessions {
+		rows = append(rows, []string{
+			s.ID.String(),
+			s.UserAgent,
+			s.IPAddress,
+			formatTime(s.CreatedAt),
+			formatTime(s.LastUsedAt),
+			formatTime(s.ExpiresAt),
+			formatTimePtr(s.RevokedAt),
+		})
+	}
+
+	return rows
+}
+
+var accessTokenHeader = []string{"id", "name", "scopes", "created_at", "last_used_at", "expires_at", "revoked_at"}
+
+func accessTokenRows(tokens []*types.AccessToken) [][]string {
+	rows := make([][]string, 0, len(tokens))
+	for _, t := range tokens {
+		rows = append(rows, []string{
+			t.ID.String(),
+			t.Name,
+			strings.Join(t.Scopes, " "),
+			formatTime(t.CreatedAt),
+			formatTimePtr(t.LastUsedAt),
+			formatTimePtr(t.ExpiresAt),
+			formatTimePtr(t.RevokedAt),
+		})
+	}
+
+	return rows
+}
+
+var securityEventHeader = []string{"id", "type", "ip_address", "user_agent", "created_at"}
+
+func securityEventRows(events []*types.SecurityEvent) [][]string {
+	rows := make([][]string, 0, len(events))
+	for _, e := range events {
+		rows = append(rows, []string{e.ID.String(), e.Type, e.IPAddress, e.UserAgent, formatTime(e.CreatedAt)})
+	}
+
+	return rows
+}
@@ -0,0 +1,91 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+func TestWriteArchive(t *testing.T) {
+	storedID := uuid.New()
+	missingID := uuid.New()
+	stored := "https://logbook-app.s3.amazonaws.com/vehicles/photo.jpg"
+	missing := "https://logbook-app.s3.amazonaws.com/vehicles/gone.jpg"
+	storedName := "../../photo.jpg"
+	missingName := "gone.jpg"
+
+	data := &types.PersonalData{
+		Account: types.AccountData{ID: uuid.New(), Email: "me@example.com"},
+		Media: []*types.Media{
+			{ID: &storedID, Filename: &storedName, S3Location: &stored},
+			{ID: &missingID, Filename: &missingName, S3Location: &missing},
+		},
+	}
+
+	open := func(location string) (io.ReadCloser, error) {
+		if location == stored {
+			return io.NopCloser(strings.NewReader("jpeg bytes")), nil
+		}
+		return nil, fmt.Errorf("not found")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, data, open); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	for _, name := range []string{"README.txt", "data.json", "account.csv", "vehicles.csv", "logs.csv", "media.csv"} {
+		if files[name] == nil {
+			t.Errorf("expected %s in archive", name)
+		}
+	}
+
+	mediaPath := fmt.Sprintf("media/%s-photo.jpg", storedID)
+	if files[mediaPath] == nil {
+		t.Fatalf("expected %s in archive", mediaPath)
+	}
+
+	if files[fmt.Sprintf("media/%s-gone.jpg", missingID)] != nil {
+		t.Error("expected unreadable media to be left out")
+	}
+
+	f, err := files["media.csv"].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("expected header and 2 rows, got %d", len(rows))
+	}
+
+	if got := rows[1][len(rows[1])-1]; got != mediaPath {
+		t.Errorf("expected archive path %s, got %s", mediaPath, got)
+	}
+
+	if got := rows[2][len(rows[2])-1]; got != "" {
+		t.Errorf("expected empty archive path for missing media, got %s", got)
+	}
+}
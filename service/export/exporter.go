@@ -0,0 +1,183 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+const failedReason = "The export could not be created, please request a new one"
+
+// Exporter builds requested archives in the background and removes them again
+// once they expire.
+type Exporter struct {
+	store  types.ExportStore
+	mailer types.Mailer
+	blobs  types.BlobStore
+	wake   chan struct{}
+}
+
+func NewExporter(store types.ExportStore, mailer types.Mailer, blobs types.BlobStore) *Exporter {
+	return &Exporter{
+		store:  store,
+		mailer: mailer,
+		blobs:  blobs,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the exporter so a new request doesn't wait for the next tick.
+func (e *Exporter) Notify() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes exports every interval, or sooner when notified, until ctx
+// is cancelled.
+func (e *Exporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.ProcessPending(ctx); err != nil {
+			log.Printf("error processing exports: %v", err)
+		}
+
+		if err := e.RemoveExpired(ctx); err != nil {
+			log.Printf("error removing expired exports: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-e.wake:
+		}
+	}
+}
+
+func (e *Exporter) ProcessPending(ctx context.Context) error {
+	// An export left processing this long was being built by a worker that
+	// crashed or restarted, fail it so the user can request a new one
+	timeout := time.Second * time.Duration(config.Envs.DataExportTimeoutInSeconds)
+	if err := e.store.FailStaleExports(time.Now().Add(-timeout), failedReason); err != nil {
+		return err
+	}
+
+	exports, err := e.store.GetPendingExports()
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		// Another instance may have picked it up already
+		if err := e.store.ClaimExport(export.ID); err != nil {
+			continue
+		}
+
+		if err := e.build(ctx, export); err != nil {
+			log.Printf("error building export %s: %v", export.ID, err)
+
+			if err := e.store.FailExport(export.ID, failedReason); err != nil {
+				log.Printf("error marking export %s as failed: %v", export.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func ObjectKey(userId, exportId uuid.UUID) string {
+	return fmt.Sprintf("exports/%s/%s.zip", userId, exportId)
+}
+
+// build writes the archive to a temporary file first so its size is known
+// before the upload starts.
+func (e *Exporter) build(ctx context.Context, export *types.DataExport) error {
+	data, err := e.store.GetPersonalData(export.UserID)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp("", "logbook-export-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	err = WriteArchive(f, data, func(location string) (io.ReadCloser, error) {
+		return e.blobs.Get(ctx, e.blobs.KeyFromLocation(location))
+	})
+	if err != nil {
+		return err
+	}
+
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	key := ObjectKey(export.UserID, export.ID)
+	if _, err := e.blobs.Put(ctx, key, "application/zip", f, size); err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(time.Second * time.Duration(config.Envs.DataExportRetentionInSeconds))
+	if err := e.store.CompleteExport(export.ID, key, size, expiresAt); err != nil {
+		return err
+	}
+
+	err = e.mailer.Send(types.Email{
+		To:      data.Account.Email,
+		Subject: "Your Logbook data export is ready",
+		Body: fmt.Sprintf("The copy of your data you requested is ready to download from the app until %s.",
+			expiresAt.Format("2 January 2006")),
+	})
+	if err != nil {
+		log.Printf("error sending export ready email: %v", err)
+	}
+
+	return nil
+}
+
+func (e *Exporter) RemoveExpired(ctx context.Context) error {
+	exports, err := e.store.GetExpiredExports(time.Now())
+	if err != nil {
+		return err
+	}
+
+	if len(exports) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(exports))
+	for _, export := range exports {
+		keys = append(keys, export.ObjectKey)
+	}
+
+	if err := e.blobs.Delete(ctx, keys, nil); err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if err := e.store.ExpireExport(export.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package export
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	store     types.ExportStore
+	userStore types.UserStore
+	exporter  *Exporter
+	blobs     types.BlobStore
+}
+
+func NewHandler(store types.ExportStore, userStore types.UserStore, exporter *Exporter, blobs types.BlobStore) *Handler {
+	return &Handler{
+		store:     store,
+		userStore: userStore,
+		exporter:  exporter,
+		blobs:     blobs,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *echo.Group) {
+	router.POST("/self/export", auth.WithJWTAuth(h.HandleRequestExport, h.userStore))
+	router.GET("/self/export/:id", auth.WithJWTAuth(h.HandleGetExport, h.userStore))
+}
+
+func (h *Handler) HandleRequestExport(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	// Only one export can be in progress at a time
+	active, err := h.store.GetActiveUserExport(userId)
+	if err == nil {
+		return c.JSON(http.StatusConflict, active)
+	}
+
+	export := types.DataExport{
+		ID:        uuid.New(),
+		UserID:    userId,
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+	}
+
+	if err := h.store.CreateExport(export); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	h.exporter.Notify()
+
+	return c.JSON(http.StatusAccepted, export)
+}
+
+func (h *Handler) HandleGetExport(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid export ID")
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	export, err := h.store.GetExportByID(id)
+	if err != nil || export.UserID != userId {
+		return echo.NewHTTPError(http.StatusNotFound, "Export not found")
+	}
+
+	if export.Status == StatusReady && export.ExpiresAt != nil {
+		// The link never outlives the archive itself
+		ttl := time.Second * time.Duration(config.Envs.DataExportLinkExpirationInSeconds)
+		if remaining := time.Until(*export.ExpiresAt); remaining < ttl {
+			ttl = remaining
+		}
+
+		if ttl > 0 {
+			export.DownloadURL, err = h.blobs.SignedURL(c.Request().Context(), export.ObjectKey, "logbook-export.zip", ttl)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err)
+			}
+		}
+	}
+
+	return c.JSON(http.StatusOK, export)
+}
@@ -0,0 +1,411 @@
+package export
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusReady      = "ready"
+	StatusFailed     = "failed"
+	StatusExpired    = "expired"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) CreateExport(export types.DataExport) error {
+	_, err := s.db.Exec("INSERT INTO data_exports (id, user_id, status) VALUES (?, ?, ?)", export.ID, export.UserID, StatusPending)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func scanRowIntoExport(rows *sql.Rows) (*types.DataExport, error) {
+	export := new(types.DataExport)
+
+	err := rows.Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.ObjectKey,
+		&export.Size,
+		&export.Error,
+		&export.ExpiresAt,
+		&export.CreatedAt,
+		&export.CompletedAt,
+		&export.ClaimedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (s *Store) getExport(query string, args ...interface{}) (*types.DataExport, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	export := new(types.DataExport)
+	for rows.Next() {
+		export, err = scanRowIntoExport(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if export.ID == uuid.Nil {
+		return nil, fmt.Errorf("export not found")
+	}
+
+	return export, nil
+}
+
+func (s *Store) getExports(query string, args ...interface{}) ([]*types.DataExport, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := make([]*types.DataExport, 0)
+	for rows.Next() {
+		export, err := scanRowIntoExport(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		exports = append(exports, export)
+	}
+
+	return exports, nil
+}
+
+func (s *Store) GetExportByID(id uuid.UUID) (*types.DataExport, error) {
+	return s.getExport("SELECT * FROM data_exports WHERE id = ?", id)
+}
+
+func (s *Store) GetActiveUserExport(userId uuid.UUID) (*types.DataExport, error) {
+	return s.getExport(`
+		SELECT * FROM data_exports
+		WHERE user_id = ? AND status IN (?, ?)
+		ORDER BY created_at DESC
+		LIMIT 1`, userId, StatusPending, StatusProcessing)
+}
+
+func (s *Store) GetPendingExports() ([]*types.DataExport, error) {
+	return s.getExports("SELECT * FROM data_exports WHERE status = ? ORDER BY created_at", StatusPending)
+}
+
+func (s *Store) ClaimExport(id uuid.UUID) error {
+	res, err := s.db.Exec("UPDATE data_exports SET status = ?, claimed_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?", StatusProcessing, id, StatusPending)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("export already claimed")
+	}
+
+	return nil
+}
+
+func (s *Store) FailStaleExports(claimedBefore time.Time, reason string) error {
+	_, err := s.db.Exec(`
+		UPDATE data_exports
+		SET status = ?, error = ?, completed_at = CURRENT_TIMESTAMP
+		WHERE status = ? AND claimed_at <= ?`,
+		StatusFailed, reason, StatusProcessing, claimedBefore)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) CompleteExport(id uuid.UUID, objectKey string, size int64, expiresAt time.Time) error {
+	_, err := s.db.Exec(`
+		UPDATE data_exports
+		SET status = ?, object_key = ?, size = ?, expires_at = ?, completed_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		StatusReady, objectKey, size, expiresAt, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) FailExport(id uuid.UUID, reason string) error {
+	_, err := s.db.Exec(`
+		UPDATE data_exports
+		SET status = ?, error = ?, completed_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		StatusFailed, reason, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) GetExpiredExports(before time.Time) ([]*types.DataExport, error) {
+	return s.getExports("SELECT * FROM data_exports WHERE status = ? AND expires_at <= ?", StatusReady, before)
+}
+
+func (s *Store) ExpireExport(id uuid.UUID) error {
+	_, err := s.db.Exec("UPDATE data_exports SET status = ?, object_key = '' WHERE id = ?", StatusExpired, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) GetPersonalData(userId uuid.UUID) (*types.PersonalData, error) {
+	data := &types.PersonalData{
+		Followers:      make([]*types.Follower, 0),
+		Following:      make([]*types.Follower, 0),
+		Blocks:         make([]*types.UserRelation, 0),
+		Mutes:          make([]*types.UserRelation, 0),
+		Vehicles:       make([]*types.Vehicle, 0),
+		Logs:           make([]*types.Log, 0),
+		Media:          make([]*types.Media, 0),
+		Likes:          make([]*types.LogLike, 0),
+		Comments:       make([]*types.Comment, 0),
+		Notifications:  make([]*types.Notification, 0),
+		Sessions:       make([]*types.Session, 0),
+		AccessTokens:   make([]*types.AccessToken, 0),
+		SecurityEvents: make([]*types.SecurityEvent, 0),
+	}
+
+	account := &data.Account
+	err := s.db.QueryRow(`
+		SELECT id, email, created_at, email_verified_at, totp_enabled_at, password_changed_at, pending_email, deletion_scheduled_at
+		FROM auth WHERE id = ?`, userId).Scan(
+		&account.ID,
+		&account.Email,
+		&account.CreatedAt,
+		&account.EmailVerifiedAt,
+		&account.TOTPEnabledAt,
+		&account.PasswordChangedAt,
+		&account.PendingEmail,
+		&account.DeletionScheduledAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each(`
+		SELECT
+			p.id, p.user_id, p.username, p.name, p.bio, p.avatar, p.public,
+			(SELECT COUNT(*) FROM followers f WHERE f.following_id = p.user_id AND f.status = 'accepted'),
+			(SELECT COUNT(*) FROM followers f WHERE f.follower_id = p.user_id AND f.status = 'accepted')
+		FROM profiles p
+		WHERE p.user_id = ?`, []interface{}{userId}, func(rows *sql.Rows) error {
+		p := new(types.Profile)
+		data.Profile = p
+		return rows.Scan(&p.ID, &p.UserID, &p.Username, &p.Name, &p.Bio, &p.Avatar, &p.Public, &p.Followers, &p.Following)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	scanFollower := func(list *[]*types.Follower) func(rows *sql.Rows) error {
+		return func(rows *sql.Rows) error {
+			f := new(types.Follower)
+			*list = append(*list, f)
+			return rows.Scan(&f.ID, &f.FollowerID, &f.FollowingID, &f.CreatedAt, &f.Status)
+		}
+	}
+
+	err = s.each("SELECT id, follower_id, following_id, created_at, status FROM followers WHERE following_id = ? ORDER BY created_at",
+		[]interface{}{userId}, scanFollower(&data.Followers))
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each("SELECT id, follower_id, following_id, created_at, status FROM followers WHERE follower_id = ? ORDER BY created_at",
+		[]interface{}{userId}, scanFollower(&data.Following))
+	if err != nil {
+		return nil, err
+	}
+
+	scanRelation := func(list *[]*types.UserRelation) func(rows *sql.Rows) error {
+		return func(rows *sql.Rows) error {
+			r := new(types.UserRelation)
+			*list = append(*list, r)
+			return rows.Scan(&r.UserID, &r.CreatedAt)
+		}
+	}
+
+	err = s.each("SELECT blocked_id, created_at FROM user_blocks WHERE blocker_id = ? ORDER BY created_at",
+		[]interface{}{userId}, scanRelation(&data.Blocks))
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each("SELECT muted_id, created_at FROM user_mutes WHERE muter_id = ? ORDER BY created_at",
+		[]interface{}{userId}, scanRelation(&data.Mutes))
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each(`
+		SELECT id, user_id, registration, make, model, year, engine_size, color, registered, tax_date, mot_date,
+			insurance_date, service_date, description, milage, nickname, created_at
+		FROM vehicles WHERE user_id = ? ORDER BY created_at`, []interface{}{userId}, func(rows *sql.Rows) error {
+		v := new(types.Vehicle)
+		data.Vehicles = append(data.Vehicles, v)
+		return rows.Scan(&v.ID, &v.UserID, &v.Registration, &v.Make, &v.Model, &v.Year, &v.EngineSize, &v.Color,
+			&v.Registered, &v.TaxDate, &v.MotDate, &v.InsuranceDate, &v.ServiceDate, &v.Description, &v.Mileage,
+			&v.Nickname, &v.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each(`
+		SELECT l.id, l.vehicle_id, l.category, l.title, l.date, l.description, l.notes, l.cost, l.created_at
+		FROM logs l JOIN vehicles v ON v.id = l.vehicle_id
+		WHERE v.user_id = ? ORDER BY l.created_at`, []interface{}{userId}, func(rows *sql.Rows) error {
+		l := new(types.Log)
+		data.Logs = append(data.Logs, l)
+		return rows.Scan(&l.ID, &l.VehicleID, &l.Category, &l.Title, &l.Date, &l.Description, &l.Notes, &l.Cost, &l.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each(`
+		SELECT m.id, m.filename, m.file_type, m.s3_location, m.uploaded_at, m.user_id, m.vehicle_id, m.log_id
+		FROM media m
+		LEFT JOIN vehicles v ON v.id = m.vehicle_id
+		LEFT JOIN logs l ON l.id = m.log_id
+		LEFT JOIN vehicles lv ON lv.id = l.vehicle_id
+		WHERE m.user_id = ? OR v.user_id = ? OR lv.user_id = ?
+		ORDER BY m.uploaded_at`, []interface{}{userId, userId, userId}, func(rows *sql.Rows) error {
+		m := new(types.Media)
+		data.Media = append(data.Media, m)
+		return rows.Scan(&m.ID, &m.Filename, &m.FileType, &m.S3Location, &m.UploadedAt, &m.UserID, &m.VehicleID, &m.LogID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each("SELECT log_id, user_id, created_at FROM log_likes WHERE user_id = ? ORDER BY created_at",
+		[]interface{}{userId}, func(rows *sql.Rows) error {
+			like := new(types.LogLike)
+			data.Likes = append(data.Likes, like)
+			return rows.Scan(&like.LogID, &like.UserID, &like.CreatedAt)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each(`
+		SELECT id, log_id, user_id, parent_id, body, created_at, edited_at
+		FROM log_comments WHERE user_id = ? ORDER BY created_at`, []interface{}{userId}, func(rows *sql.Rows) error {
+		comment := new(types.Comment)
+		data.Comments = append(data.Comments, comment)
+		return rows.Scan(&comment.ID, &comment.LogID, &comment.UserID, &comment.ParentID, &comment.Body,
+			&comment.CreatedAt, &comment.EditedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each(`
+		SELECT id, user_id, actor_id, type, subject_id, message, created_at, read_at
+		FROM notifications WHERE user_id = ? ORDER BY created_at`, []interface{}{userId}, func(rows *sql.Rows) error {
+		n := new(types.Notification)
+		data.Notifications = append(data.Notifications, n)
+		return rows.Scan(&n.ID, &n.UserID, &n.ActorID, &n.Type, &n.SubjectID, &n.Message, &n.CreatedAt, &n.ReadAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each(`
+		SELECT id, user_id, user_agent, ip_address, expires_at, revoked_at, created_at, last_used_at
+		FROM sessions WHERE user_id = ? ORDER BY created_at`, []interface{}{userId}, func(rows *sql.Rows) error {
+		session := new(types.Session)
+		data.Sessions = append(data.Sessions, session)
+		return rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress, &session.ExpiresAt,
+			&session.RevokedAt, &session.CreatedAt, &session.LastUsedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each(`
+		SELECT id, user_id, name, scopes, last_used_at, expires_at, revoked_at, created_at
+		FROM access_tokens WHERE user_id = ? ORDER BY created_at`, []interface{}{userId}, func(rows *sql.Rows) error {
+		token := new(types.AccessToken)
+		data.AccessTokens = append(data.AccessTokens, token)
+
+		var scopes string
+		err := rows.Scan(&token.ID, &token.UserID, &token.Name, &scopes, &token.LastUsedAt, &token.ExpiresAt,
+			&token.RevokedAt, &token.CreatedAt)
+		token.Scopes = strings.Fields(scopes)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each(`
+		SELECT id, user_id, event_type, ip_address, user_agent, created_at
+		FROM security_events WHERE user_id = ? ORDER BY created_at`, []interface{}{userId}, func(rows *sql.Rows) error {
+		event := new(types.SecurityEvent)
+		data.SecurityEvents = append(data.SecurityEvents, event)
+		return rows.Scan(&event.ID, &event.UserID, &event.Type, &event.IPAddress, &event.UserAgent, &event.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// each runs the query and calls scan for every row.
+func (s *Store) each(query string, args []interface{}, scan func(rows *sql.Rows) error) error {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
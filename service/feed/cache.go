@@ -0,0 +1,104 @@
+package feed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+// CachedStore keeps recently built feed pages in memory so users with large
+// follow graphs don't rebuild their feed on every refresh. Pages can be up to
+// ttl old.
+type CachedStore struct {
+	store      types.FeedStore
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+}
+
+type cacheKey struct {
+	userId uuid.UUID
+	after  types.Cursor
+	limit  int
+}
+
+type cacheEntry struct {
+	items     []*types.FeedItem
+	expiresAt time.Time
+}
+
+func NewCachedStore(store types.FeedStore, ttl time.Duration, maxEntries int) *CachedStore {
+	return &CachedStore{
+		store:      store,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[cacheKey]cacheEntry),
+	}
+}
+
+func (s *CachedStore) GetFeed(userId uuid.UUID, page types.PageRequest) ([]*types.FeedItem, error) {
+	key := cacheKey{userId: userId, limit: page.Limit}
+	if page.After != nil {
+		key.after = *page.After
+	}
+
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	s.mu.Unlock()
+
+	if ok && now.Before(entry.expiresAt) {
+		return entry.items, nil
+	}
+
+	items, err := s.store.GetFeed(userId, page)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries) >= s.maxEntries {
+		s.evict(now)
+	}
+	s.entries[key] = cacheEntry{items: items, expiresAt: now.Add(s.ttl)}
+
+	return items, nil
+}
+
+// evict drops expired pages, and everything if that doesn't free up room.
+// Callers hold the lock.
+func (s *CachedStore) evict(now time.Time) {
+	for key, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+
+	if len(s.entries) >= s.maxEntries {
+		s.entries = make(map[cacheKey]cacheEntry)
+	}
+}
+
+func (s *CachedStore) Forget(userIds ...uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.entries {
+		for _, userId := range userIds {
+			if key.userId == userId {
+				delete(s.entries, key)
+			}
+		}
+	}
+}
+
+func (s *CachedStore) GetAudience(userId uuid.UUID) ([]uuid.UUID, error) {
+	return s.store.GetAudience(userId)
+}
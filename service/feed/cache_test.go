@@ -0,0 +1,84 @@
+package feed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+func TestCachedStore(t *testing.T) {
+	store := &countingFeedStore{}
+	cached := NewCachedStore(store, time.Minute, 2)
+	userId := uuid.New()
+	page := types.PageRequest{Limit: 20}
+
+	for i := 0; i < 3; i++ {
+		if _, err := cached.GetFeed(userId, page); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if store.calls != 1 {
+		t.Errorf("expected the feed to be built once, got %d", store.calls)
+	}
+
+	// Other pages and users are cached separately
+	cached.GetFeed(userId, types.PageRequest{Limit: 20, After: &types.Cursor{CreatedAt: time.Now(), ID: uuid.New()}})
+	cached.GetFeed(uuid.New(), page)
+
+	if store.calls != 3 {
+		t.Errorf("expected 3 builds, got %d", store.calls)
+	}
+
+	if len(cached.entries) > 2 {
+		t.Errorf("expected at most 2 cached pages, got %d", len(cached.entries))
+	}
+}
+
+func TestCachedStoreForget(t *testing.T) {
+	store := &countingFeedStore{}
+	cached := NewCachedStore(store, time.Minute, 10)
+	userId := uuid.New()
+	otherId := uuid.New()
+	page := types.PageRequest{Limit: 20}
+
+	cached.GetFeed(userId, page)
+	cached.GetFeed(otherId, page)
+	cached.Forget(userId)
+	cached.GetFeed(userId, page)
+	cached.GetFeed(otherId, page)
+
+	if store.calls != 3 {
+		t.Errorf("expected only the forgotten feed to be rebuilt, got %d builds", store.calls)
+	}
+}
+
+func TestCachedStoreExpires(t *testing.T) {
+	store := &countingFeedStore{}
+	cached := NewCachedStore(store, -time.Second, 10)
+	userId := uuid.New()
+
+	cached.GetFeed(userId, types.PageRequest{Limit: 20})
+	cached.GetFeed(userId, types.PageRequest{Limit: 20})
+
+	if store.calls != 2 {
+		t.Errorf("expected expired pages to be rebuilt, got %d builds", store.calls)
+	}
+}
+
+type countingFeedStore struct {
+	calls int
+}
+
+func (s *countingFeedStore) GetFeed(userId uuid.UUID, page types.PageRequest) ([]*types.FeedItem, error) {
+	s.calls++
+	return []*types.FeedItem{{ID: uuid.New(), Type: types.FeedItemLog}}, nil
+}
+
+func (s *countingFeedStore) GetAudience(userId uuid.UUID) ([]uuid.UUID, error) {
+	return nil, nil
+}
+
+func (s *countingFeedStore) Forget(userIds ...uuid.UUID) {}
@@ -0,0 +1,48 @@
+package feed
+
+import (
+	"log"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+// Publisher pushes new vehicles, logs and vehicle images to the connected
+// clients of everyone who would see them in their feed.
+type Publisher struct {
+	store    types.FeedStore
+	profiles types.ProfileStore
+	hub      types.Hub
+}
+
+func NewPublisher(store types.FeedStore, profiles types.ProfileStore, hub types.Hub) *Publisher {
+	return &Publisher{
+		store:    store,
+		profiles: profiles,
+		hub:      hub,
+	}
+}
+
+func (p *Publisher) Publish(authorId uuid.UUID, item types.FeedItem) {
+	// Only public accounts show up in feeds
+	profile, err := p.profiles.GetProfileByUserId(authorId)
+	if err != nil || !profile.Public {
+		return
+	}
+
+	audience, err := p.store.GetAudience(authorId)
+	if err != nil {
+		log.Printf("error getting feed audience of user %s: %v", authorId, err)
+		return
+	}
+
+	item.User = profile.Summary()
+	if item.CreatedAt.IsZero() {
+		item.CreatedAt = time.Now()
+	}
+
+	for _, userId := range audience {
+		p.hub.Publish(userId, types.EventFeedItem, item)
+	}
+}
@@ -0,0 +1,45 @@
+package feed
+
+import (
+	"net/http"
+
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/ZondaF12/logbook-backend/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	store     types.FeedStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.FeedStore, userStore types.UserStore) *Handler {
+	return &Handler{
+		store:     store,
+		userStore: userStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *echo.Group) {
+	router.GET("/feed", auth.WithJWTAuth(h.HandleGetFeed, h.userStore, auth.RequireScope(auth.ScopeFollowersRead)))
+}
+
+func (h *Handler) HandleGetFeed(c echo.Context) error {
+	page, err := utils.ParsePage(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	items, err := h.store.GetFeed(userId, *page)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, utils.NewPage(items, page.Limit, func(item *types.FeedItem) types.Cursor {
+		return types.Cursor{CreatedAt: item.CreatedAt, ID: item.ID}
+	}))
+}
@@ -0,0 +1,177 @@
+package feed
+
+import (
+	"database/sql"
+
+	"github.com/ZondaF12/logbook-backend/service/media"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+// Store builds the feed on read by merging the followed accounts' vehicles,
+// logs and vehicle images in one query.
+type Store struct {
+	db    *sql.DB
+	blobs types.BlobStore
+}
+
+func NewStore(db *sql.DB, blobs types.BlobStore) *Store {
+	return &Store{
+		db:    db,
+		blobs: blobs,
+	}
+}
+
+// Forget does nothing, feeds are built on every read.
+func (s *Store) Forget(userIds ...uuid.UUID) {}
+
+// feedQuery only follows accepted follows of public accounts the user hasn't
+// muted. Blocks remove follows, so blocked accounts never show up here.
+const feedQuery = `
+	WITH followed AS (
+		SELECT f.following_id AS user_id
+		FROM followers f
+		JOIN profiles fp ON fp.user_id = f.following_id
+		WHERE f.follower_id = ?
+			AND f.status = ?
+			AND fp.public = TRUE
+			AND f.following_id NOT IN (SELECT muted_id FROM user_mutes WHERE muter_id = ?)
+	)
+	SELECT
+		feed.id,
+		feed.type,
+		feed.vehicle_id,
+		feed.make,
+		feed.model,
+		COALESCE(feed.nickname, ''),
+		feed.title,
+		feed.category,
+		feed.image_url,
+		feed.thumbnail_key,
+		feed.medium_key,
+		feed.full_key,
+		feed.created_at,
+		p.id,
+		p.user_id,
+		p.username,
+		p.name,
+		p.avatar,
+		p.public
+	FROM (
+		SELECT v.id, ? AS type, v.user_id, v.id AS vehicle_id, v.make, v.model, v.nickname,
+			'' AS title, 0 AS category, '' AS image_url,
+			NULL AS thumbnail_key, NULL AS medium_key, NULL AS full_key, v.created_at
+		FROM vehicles v
+		WHERE v.user_id IN (SELECT user_id FROM followed)
+		UNION ALL
+		SELECT l.id, ?, v.user_id, v.id, v.make, v.model, v.nickname,
+			l.title, l.category, '', NULL, NULL, NULL, l.created_at
+		FROM logs l
+		JOIN vehicles v ON v.id = l.vehicle_id
+		WHERE v.user_id IN (SELECT user_id FROM followed)
+		UNION ALL
+		SELECT m.id, ?, v.user_id, v.id, v.make, v.model, v.nickname,
+			'', 0, m.s3_location, m.thumbnail_key, m.medium_key, m.full_key, m.uploaded_at
+		FROM media m
+		JOIN vehicles v ON v.id = m.vehicle_id
+		WHERE v.user_id IN (SELECT user_id FROM followed)
+	) feed
+	JOIN profiles p ON p.user_id = feed.user_id
+`
+
+func (s *Store) GetFeed(userId uuid.UUID, page types.PageRequest) ([]*types.FeedItem, error) {
+	query := feedQuery
+	args := []interface{}{
+		userId, types.FollowStatusAccepted, userId,
+		types.FeedItemVehicle, types.FeedItemLog, types.FeedItemVehicleImage,
+	}
+
+	if page.After != nil {
+		query += " WHERE feed.created_at < ? OR (feed.created_at = ? AND feed.id < ?)"
+		args = append(args, page.After.CreatedAt, page.After.CreatedAt, page.After.ID)
+	}
+
+	query += " ORDER BY feed.created_at DESC, feed.id DESC LIMIT ?"
+	args = append(args, page.Limit+1)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*types.FeedItem, 0)
+	for rows.Next() {
+		item := &types.FeedItem{User: new(types.ProfileSummary)}
+		var thumbnail, medium, full sql.NullString
+
+		err := rows.Scan(
+			&item.ID,
+			&item.Type,
+			&item.VehicleID,
+			&item.Make,
+			&item.Model,
+			&item.Nickname,
+			&item.Title,
+			&item.Category,
+			&item.ImageURL,
+			&thumbnail,
+			&medium,
+			&full,
+			&item.CreatedAt,
+			&item.User.ID,
+			&item.User.UserID,
+			&item.User.Username,
+			&item.User.Name,
+			&item.User.Avatar,
+			&item.User.Public,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		// Show the same size of image as items pushed when they are posted
+		if item.Type == types.FeedItemVehicleImage {
+			var renditions *types.Renditions
+			if medium.Valid {
+				renditions = &types.Renditions{Thumbnail: thumbnail.String, Medium: medium.String, Full: full.String}
+			}
+
+			item.ImageURL = media.URLs(s.blobs, item.ImageURL, renditions).Preview()
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// GetAudience mirrors feedQuery from the other side, so a pushed item reaches
+// exactly the users whose feed would show it.
+func (s *Store) GetAudience(userId uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := s.db.Query(`
+		SELECT f.follower_id
+		FROM followers f
+		JOIN profiles p ON p.user_id = f.following_id
+		WHERE f.following_id = ?
+			AND f.status = ?
+			AND p.public = TRUE
+			AND f.follower_id NOT IN (SELECT muter_id FROM user_mutes WHERE muted_id = ?)`,
+		userId, types.FollowStatusAccepted, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -1,31 +1,48 @@
 package follower
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/privacy"
 	"github.com/ZondaF12/logbook-backend/types"
 	"github.com/ZondaF12/logbook-backend/utils"
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
 type Handler struct {
-	store     types.FollowerStore
-	userStore types.UserStore
+	store        types.FollowerStore
+	userStore    types.UserStore
+	profileStore types.ProfileStore
+	policy       *privacy.Policy
+	notifier     types.Notifier
+	feeds        types.FeedCache
 }
 
-func NewHandler(store types.FollowerStore, userStore types.UserStore) *Handler {
+func NewHandler(store types.FollowerStore, userStore types.UserStore, profileStore types.ProfileStore, policy *privacy.Policy, notifier types.Notifier, feeds types.FeedCache) *Handler {
 	return &Handler{
-		store:     store,
-		userStore: userStore,
+		store:        store,
+		userStore:    userStore,
+		profileStore: profileStore,
+		policy:       policy,
+		notifier:     notifier,
+		feeds:        feeds,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *echo.Group) {
-	router.POST("/follow", auth.WithJWTAuth(h.HandleFollowUser, h.userStore))
-	router.POST("/unfollow", auth.WithJWTAuth(h.HandleUnfollowUser, h.userStore))
+	router.POST("/follow", auth.WithJWTAuth(h.HandleFollowUser, h.userStore, auth.RequireVerifiedEmail(), auth.RequireScope(auth.ScopeFollowersWrite)))
+	router.POST("/unfollow", auth.WithJWTAuth(h.HandleUnfollowUser, h.userStore, auth.RequireScope(auth.ScopeFollowersWrite)))
+	router.GET("/user/:id/followers", auth.WithJWTAuth(h.HandleGetFollowers, h.userStore, auth.RequireScope(auth.ScopeFollowersRead)))
+	router.GET("/user/:id/following", auth.WithJWTAuth(h.HandleGetFollowing, h.userStore, auth.RequireScope(auth.ScopeFollowersRead)))
+	router.GET("/follow/requests/incoming", auth.WithJWTAuth(h.HandleGetIncomingRequests, h.userStore, auth.RequireScope(auth.ScopeFollowersRead)))
+	router.GET("/follow/requests/outgoing", auth.WithJWTAuth(h.HandleGetOutgoingRequests, h.userStore, auth.RequireScope(auth.ScopeFollowersRead)))
+	router.POST("/follow/requests/:id/approve", auth.WithJWTAuth(h.HandleApproveRequest, h.userStore, auth.RequireScope(auth.ScopeFollowersWrite)))
+	router.POST("/follow/requests/:id/reject", auth.WithJWTAuth(h.HandleRejectRequest, h.userStore, auth.RequireScope(auth.ScopeFollowersWrite)))
 }
 
 func (h *Handler) HandleFollowUser(c echo.Context) error {
@@ -48,23 +65,54 @@ func (h *Handler) HandleFollowUser(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Cannot follow yourself")
 	}
 
+	// Blocks work both ways
+	blocked, err := h.policy.Blocked(userId, payload.UserID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if blocked {
+		return echo.NewHTTPError(http.StatusForbidden, "Cannot follow this user")
+	}
+
 	// Check user isnt already following
 	f, err := h.store.GetFollower(userId, payload.UserID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err)
 	}
 
-	if f != nil {
+	if f != nil && f.Accepted() {
 		return echo.NewHTTPError(http.StatusBadRequest, "Already following user")
 	}
 
+	if f != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Follow request already sent")
+	}
+
+	// Private accounts have to approve their followers
+	status := types.FollowStatusAccepted
+	p, err := h.profileStore.GetProfileByUserId(payload.UserID)
+	if err != nil || !p.Public {
+		status = types.FollowStatusPending
+	}
+
 	// Follow user
-	err = h.store.FollowUser(userId, payload.UserID)
+	err = h.store.FollowUser(userId, payload.UserID, status)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	return c.String(http.StatusOK, fmt.Sprintf("Now following user %d", payload.UserID))
+	notificationType := types.NotificationFollow
+	if status == types.FollowStatusPending {
+		notificationType = types.NotificationFollowRequest
+	}
+	h.notifier.Notify(types.Notification{UserID: payload.UserID, ActorID: &userId, Type: notificationType})
+
+	if status == types.FollowStatusPending {
+		return c.String(http.StatusAccepted, fmt.Sprintf("Requested to follow user %s", payload.UserID))
+	}
+
+	return c.String(http.StatusOK, fmt.Sprintf("Now following user %s", payload.UserID))
 }
 
 func (h *Handler) HandleUnfollowUser(c echo.Context) error {
@@ -97,12 +145,117 @@ func (h *Handler) HandleUnfollowUser(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Not following user")
 	}
 
-	// Unfollow user
-	fmt.Println(userId, payload.UserID)
+	// Unfollow user, this also withdraws a pending request
 	err = h.store.UnfollowUser(userId, payload.UserID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
+	h.feeds.Forget(userId)
+
+	if !f.Accepted() {
+		return c.String(http.StatusOK, fmt.Sprintf("Cancelled follow request to user %s", payload.UserID))
+	}
+
+	return c.String(http.StatusOK, fmt.Sprintf("Unfollowed user %s", payload.UserID))
+}
+
+func (h *Handler) HandleGetFollowers(c echo.Context) error {
+	return h.handleFollowList(c, h.store.GetFollowers)
+}
+
+func (h *Handler) HandleGetFollowing(c echo.Context) error {
+	return h.handleFollowList(c, h.store.GetFollowing)
+}
+
+type followListFunc func(userId, viewerId uuid.UUID, page types.PageRequest) ([]*types.FollowListEntry, error)
+
+func (h *Handler) handleFollowList(c echo.Context, list followListFunc) error {
+	ownerId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	page, err := utils.ParsePage(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	// Private accounts only show their connections to followers
+	err = h.policy.CanViewContent(userId, ownerId)
+	if errors.Is(err, privacy.ErrNotVisible) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	entries, err := list(ownerId, userId, *page)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, utils.NewPage(entries, page.Limit, func(e *types.FollowListEntry) types.Cursor {
+		return types.Cursor{CreatedAt: e.FollowedAt, ID: e.FollowID}
+	}))
+}
+
+func (h *Handler) HandleGetIncomingRequests(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	requests, err := h.store.GetIncomingFollowRequests(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, requests)
+}
+
+func (h *Handler) HandleGetOutgoingRequests(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	requests, err := h.store.GetOutgoingFollowRequests(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, requests)
+}
+
+func (h *Handler) HandleApproveRequest(c echo.Context) error {
+	requestId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request ID")
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	// Only requests made to the user can be approved
+	if err := h.store.AcceptFollowRequest(requestId, userId); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Follow request approved")
+}
+
+func (h *Handler) HandleRejectRequest(c echo.Context) error {
+	requestId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request ID")
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	// Only requests made to the user can be rejected
+	if err := h.store.RejectFollowRequest(requestId, userId); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
 
-	return c.String(http.StatusOK, fmt.Sprintf("Unfollowed user %d", payload.UserID))
+	return c.JSON(http.StatusOK, "Follow request rejected")
 }
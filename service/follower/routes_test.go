@@ -0,0 +1,337 @@
+package follower
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/privacy"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestFollowUser(t *testing.T) {
+	userId := uuid.New()
+	publicId := uuid.New()
+	privateId := uuid.New()
+
+	store := &mockFollowerStore{}
+	profiles := &mockProfileStore{profiles: map[uuid.UUID]*types.Profile{
+		publicId:  {UserID: publicId, Public: true},
+		privateId: {UserID: privateId, Public: false},
+	}}
+	safety := &mockSafetyStore{}
+	notifier := &mockNotifier{}
+	feeds := &mockFeedCache{}
+	handler := NewHandler(store, nil, profiles, privacy.NewPolicy(profiles, store, safety), notifier, feeds)
+
+	follow := func(target uuid.UUID) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(types.FollowUserPayload{UserID: target})
+
+		req := httptest.NewRequest(http.MethodPost, "/follow", bytes.NewBuffer(marshalled))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userId))
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.POST("/follow", handler.HandleFollowUser)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should follow a public account straight away", func(t *testing.T) {
+		rr := follow(publicId)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if f, _ := store.GetFollower(userId, publicId); f == nil || !f.Accepted() {
+			t.Error("expected an accepted follow")
+		}
+
+		if n := notifier.last(); n == nil || n.UserID != publicId || n.Type != types.NotificationFollow {
+			t.Error("expected a follow notification")
+		}
+	})
+
+	t.Run("should request to follow a private account", func(t *testing.T) {
+		rr := follow(privateId)
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+		}
+
+		if f, _ := store.GetFollower(userId, privateId); f == nil || f.Status != types.FollowStatusPending {
+			t.Error("expected a pending follow request")
+		}
+
+		if n := notifier.last(); n == nil || n.UserID != privateId || n.Type != types.NotificationFollowRequest {
+			t.Error("expected a follow request notification")
+		}
+	})
+
+	t.Run("should drop the cached feed on unfollow", func(t *testing.T) {
+		marshalled, _ := json.Marshal(types.FollowUserPayload{UserID: publicId})
+
+		req := httptest.NewRequest(http.MethodPost, "/unfollow", bytes.NewBuffer(marshalled))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userId))
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.POST("/unfollow", handler.HandleUnfollowUser)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if len(feeds.forgotten) != 1 || feeds.forgotten[0] != userId {
+			t.Errorf("expected the caller's feed to be dropped, got %v", feeds.forgotten)
+		}
+	})
+
+	t.Run("should not send a second request", func(t *testing.T) {
+		rr := follow(privateId)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should not follow a user who blocked the caller", func(t *testing.T) {
+		blockerId := uuid.New()
+		profiles.profiles[blockerId] = &types.Profile{UserID: blockerId, Public: true}
+		safety.BlockUser(blockerId, userId)
+
+		rr := follow(blockerId)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+}
+
+type mockFollowerStore struct {
+	follows []*types.Follower
+}
+
+func (m *mockFollowerStore) FollowUser(followerId, followingId uuid.UUID, status string) error {
+	m.follows = append(m.follows, &types.Follower{ID: uuid.New(), FollowerID: followerId, FollowingID: followingId, Status: status})
+	return nil
+}
+
+func (m *mockFollowerStore) UnfollowUser(followerId, followingId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockFollowerStore) GetFollower(followerId, followingId uuid.UUID) (*types.Follower, error) {
+	for _, f := range m.follows {
+		if f.FollowerID == followerId && f.FollowingID == followingId {
+			return f, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (m *mockFollowerStore) GetIncomingFollowRequests(userId uuid.UUID) ([]*types.FollowRequest, error) {
+	return nil, nil
+}
+
+func (m *mockFollowerStore) GetOutgoingFollowRequests(userId uuid.UUID) ([]*types.FollowRequest, error) {
+	return nil, nil
+}
+
+func (m *mockFollowerStore) AcceptFollowRequest(id, followingId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockFollowerStore) RejectFollowRequest(id, followingId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockFollowerStore) GetFollowers(userId, viewerId uuid.UUID, page types.PageRequest) ([]*types.FollowListEntry, error) {
+	entries := make([]*types.FollowListEntry, 0)
+	for _, f := range m.follows {
+		if f.FollowingID == userId && f.Accepted() {
+			entries = append(entries, &types.FollowListEntry{
+				ProfileSummary: types.ProfileSummary{UserID: f.FollowerID},
+				FollowedAt:     f.CreatedAt,
+				FollowID:       f.ID,
+			})
+		}
+	}
+
+	if len(entries) > page.Limit+1 {
+		entries = entries[:page.Limit+1]
+	}
+
+	return entries, nil
+}
+
+func (m *mockFollowerStore) GetFollowing(userId, viewerId uuid.UUID, page types.PageRequest) ([]*types.FollowListEntry, error) {
+	return nil, nil
+}
+
+type mockProfileStore struct {
+	profiles map[uuid.UUID]*types.Profile
+}
+
+func (m *mockProfileStore) GetProfileByUserId(userId uuid.UUID) (*types.Profile, error) {
+	p, ok := m.profiles[userId]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return p, nil
+}
+
+func (m *mockProfileStore) CreateProfile(types.Profile) error {
+	return nil
+}
+
+func (m *mockProfileStore) UpdateAvatar(userId uuid.UUID, avatar string) error {
+	return nil
+}
+
+func (m *mockProfileStore) IsUsernameAvailable(username string, userId uuid.UUID) (bool, error) {
+	return true, nil
+}
+
+func (m *mockProfileStore) UpdateProfile(userId uuid.UUID, payload types.UpdateProfilePayload, reserveOldUntil time.Time) error {
+	return nil
+}
+
+func TestGetFollowers(t *testing.T) {
+	viewerId := uuid.New()
+	publicId := uuid.New()
+	privateId := uuid.New()
+
+	store := &mockFollowerStore{}
+	for i := 0; i < 3; i++ {
+		store.FollowUser(uuid.New(), publicId, types.FollowStatusAccepted)
+		store.FollowUser(uuid.New(), privateId, types.FollowStatusAccepted)
+	}
+
+	profiles := &mockProfileStore{profiles: map[uuid.UUID]*types.Profile{
+		publicId:  {UserID: publicId, Public: true},
+		privateId: {UserID: privateId, Public: false},
+	}}
+	handler := NewHandler(store, nil, profiles, privacy.NewPolicy(profiles, store, &mockSafetyStore{}), &mockNotifier{}, &mockFeedCache{})
+
+	list := func(owner uuid.UUID, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/user/%s/followers%s", owner, query), nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, viewerId))
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.GET("/user/:id/followers", handler.HandleGetFollowers)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should page through a public account's followers", func(t *testing.T) {
+		rr := list(publicId, "?limit=2")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var page types.Page[*types.FollowListEntry]
+		if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(page.Items) != 2 || page.NextCursor == "" {
+			t.Errorf("expected 2 items and a next cursor, got %d items and %q", len(page.Items), page.NextCursor)
+		}
+	})
+
+	t.Run("should hide a private account's followers", func(t *testing.T) {
+		rr := list(privateId, "")
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should reject a bad cursor", func(t *testing.T) {
+		rr := list(publicId, "?cursor=nope")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+type mockSafetyStore struct {
+	blocks map[[2]uuid.UUID]bool
+}
+
+func (m *mockSafetyStore) BlockUser(blockerId, blockedId uuid.UUID) error {
+	if m.blocks == nil {
+		m.blocks = make(map[[2]uuid.UUID]bool)
+	}
+	m.blocks[[2]uuid.UUID{blockerId, blockedId}] = true
+	return nil
+}
+
+func (m *mockSafetyStore) UnblockUser(blockerId, blockedId uuid.UUID) error {
+	delete(m.blocks, [2]uuid.UUID{blockerId, blockedId})
+	return nil
+}
+
+func (m *mockSafetyStore) IsBlocked(userId, otherId uuid.UUID) (bool, error) {
+	return m.blocks[[2]uuid.UUID{userId, otherId}] || m.blocks[[2]uuid.UUID{otherId, userId}], nil
+}
+
+func (m *mockSafetyStore) GetBlockedUsers(userId uuid.UUID) ([]*types.UserRelation, error) {
+	return nil, nil
+}
+
+func (m *mockSafetyStore) MuteUser(muterId, mutedId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockSafetyStore) UnmuteUser(muterId, mutedId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockSafetyStore) GetMutedUsers(userId uuid.UUID) ([]*types.UserRelation, error) {
+	return nil, nil
+}
+
+func (m *mockSafetyStore) GetMutedUserIDs(userId uuid.UUID) ([]uuid.UUID, error) {
+	return nil, nil
+}
+
+type mockNotifier struct {
+	sent []types.Notification
+}
+
+func (m *mockNotifier) Notify(n types.Notification) {
+	m.sent = append(m.sent, n)
+}
+
+func (m *mockNotifier) last() *types.Notification {
+	if len(m.sent) == 0 {
+		return nil
+	}
+
+	return &m.sent[len(m.sent)-1]
+}
+
+type mockFeedCache struct {
+	forgotten []uuid.UUID
+}
+
+func (m *mockFeedCache) Forget(userIds ...uuid.UUID) {
+	m.forgotten = append(m.forgotten, userIds...)
+}
@@ -2,8 +2,10 @@ package follower
 
 import (
 	"database/sql"
+	"fmt"
 
 	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/ZondaF12/logbook-backend/utils"
 	"github.com/google/uuid"
 )
 
@@ -17,8 +19,8 @@ func NewStore(db *sql.DB) *Store {
 	}
 }
 
-func (s *Store) FollowUser(followerId, followingId uuid.UUID) error {
-	_, err := s.db.Exec(`INSERT INTO followers (id, follower_id, following_id) VALUES (?, ?, ?)`, uuid.New(), followerId, followingId)
+func (s *Store) FollowUser(followerId, followingId uuid.UUID, status string) error {
+	_, err := s.db.Exec(`INSERT INTO followers (id, follower_id, following_id, status) VALUES (?, ?, ?, ?)`, uuid.New(), followerId, followingId, status)
 	if err != nil {
 		return err
 	}
@@ -43,6 +45,7 @@ func scanRowIntoFollower(rows *sql.Rows) (*types.Follower, error) {
 		&user.FollowerID,
 		&user.FollowingID,
 		&user.CreatedAt,
+		&user.Status,
 	)
 	if err != nil {
 		return nil, err
@@ -56,6 +59,7 @@ func (s *Store) GetFollower(followerId, followingId uuid.UUID) (*types.Follower,
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	f := new(types.Follower)
 
@@ -72,3 +76,155 @@ func (s *Store) GetFollower(followerId, followingId uuid.UUID) (*types.Follower,
 
 	return f, nil
 }
+
+func (s *Store) GetIncomingFollowRequests(userId uuid.UUID) ([]*types.FollowRequest, error) {
+	return s.getFollowRequests("f.follower_id", "f.following_id", userId)
+}
+
+func (s *Store) GetOutgoingFollowRequests(userId uuid.UUID) ([]*types.FollowRequest, error) {
+	return s.getFollowRequests("f.following_id", "f.follower_id", userId)
+}
+
+// getFollowRequests lists the pending requests where userId is in the self
+// column, along with the profile of the user in the other column.
+func (s *Store) getFollowRequests(otherColumn, selfColumn string, userId uuid.UUID) ([]*types.FollowRequest, error) {
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT
+			f.id,
+			f.created_at,
+			%[1]s,
+			`+utils.ProfileSummaryColumns+`
+		FROM followers f
+		LEFT JOIN profiles p ON p.user_id = %[1]s
+		WHERE %[2]s = ? AND f.status = ?
+		ORDER BY f.created_at DESC`, otherColumn, selfColumn), userId, types.FollowStatusPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := make([]*types.FollowRequest, 0)
+	for rows.Next() {
+		request := &types.FollowRequest{User: new(types.ProfileSummary)}
+
+		err := rows.Scan(
+			&request.ID,
+			&request.CreatedAt,
+			&request.User.UserID,
+			&request.User.ID,
+			&request.User.Username,
+			&request.User.Name,
+			&request.User.Avatar,
+			&request.User.Public,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, request)
+	}
+
+	return requests, nil
+}
+
+func (s *Store) AcceptFollowRequest(id, followingId uuid.UUID) error {
+	res, err := s.db.Exec(`UPDATE followers SET status = ? WHERE id = ? AND following_id = ? AND status = ?`,
+		types.FollowStatusAccepted, id, followingId, types.FollowStatusPending)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(res)
+}
+
+func (s *Store) RejectFollowRequest(id, followingId uuid.UUID) error {
+	res, err := s.db.Exec(`DELETE FROM followers WHERE id = ? AND following_id = ? AND status = ?`,
+		id, followingId, types.FollowStatusPending)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(res)
+}
+
+func requireAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("follow request not found")
+	}
+
+	return nil
+}
+
+func (s *Store) GetFollowers(userId, viewerId uuid.UUID, page types.PageRequest) ([]*types.FollowListEntry, error) {
+	return s.getFollowList("f.follower_id", "f.following_id", userId, viewerId, page)
+}
+
+func (s *Store) GetFollowing(userId, viewerId uuid.UUID, page types.PageRequest) ([]*types.FollowListEntry, error) {
+	return s.getFollowList("f.following_id", "f.follower_id", userId, viewerId, page)
+}
+
+// getFollowList pages through the accepted follows where userId is in the
+// self column, newest first.
+func (s *Store) getFollowList(otherColumn, selfColumn string, userId, viewerId uuid.UUID, page types.PageRequest) ([]*types.FollowListEntry, error) {
+	// Users blocked either way round are left out of the viewer's lists
+	where := fmt.Sprintf(`%[1]s = ? AND f.status = ? AND NOT EXISTS(
+			SELECT 1 FROM user_blocks b
+			WHERE (b.blocker_id = ? AND b.blocked_id = %[2]s) OR (b.blocker_id = %[2]s AND b.blocked_id = ?)
+		)`, selfColumn, otherColumn)
+	args := []interface{}{viewerId, types.FollowStatusAccepted, userId, types.FollowStatusAccepted, viewerId, viewerId}
+
+	if page.After != nil {
+		where += " AND (f.created_at < ? OR (f.created_at = ? AND f.id < ?))"
+		args = append(args, page.After.CreatedAt, page.After.CreatedAt, page.After.ID)
+	}
+	args = append(args, page.Limit+1)
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT
+			f.id,
+			f.created_at,
+			%[1]s,
+			`+utils.ProfileSummaryColumns+`,
+			EXISTS(
+				SELECT 1 FROM followers fb
+				WHERE fb.follower_id = ? AND fb.following_id = %[1]s AND fb.status = ?
+			)
+		FROM followers f
+		LEFT JOIN profiles p ON p.user_id = %[1]s
+		WHERE %[2]s
+		ORDER BY f.created_at DESC, f.id DESC
+		LIMIT ?`, otherColumn, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*types.FollowListEntry, 0)
+	for rows.Next() {
+		entry := new(types.FollowListEntry)
+
+		err := rows.Scan(
+			&entry.FollowID,
+			&entry.FollowedAt,
+			&entry.UserID,
+			&entry.ID,
+			&entry.Username,
+			&entry.Name,
+			&entry.Avatar,
+			&entry.Public,
+			&entry.FollowsBack,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -1,18 +1,16 @@
 package garage
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 
 	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/media"
+	"github.com/ZondaF12/logbook-backend/service/privacy"
 	"github.com/ZondaF12/logbook-backend/types"
 	"github.com/ZondaF12/logbook-backend/utils"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -22,23 +20,32 @@ type Handler struct {
 	store      types.GarageStore
 	userStore  types.UserStore
 	mediaStore types.MediaStore
+	policy     *privacy.Policy
+	publisher  types.FeedPublisher
+	blobs      types.BlobStore
+	images     *media.Processor
 }
 
-func NewHandler(store types.GarageStore, userStore types.UserStore, mediaStore types.MediaStore) *Handler {
+func NewHandler(store types.GarageStore, userStore types.UserStore, mediaStore types.MediaStore, policy *privacy.Policy, publisher types.FeedPublisher, blobs types.BlobStore, images *media.Processor) *Handler {
 	return &Handler{
 		store:      store,
 		userStore:  userStore,
 		mediaStore: mediaStore,
+		policy:     policy,
+		publisher:  publisher,
+		blobs:      blobs,
+		images:     images,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *echo.Group) {
-	router.POST("/garage/vehicle", auth.WithJWTAuth(h.HandleAddVehicleToGarage, h.userStore))
-	router.GET("/garage", auth.WithJWTAuth(h.HandleGetUserGarage, h.userStore))
-	router.GET("/garage/vehicle/:registration", auth.WithJWTAuth(h.HandleGetVehicleByRegistration, h.userStore))
-	router.PATCH("/garage/vehicle/:registration", auth.WithJWTAuth(h.HandleUpdateVehicle, h.userStore))
-	router.GET("/garage/vehicle/:registration/exists", auth.WithJWTAuth(h.HandleCheckVehicleExistsInGarage, h.userStore))
-	router.POST("/garage/vehicle/:id/uploadImage", auth.WithJWTAuth(h.HandleUploadVehicleImage, h.userStore))
+	router.POST("/garage/vehicle", auth.WithJWTAuth(h.HandleAddVehicleToGarage, h.userStore, auth.RequireScope(auth.ScopeGarageWrite)))
+	router.GET("/garage", auth.WithJWTAuth(h.HandleGetUserGarage, h.userStore, auth.RequireScope(auth.ScopeGarageRead)))
+	router.GET("/user/:id/garage", auth.WithJWTAuth(h.HandleGetGarageByUserId, h.userStore, auth.RequireScope(auth.ScopeGarageRead)))
+	router.GET("/garage/vehicle/:registration", auth.WithJWTAuth(h.HandleGetVehicleByRegistration, h.userStore, auth.RequireScope(auth.ScopeGarageRead)))
+	router.PATCH("/garage/vehicle/:registration", auth.WithJWTAuth(h.HandleUpdateVehicle, h.userStore, auth.RequireScope(auth.ScopeGarageWrite)))
+	router.GET("/garage/vehicle/:registration/exists", auth.WithJWTAuth(h.HandleCheckVehicleExistsInGarage, h.userStore, auth.RequireScope(auth.ScopeGarageRead)))
+	router.POST("/garage/vehicle/:id/uploadImage", auth.WithJWTAuth(h.HandleUploadVehicleImage, h.userStore, auth.RequireScope(auth.ScopeGarageWrite)))
 }
 
 func (h *Handler) HandleAddVehicleToGarage(c echo.Context) error {
@@ -77,6 +84,15 @@ func (h *Handler) HandleAddVehicleToGarage(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
+	h.publisher.Publish(userId, types.FeedItem{
+		ID:        vehicleId,
+		Type:      types.FeedItemVehicle,
+		VehicleID: vehicleId,
+		Make:      payload.Make,
+		Model:     payload.Model,
+		Nickname:  payload.Nickname,
+	})
+
 	return c.JSON(http.StatusCreated, map[string]string{"vehicle_id": vehicleId.String()})
 }
 
@@ -88,6 +104,34 @@ func (h *Handler) HandleGetUserGarage(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
+	h.resolveImages(vehicles)
+
+	return c.JSON(http.StatusOK, vehicles)
+}
+
+func (h *Handler) HandleGetGarageByUserId(c echo.Context) error {
+	ownerId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	// Check the user is allowed to see the garage
+	err = h.policy.CanViewContent(userId, ownerId)
+	if errors.Is(err, privacy.ErrNotVisible) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	vehicles, err := h.store.GetAuthenticatedUserVehicles(ownerId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	h.resolveImages(vehicles)
 
 	return c.JSON(http.StatusOK, vehicles)
 }
@@ -147,59 +191,86 @@ func (h *Handler) HandleCheckVehicleExistsInGarage(c echo.Context) error {
 }
 
 func (h *Handler) HandleUploadVehicleImage(c echo.Context) error {
-	fmt.Println("Uploading image")
-	id := c.Param("id")
-	vehicleId := uuid.MustParse(id)
-
-	// Get avatar file
-	file, err := c.FormFile("image")
+	vehicleId, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid vehicle ID")
 	}
-	src, err := file.Open()
+
+	// Get user ID from JWT
+	userID := auth.GetUserIDFromContext(c.Request().Context())
+
+	// Check the user owns the vehicle before reading the file
+	vehicle, err := h.store.GetVehicleByID(vehicleId)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
-	defer src.Close()
 
-	// Upload avatar to S3
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		log.Printf("error: %v", err)
-		return c.JSON(http.StatusInternalServerError, "Error uploading image")
+	if vehicle.ID == uuid.Nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Vehicle not found")
 	}
 
-	client := s3.NewFromConfig(cfg)
+	if vehicle.UserID != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "Not your vehicle")
+	}
 
-	uploader := manager.NewUploader(client)
-	result, err := uploader.Upload(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String("logbook-app"),
-		Key:    aws.String(fmt.Sprintf("vehicles/%d/images/%s", vehicleId, file.Filename)),
-		Body:   src,
-	})
+	// Get image file
+	file, err := media.FormFile(c, "image", types.UploadVehicleImage)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Store resized copies rather than the original, which may carry the
+	// location the photo was taken at
+	mediaId := uuid.New()
+	renditions, err := h.images.Process(c.Request().Context(), media.Key(types.UploadVehicleImage, vehicleId, mediaId), file)
+	if errors.Is(err, media.ErrNotImage) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 	if err != nil {
 		log.Printf("error: %v", err)
 		return c.JSON(http.StatusInternalServerError, "Error uploading image")
 	}
 
-	fileType := file.Header.Get("Content-Type")
-	userID := auth.GetUserIDFromContext(c.Request().Context())
-	media := types.Media{
+	location := h.blobs.Location(renditions.Full)
+	fileType := "image/jpeg"
+	vehicleMedia := types.Media{
+		ID:         &mediaId,
 		Filename:   &file.Filename,
 		FileType:   &fileType,
-		S3Location: &result.Location,
+		S3Location: &location,
 		VehicleID:  &vehicleId,
 		UserID:     &userID,
+		Renditions: renditions,
 	}
 
 	// Add media to database
-	err = h.mediaStore.AddNewVehicleMedia(media)
+	err = h.mediaStore.AddNewVehicleMedia(vehicleMedia)
 	if err != nil {
 		log.Printf("error: %v", err)
 		return c.JSON(http.StatusInternalServerError, err)
 	}
 
-	return c.JSON(http.StatusOK, result.Location)
+	urls := media.URLs(h.blobs, location, renditions)
+
+	h.publisher.Publish(userID, types.FeedItem{
+		ID:        mediaId,
+		Type:      types.FeedItemVehicleImage,
+		VehicleID: vehicleId,
+		Make:      vehicle.Make,
+		Model:     vehicle.Model,
+		Nickname:  vehicle.Nickname,
+		ImageURL:  urls.Preview(),
+	})
+
+	return c.JSON(http.StatusOK, urls)
+}
+
+// resolveImages fills in the URLs of each size of the vehicles' images.
+func (h *Handler) resolveImages(vehicles []*types.Vehicle) {
+	for _, vehicle := range vehicles {
+		for _, image := range vehicle.Images {
+			image.URLs = media.URLs(h.blobs, image.Location, image.Renditions)
+		}
+	}
 }
@@ -0,0 +1,91 @@
+package garage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestUploadVehicleImage(t *testing.T) {
+	userId := uuid.New()
+	vehicleId := uuid.New()
+	otherVehicleId := uuid.New()
+
+	store := &mockGarageStore{vehicles: map[uuid.UUID]*types.Vehicle{
+		vehicleId:      {ID: vehicleId, UserID: userId},
+		otherVehicleId: {ID: otherVehicleId, UserID: uuid.New()},
+	}}
+	handler := NewHandler(store, nil, nil, nil, nil, nil, nil)
+
+	upload := func(vehicleId uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/garage/vehicle/%s/uploadImage", vehicleId), nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userId))
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.POST("/garage/vehicle/:id/uploadImage", handler.HandleUploadVehicleImage)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should fail if the vehicle doesn't exist", func(t *testing.T) {
+		rr := upload(uuid.New())
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should not upload to another user's vehicle", func(t *testing.T) {
+		rr := upload(otherVehicleId)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should read the file for the owner", func(t *testing.T) {
+		rr := upload(vehicleId)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+type mockGarageStore struct {
+	vehicles map[uuid.UUID]*types.Vehicle
+}
+
+func (m *mockGarageStore) GetVehicleByID(id uuid.UUID) (*types.Vehicle, error) {
+	if vehicle, ok := m.vehicles[id]; ok {
+		return vehicle, nil
+	}
+	return &types.Vehicle{}, nil
+}
+
+func (m *mockGarageStore) GetAuthenticatedUserVehicles(userID uuid.UUID) ([]*types.Vehicle, error) {
+	return nil, nil
+}
+
+func (m *mockGarageStore) GetVehicleByRegistration(userId uuid.UUID, registration string) (*types.Vehicle, error) {
+	return nil, nil
+}
+
+func (m *mockGarageStore) AddUserVehicle(userID uuid.UUID, vehicle types.NewVehiclePostData) (uuid.UUID, error) {
+	return uuid.Nil, nil
+}
+
+func (m *mockGarageStore) CheckVehicleAdded(userId uuid.UUID, registration string) (bool, error) {
+	return false, nil
+}
+
+func (m *mockGarageStore) UpdateVehicle(userId uuid.UUID, registration string, data types.UpdateVehiclePatchData) error {
+	return nil
+}
@@ -20,25 +20,11 @@ func NewStore(db *sql.DB) *Store {
 }
 
 func (s *Store) GetAuthenticatedUserVehicles(userId uuid.UUID) ([]*types.Vehicle, error) {
-	rows, err := s.db.Query(`SELECT
-			v.*,
-			(
-			SELECT
-				GROUP_CONCAT(m.s3_location)
-			FROM
-				media m
-			WHERE
-				m.vehicle_id = v.id
-			) AS media
-		FROM
-			vehicles v
-		WHERE
-			v.user_id = ?
-		ORDER BY
-			v.created_at`, userId)
+	rows, err := s.db.Query("SELECT * FROM vehicles WHERE user_id = ? ORDER BY created_at", userId)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	vehicles := make([]*types.Vehicle, 0)
 	for rows.Next() {
@@ -50,11 +36,75 @@ func (s *Store) GetAuthenticatedUserVehicles(userId uuid.UUID) ([]*types.Vehicle
 		vehicles = append(vehicles, vehicle)
 	}
 
+	images, err := s.getVehicleImages(`
+		SELECT
+			m.id, m.vehicle_id, m.filename, m.file_type, m.caption, m.position, m.cover, m.uploaded_at,
+			m.s3_location, m.thumbnail_key, m.medium_key, m.full_key
+		FROM media m
+		JOIN vehicles v ON v.id = m.vehicle_id
+		WHERE v.user_id = ?
+		ORDER BY m.position, m.uploaded_at`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, vehicle := range vehicles {
+		if vehicleImages, ok := images[vehicle.ID]; ok {
+			vehicle.Images = vehicleImages
+		}
+	}
+
 	return vehicles, nil
 }
 
+// getVehicleImages groups the media the query returns by vehicle.
+func (s *Store) getVehicleImages(query string, args ...interface{}) (map[uuid.UUID][]*types.MediaItem, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := make(map[uuid.UUID][]*types.MediaItem)
+	for rows.Next() {
+		var vehicleId uuid.UUID
+		var thumbnail, medium, full sql.NullString
+		image := &types.MediaItem{VehicleID: &vehicleId}
+
+		err := rows.Scan(
+			&image.ID,
+			&vehicleId,
+			&image.Filename,
+			&image.FileType,
+			&image.Caption,
+			&image.Position,
+			&image.Cover,
+			&image.UploadedAt,
+			&image.Location,
+			&thumbnail,
+			&medium,
+			&full,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if full.Valid {
+			image.Renditions = &types.Renditions{
+				Thumbnail: thumbnail.String,
+				Medium:    medium.String,
+				Full:      full.String,
+			}
+		}
+
+		images[vehicleId] = append(images[vehicleId], image)
+	}
+
+	return images, nil
+}
+
 func scanRowIntoVehicle(rows *sql.Rows) (*types.Vehicle, error) {
-	vehicle := new(types.Vehicle)
+	vehicle := &types.Vehicle{Images: []*types.MediaItem{}}
 
 	err := rows.Scan(
 		&vehicle.ID,
@@ -74,7 +124,6 @@ func scanRowIntoVehicle(rows *sql.Rows) (*types.Vehicle, error) {
 		&vehicle.Mileage,
 		&vehicle.Nickname,
 		&vehicle.CreatedAt,
-		&vehicle.Images,
 	)
 	if err != nil {
 		return nil, err
@@ -118,25 +167,11 @@ func (s *Store) CheckVehicleAdded(userId uuid.UUID, registration string) (bool,
 }
 
 func (s *Store) GetVehicleByID(vehicleId uuid.UUID) (*types.Vehicle, error) {
-	rows, err := s.db.Query(`SELECT
-			v.*,
-			(
-			SELECT
-				GROUP_CONCAT(m.s3_location)
-			FROM
-				media m
-			WHERE
-				m.vehicle_id = v.id
-			) AS media
-		FROM
-			vehicles v
-		WHERE
-			v.id = ?
-		ORDER BY
-			v.created_at`, vehicleId)
+	rows, err := s.db.Query("SELECT * FROM vehicles WHERE id = ?", vehicleId)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	vehicle := new(types.Vehicle)
 	for rows.Next() {
@@ -146,6 +181,24 @@ func (s *Store) GetVehicleByID(vehicleId uuid.UUID) (*types.Vehicle, error) {
 		}
 	}
 
+	if vehicle.ID == uuid.Nil {
+		return vehicle, nil
+	}
+
+	images, err := s.getVehicleImages(`
+		SELECT
+			id, vehicle_id, filename, file_type, caption, position, cover, uploaded_at,
+			s3_location, thumbnail_key, medium_key, full_key
+		FROM media
+		WHERE vehicle_id = ?
+		ORDER BY position, uploaded_at`, vehicleId)
+	if err != nil {
+		return nil, err
+	}
+	if vehicleImages, ok := images[vehicle.ID]; ok {
+		vehicle.Images = vehicleImages
+	}
+
 	return vehicle, nil
 }
 
@@ -0,0 +1,117 @@
+package lockout
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+// MemoryStore keeps login attempts and security events in process. It suits
+// tests and single instance deployments, attempts are lost on restart.
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]types.LoginAttempts
+	events   []types.SecurityEvent
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		attempts: make(map[string]types.LoginAttempts),
+	}
+}
+
+func (s *MemoryStore) GetLoginAttempts(key string) (*types.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if !ok {
+		return &types.LoginAttempts{Key: key}, nil
+	}
+
+	return &attempts, nil
+}
+
+func (s *MemoryStore) RecordLoginFailure(key string, at time.Time, window time.Duration) (*types.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := s.attempts[key]
+	attempts.Key = key
+
+	if attempts.LastFailureAt == nil || at.Sub(*attempts.LastFailureAt) > window {
+		attempts.Failures = 1
+	} else {
+		attempts.Failures++
+	}
+	attempts.LastFailureAt = &at
+
+	s.attempts[key] = attempts
+
+	return &attempts, nil
+}
+
+func (s *MemoryStore) LockLogin(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := s.attempts[key]
+	attempts.Key = key
+	attempts.Failures = 0
+	attempts.LockedUntil = &until
+
+	s.attempts[key] = attempts
+
+	return nil
+}
+
+func (s *MemoryStore) ResetLoginAttempts(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+
+	return nil
+}
+
+func (s *MemoryStore) CreateSecurityEvent(event types.SecurityEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	s.events = append(s.events, event)
+
+	return nil
+}
+
+func (s *MemoryStore) GetUserSecurityEvents(userId uuid.UUID, limit int) ([]*types.SecurityEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]*types.SecurityEvent, 0)
+	for i := range s.events {
+		if s.events[i].UserID == userId {
+			event := s.events[i]
+			events = append(events, &event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt.After(events[j].CreatedAt)
+	})
+
+	if len(events) > limit {
+		events = events[:limit]
+	}
+
+	return events, nil
+}
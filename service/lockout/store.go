@@ -0,0 +1,144 @@
+package lockout
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func scanRowIntoLoginAttempts(rows *sql.Rows) (*types.LoginAttempts, error) {
+	attempts := new(types.LoginAttempts)
+
+	err := rows.Scan(
+		&attempts.Key,
+		&attempts.Failures,
+		&attempts.LastFailureAt,
+		&attempts.LockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+func (s *Store) GetLoginAttempts(key string) (*types.LoginAttempts, error) {
+	rows, err := s.db.Query("SELECT * FROM login_attempts WHERE attempt_key = ?", key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := &types.LoginAttempts{Key: key}
+	for rows.Next() {
+		attempts, err = scanRowIntoLoginAttempts(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return attempts, nil
+}
+
+func (s *Store) RecordLoginFailure(key string, at time.Time, window time.Duration) (*types.LoginAttempts, error) {
+	// failures is assigned before last_failure_at so it still sees the
+	// previous failure time
+	_, err := s.db.Exec(`
+		INSERT INTO login_attempts (attempt_key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON DUPLICATE KEY UPDATE
+			failures = IF(last_failure_at IS NULL OR last_failure_at < ?, 1, failures + 1),
+			last_failure_at = ?`,
+		key, at, at.Add(-window), at,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetLoginAttempts(key)
+}
+
+func (s *Store) LockLogin(key string, until time.Time) error {
+	_, err := s.db.Exec("UPDATE login_attempts SET locked_until = ?, failures = 0 WHERE attempt_key = ?", until, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) ResetLoginAttempts(key string) error {
+	_, err := s.db.Exec("DELETE FROM login_attempts WHERE attempt_key = ?", key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) CreateSecurityEvent(event types.SecurityEvent) error {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO security_events (id, user_id, event_type, ip_address, user_agent)
+		VALUES (?, ?, ?, ?, ?)`,
+		event.ID, event.UserID, event.Type, event.IPAddress, event.UserAgent,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func scanRowIntoSecurityEvent(rows *sql.Rows) (*types.SecurityEvent, error) {
+	event := new(types.SecurityEvent)
+
+	err := rows.Scan(
+		&event.ID,
+		&event.UserID,
+		&event.Type,
+		&event.IPAddress,
+		&event.UserAgent,
+		&event.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+func (s *Store) GetUserSecurityEvents(userId uuid.UUID, limit int) ([]*types.SecurityEvent, error) {
+	rows, err := s.db.Query("SELECT * FROM security_events WHERE user_id = ? ORDER BY created_at DESC LIMIT ?", userId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*types.SecurityEvent, 0)
+	for rows.Next() {
+		event, err := scanRowIntoSecurityEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
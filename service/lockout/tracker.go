@@ -0,0 +1,210 @@
+package lockout
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+const (
+	EventAccountLocked = "account_locked"
+	EventIPLocked      = "ip_locked"
+)
+
+// Policy controls how quickly failed logins are slowed down and locked out.
+type Policy struct {
+	// FreeAttempts is the number of failures allowed before delays start.
+	FreeAttempts int
+	// BaseDelay doubles with every failure after the free attempts, up to
+	// MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockAfter failures lock the key for LockFor.
+	LockAfter int
+	LockFor   time.Duration
+	// Window is how long a failure counts against the key.
+	Window time.Duration
+}
+
+var (
+	AccountPolicy = Policy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     30 * time.Second,
+		LockAfter:    10,
+		LockFor:      15 * time.Minute,
+		Window:       time.Hour,
+	}
+
+	// IPPolicy is more lenient since many users can share an address.
+	IPPolicy = Policy{
+		FreeAttempts: 10,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		LockAfter:    50,
+		LockFor:      30 * time.Minute,
+		Window:       time.Hour,
+	}
+)
+
+// wait returns how long the key has to wait before its next attempt.
+func (p Policy) wait(a *types.LoginAttempts, now time.Time) time.Duration {
+	if a.LockedUntil != nil && now.Before(*a.LockedUntil) {
+		return a.LockedUntil.Sub(now)
+	}
+
+	if a.LastFailureAt == nil || a.Failures <= p.FreeAttempts || now.Sub(*a.LastFailureAt) > p.Window {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < a.Failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	next := a.LastFailureAt.Add(delay)
+	if now.Before(next) {
+		return next.Sub(now)
+	}
+
+	return 0
+}
+
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// Tracker counts failed logins per account and per source IP.
+type Tracker struct {
+	store   types.LoginAttemptStore
+	events  types.SecurityEventStore
+	account Policy
+	ip      Policy
+	now     func() time.Time
+}
+
+func NewTracker(store types.LoginAttemptStore, events types.SecurityEventStore) *Tracker {
+	return &Tracker{
+		store:   store,
+		events:  events,
+		account: AccountPolicy,
+		ip:      IPPolicy,
+		now:     time.Now,
+	}
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns a *LockedError if either the account or the IP has to wait
+// before trying again.
+func (t *Tracker) Check(email, ip string) error {
+	now := t.now()
+
+	keys := map[string]Policy{
+		accountKey(email): t.account,
+		ipKey(ip):         t.ip,
+	}
+
+	var retryAfter time.Duration
+	for key, policy := range keys {
+		attempts, err := t.store.GetLoginAttempts(key)
+		if err != nil {
+			return err
+		}
+
+		if wait := policy.wait(attempts, now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	if retryAfter > 0 {
+		return &LockedError{RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+// Failure records a failed attempt. userId is uuid.Nil when the email does not
+// belong to an account, in which case no security event is recorded.
+func (t *Tracker) Failure(userId uuid.UUID, email, ip, userAgent string) error {
+	now := t.now()
+
+	locked, err := t.recordFailure(accountKey(email), t.account, now)
+	if err != nil {
+		return err
+	}
+	if locked {
+		t.recordEvent(userId, EventAccountLocked, ip, userAgent)
+	}
+
+	locked, err = t.recordFailure(ipKey(ip), t.ip, now)
+	if err != nil {
+		return err
+	}
+	if locked {
+		t.recordEvent(userId, EventIPLocked, ip, userAgent)
+	}
+
+	return nil
+}
+
+func (t *Tracker) recordFailure(key string, policy Policy, now time.Time) (bool, error) {
+	attempts, err := t.store.RecordLoginFailure(key, now, policy.Window)
+	if err != nil {
+		return false, err
+	}
+
+	if attempts.Failures < policy.LockAfter {
+		return false, nil
+	}
+
+	if err := t.store.LockLogin(key, now.Add(policy.LockFor)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (t *Tracker) recordEvent(userId uuid.UUID, eventType, ip, userAgent string) {
+	if userId == uuid.Nil {
+		return
+	}
+
+	err := t.events.CreateSecurityEvent(types.SecurityEvent{
+		ID:        uuid.New(),
+		UserID:    userId,
+		Type:      eventType,
+		IPAddress: ip,
+		UserAgent: userAgent,
+	})
+	if err != nil {
+		log.Printf("error recording security event: %v", err)
+	}
+}
+
+// Success clears the account's failures. The IP counter is left alone so a
+// single valid account can't be used to reset it between guesses.
+func (t *Tracker) Success(email string) error {
+	return t.store.ResetLoginAttempts(accountKey(email))
+}
+
+func (t *Tracker) SecurityEvents(userId uuid.UUID) ([]*types.SecurityEvent, error) {
+	return t.events.GetUserSecurityEvents(userId, 50)
+}
@@ -0,0 +1,111 @@
+package lockout
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestTracker(now *time.Time) (*Tracker, *MemoryStore) {
+	store := NewMemoryStore()
+	tracker := NewTracker(store, store)
+	tracker.now = func() time.Time { return *now }
+
+	return tracker, store
+}
+
+func TestTrackerProgressiveDelay(t *testing.T) {
+	now := time.Now()
+	tracker, _ := newTestTracker(&now)
+
+	for i := 0; i < AccountPolicy.FreeAttempts; i++ {
+		if err := tracker.Check("foo@email.com", "1.1.1.1"); err != nil {
+			t.Fatalf("expected free attempt %d to be allowed: %v", i+1, err)
+		}
+		if err := tracker.Failure(uuid.Nil, "foo@email.com", "1.1.1.1", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// One more failure starts the delay
+	if err := tracker.Failure(uuid.Nil, "foo@email.com", "1.1.1.1", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var locked *LockedError
+	if err := tracker.Check("foo@email.com", "1.1.1.1"); !errors.As(err, &locked) {
+		t.Fatalf("expected a delay after %d failures, got %v", AccountPolicy.FreeAttempts+1, err)
+	}
+
+	now = now.Add(locked.RetryAfter)
+	if err := tracker.Check("foo@email.com", "1.1.1.1"); err != nil {
+		t.Errorf("expected attempt to be allowed once the delay passed: %v", err)
+	}
+}
+
+func TestTrackerLocksAccountAndRecordsEvent(t *testing.T) {
+	now := time.Now()
+	tracker, store := newTestTracker(&now)
+	userId := uuid.New()
+
+	for i := 0; i < AccountPolicy.LockAfter; i++ {
+		if err := tracker.Failure(userId, "foo@email.com", "1.1.1.1", "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var locked *LockedError
+	if err := tracker.Check("foo@email.com", "2.2.2.2"); !errors.As(err, &locked) {
+		t.Fatal("expected account to be locked from any IP")
+	}
+
+	if locked.RetryAfter != AccountPolicy.LockFor {
+		t.Errorf("expected lockout of %s, got %s", AccountPolicy.LockFor, locked.RetryAfter)
+	}
+
+	events, err := store.GetUserSecurityEvents(userId, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 || events[0].Type != EventAccountLocked {
+		t.Errorf("expected a single %s event, got %v", EventAccountLocked, events)
+	}
+
+	// A different account on a different IP is unaffected
+	if err := tracker.Check("bar@email.com", "2.2.2.2"); err != nil {
+		t.Errorf("expected other accounts to be unaffected: %v", err)
+	}
+
+	now = now.Add(AccountPolicy.LockFor)
+	if err := tracker.Check("foo@email.com", "2.2.2.2"); err != nil {
+		t.Errorf("expected lockout to expire: %v", err)
+	}
+}
+
+func TestTrackerSuccessResetsAccountOnly(t *testing.T) {
+	now := time.Now()
+	tracker, store := newTestTracker(&now)
+
+	for i := 0; i < 5; i++ {
+		if err := tracker.Failure(uuid.Nil, "foo@email.com", "1.1.1.1", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tracker.Success("foo@email.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	account, _ := store.GetLoginAttempts(accountKey("foo@email.com"))
+	if account.Failures != 0 {
+		t.Errorf("expected account failures to be reset, got %d", account.Failures)
+	}
+
+	ip, _ := store.GetLoginAttempts(ipKey("1.1.1.1"))
+	if ip.Failures != 5 {
+		t.Errorf("expected ip failures to be kept, got %d", ip.Failures)
+	}
+}
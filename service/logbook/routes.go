@@ -1,18 +1,16 @@
 package logbook
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 
 	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/media"
+	"github.com/ZondaF12/logbook-backend/service/privacy"
 	"github.com/ZondaF12/logbook-backend/types"
 	"github.com/ZondaF12/logbook-backend/utils"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -23,21 +21,29 @@ type Handler struct {
 	userStore   types.UserStore
 	garageStore types.GarageStore
 	mediaStore  types.MediaStore
+	policy      *privacy.Policy
+	publisher   types.FeedPublisher
+	blobs       types.BlobStore
+	images      *media.Processor
 }
 
-func NewHandler(store types.LogbookStore, userStore types.UserStore, garageStore types.GarageStore, mediaStore types.MediaStore) *Handler {
+func NewHandler(store types.LogbookStore, userStore types.UserStore, garageStore types.GarageStore, mediaStore types.MediaStore, policy *privacy.Policy, publisher types.FeedPublisher, blobs types.BlobStore, images *media.Processor) *Handler {
 	return &Handler{
 		store:       store,
 		userStore:   userStore,
 		garageStore: garageStore,
 		mediaStore:  mediaStore,
+		policy:      policy,
+		publisher:   publisher,
+		blobs:       blobs,
+		images:      images,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *echo.Group) {
-	router.POST("/log", auth.WithJWTAuth(h.HandleCreateLog, h.userStore))
-	router.GET("/log/:vehicleId", auth.WithJWTAuth(h.HandleGetVehicleLogs, h.userStore))
-	router.POST("/log/:logId/media", auth.WithJWTAuth(h.HandleUploadLogMedia, h.userStore))
+	router.POST("/log", auth.WithJWTAuth(h.HandleCreateLog, h.userStore, auth.RequireScope(auth.ScopeLogbookWrite)))
+	router.GET("/log/:vehicleId", auth.WithJWTAuth(h.HandleGetVehicleLogs, h.userStore, auth.RequireScope(auth.ScopeLogbookRead)))
+	router.POST("/log/:logId/media", auth.WithJWTAuth(h.HandleUploadLogMedia, h.userStore, auth.RequireScope(auth.ScopeLogbookWrite)))
 }
 
 func (h *Handler) HandleCreateLog(c echo.Context) error {
@@ -76,6 +82,17 @@ func (h *Handler) HandleCreateLog(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
+	h.publisher.Publish(userId, types.FeedItem{
+		ID:        logId,
+		Type:      types.FeedItemLog,
+		VehicleID: vehicle.ID,
+		Make:      vehicle.Make,
+		Model:     vehicle.Model,
+		Nickname:  vehicle.Nickname,
+		Title:     payload.Title,
+		Category:  payload.Category,
+	})
+
 	return c.JSON(http.StatusOK, map[string]string{"log_id": logId.String()})
 }
 
@@ -84,8 +101,10 @@ func (h *Handler) HandleGetVehicleLogs(c echo.Context) error {
 	userId := auth.GetUserIDFromContext(c.Request().Context())
 
 	// Get vehicle ID
-	id := c.Param("vehicleId")
-	vehicleId := uuid.MustParse(id)
+	vehicleId, err := uuid.Parse(c.Param("vehicleId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid vehicle ID")
+	}
 
 	// Get vehicle from database
 	vehicle, err := h.garageStore.GetVehicleByID(vehicleId)
@@ -94,72 +113,111 @@ func (h *Handler) HandleGetVehicleLogs(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, err)
 	}
 
-	// Check if user owns the vehicle
-	if vehicle.UserID != userId {
-		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("user does not own vehicle"))
+	if vehicle.ID == uuid.Nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Vehicle not found")
+	}
+
+	// Check the user is allowed to see the vehicle's logs
+	err = h.policy.CanViewContent(userId, vehicle.UserID)
+	if errors.Is(err, privacy.ErrNotVisible) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
 	// Get logs from database
-	logs, err := h.store.GetLogsByVehicleId(vehicleId)
+	logs, err := h.store.GetLogsByVehicleId(vehicleId, userId)
 	if err != nil {
 		log.Printf("error: %v", err)
 		return c.JSON(http.StatusInternalServerError, err)
 	}
 
+	for _, l := range logs {
+		for _, m := range l.Media {
+			m.URLs = media.URLs(h.blobs, m.Location, m.Renditions)
+		}
+	}
+
 	return c.JSON(http.StatusOK, logs)
 }
 
 func (h *Handler) HandleUploadLogMedia(c echo.Context) error {
-	id := c.Param("logId")
-	logbookId := uuid.MustParse(id)
-
-	// Get avatar file
-	file, err := c.FormFile("media")
+	logbookId, err := uuid.Parse(c.Param("logId"))
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid log ID")
 	}
-	src, err := file.Open()
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	// Check the user owns the log's vehicle before reading the file
+	l, err := h.store.GetLogByID(logbookId)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return echo.NewHTTPError(http.StatusNotFound, "Log not found")
 	}
-	defer src.Close()
 
-	// Upload avatar to S3
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+	vehicle, err := h.garageStore.GetVehicleByID(l.VehicleID)
 	if err != nil {
-		log.Printf("error: %v", err)
-		return c.JSON(http.StatusInternalServerError, "Error uploading media")
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	client := s3.NewFromConfig(cfg)
+	if vehicle.UserID != userId {
+		return echo.NewHTTPError(http.StatusForbidden, "Not your vehicle")
+	}
 
-	uploader := manager.NewUploader(client)
-	result, err := uploader.Upload(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String("logbook-app"),
-		Key:    aws.String(fmt.Sprintf("logbook/%d/media/%s", logbookId, file.Filename)),
-		Body:   src,
-	})
+	// Get media file
+	file, err := media.FormFile(c, "media", types.UploadLogMedia)
 	if err != nil {
-		log.Printf("error: %v", err)
-		return c.JSON(http.StatusInternalServerError, "Error uploading image")
+		return err
+	}
+	defer file.Close()
+
+	ctx := c.Request().Context()
+	mediaId := uuid.New()
+	fileType := file.ContentType
+
+	// Images are stored as resized copies without their EXIF data, other
+	// files as they are
+	var location string
+	var renditions *types.Renditions
+	if media.IsImage(fileType) {
+		renditions, err = h.images.Process(ctx, media.Key(types.UploadLogMedia, logbookId, mediaId), file)
+		if errors.Is(err, media.ErrNotImage) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			log.Printf("error: %v", err)
+			return c.JSON(http.StatusInternalServerError, "Error uploading image")
+		}
+
+		location = h.blobs.Location(renditions.Full)
+		fileType = "image/jpeg"
+	} else {
+		key := media.OriginalKey(types.UploadLogMedia, logbookId, mediaId)
+		location, err = h.blobs.Put(ctx, key, fileType, file, file.Size)
+		if err != nil {
+			log.Printf("error: %v", err)
+			return c.JSON(http.StatusInternalServerError, "Error uploading media")
+		}
 	}
 
-	fileType := file.Header.Get("Content-Type")
-	media := types.Media{
+	logMedia := types.Media{
+		ID:         &mediaId,
 		Filename:   &file.Filename,
 		FileType:   &fileType,
-		S3Location: &result.Location,
+		S3Location: &location,
 		LogID:      &logbookId,
+		UserID:     &userId,
+		Renditions: renditions,
 	}
 
 	// Add media to database
-	err = h.mediaStore.AddNewLogMedia(media)
+	err = h.mediaStore.AddNewLogMedia(logMedia)
 	if err != nil {
 		log.Printf("error: %v", err)
 		return c.JSON(http.StatusInternalServerError, err)
 	}
 
-	return c.JSON(http.StatusOK, result.Location)
+	return c.JSON(http.StatusOK, media.URLs(h.blobs, location, renditions))
 }
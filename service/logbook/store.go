@@ -2,6 +2,7 @@ package logbook
 
 import (
 	"database/sql"
+	"fmt"
 
 	"github.com/ZondaF12/logbook-backend/types"
 	"github.com/google/uuid"
@@ -30,74 +31,121 @@ func (s *Store) CreateLog(log types.CreateLogPayload) (uuid.UUID, error) {
 	return newLogId, nil
 }
 
-func scanRowIntoLogWithMedia(rows *sql.Rows) (*types.Log, *types.LogMedia, error) {
-	var logbook types.Log
-	var media types.LogMedia
-
-	err := rows.Scan(
-		&logbook.ID,
-		&logbook.VehicleID,
-		&logbook.Category,
-		&logbook.Title,
-		&logbook.Date,
-		&logbook.Description,
-		&logbook.Notes,
-		&logbook.Cost,
-		&logbook.CreatedAt,
-		&media.Filename,
-		&media.FileType,
-		&media.S3Location,
-	)
+func (s *Store) GetLogByID(id uuid.UUID) (*types.Log, error) {
+	rows, err := s.db.Query(`
+		SELECT id, vehicle_id, category, title, date, description, notes, cost, created_at
+		FROM logs WHERE id = ?`, id)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	defer rows.Close()
+
+	l := new(types.Log)
+	for rows.Next() {
+		err := rows.Scan(&l.ID, &l.VehicleID, &l.Category, &l.Title, &l.Date, &l.Description, &l.Notes, &l.Cost, &l.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if l.ID == uuid.Nil {
+		return nil, fmt.Errorf("log not found")
 	}
 
-	return &logbook, &media, nil
+	return l, nil
 }
 
-func (s *Store) GetLogsByVehicleId(vehicleId uuid.UUID) ([]*types.Log, error) {
+func (s *Store) GetLogsByVehicleId(vehicleId, viewerId uuid.UUID) ([]*types.Log, error) {
+	// Comments are counted the way they are listed to the viewer
 	rows, err := s.db.Query(`
 		SELECT
 			logs.*,
-			media.filename,
-			media.file_type,
-			media.s3_location
+			(SELECT COUNT(*) FROM log_likes WHERE log_likes.log_id = logs.id) AS likes,
+			(
+				SELECT COUNT(*) FROM log_comments c
+				WHERE c.log_id = logs.id
+					AND NOT EXISTS(
+						SELECT 1 FROM user_blocks b
+						WHERE (b.blocker_id = ? AND b.blocked_id = c.user_id) OR (b.blocker_id = c.user_id AND b.blocked_id = ?)
+					)
+			) AS comments
 		FROM logs
-		LEFT JOIN media
-			ON logs.id = media.log_id
 		WHERE logs.vehicle_id = ?
-		ORDER BY logs.created_at DESC`, vehicleId)
+		ORDER BY logs.created_at DESC`, viewerId, viewerId, vehicleId)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	logs := make(map[string]*types.Log)
-
+	logs := make([]*types.Log, 0)
+	byId := make(map[uuid.UUID]*types.Log)
 	for rows.Next() {
-		log, media, err := scanRowIntoLogWithMedia(rows)
+		l := &types.Log{Media: []*types.MediaItem{}}
+		err := rows.Scan(&l.ID, &l.VehicleID, &l.Category, &l.Title, &l.Date, &l.Description, &l.Notes, &l.Cost, &l.CreatedAt, &l.Likes, &l.Comments)
 		if err != nil {
 			return nil, err
 		}
 
-		logID := log.ID.String()
+		logs = append(logs, l)
+		byId[l.ID] = l
+	}
 
-		// If log does not exist in map, create it
-		if _, ok := logs[logID]; !ok {
-			log.Media = []*types.LogMedia{}
-			logs[logID] = log
+	if err := s.attachMedia(vehicleId, byId); err != nil {
+		return nil, err
+	}
+
+	return logs, nil
+}
+
+// attachMedia adds the media of every log of the vehicle to the logs.
+func (s *Store) attachMedia(vehicleId uuid.UUID, logs map[uuid.UUID]*types.Log) error {
+	rows, err := s.db.Query(`
+		SELECT
+			m.id, m.log_id, m.filename, m.file_type, m.caption, m.position, m.uploaded_at,
+			m.s3_location, m.thumbnail_key, m.medium_key, m.full_key
+		FROM media m
+		JOIN logs ON logs.id = m.log_id
+		WHERE logs.vehicle_id = ?
+		ORDER BY m.position, m.uploaded_at`, vehicleId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var logId uuid.UUID
+		var thumbnail, medium, full sql.NullString
+		item := &types.MediaItem{LogID: &logId}
+
+		err := rows.Scan(
+			&item.ID,
+			&logId,
+			&item.Filename,
+			&item.FileType,
+			&item.Caption,
+			&item.Position,
+			&item.UploadedAt,
+			&item.Location,
+			&thumbnail,
+			&medium,
+			&full,
+		)
+		if err != nil {
+			return err
 		}
 
-		// If media ID is not nil, add media to log
-		if media.Filename != nil {
-			logs[logID].Media = append(logs[logID].Media, media)
+		if full.Valid {
+			item.Renditions = &types.Renditions{
+				Thumbnail: thumbnail.String,
+				Medium:    medium.String,
+				Full:      full.String,
+			}
 		}
-	}
 
-	// Convert map to slice
-	logSlice := make([]*types.Log, 0, len(logs))
-	for _, log := range logs {
-		logSlice = append(logSlice, log)
+		if l, ok := logs[logId]; ok {
+			l.Media = append(l.Media, item)
+		}
 	}
 
-	return logSlice, nil
+	return nil
 }
@@ -0,0 +1,25 @@
+package mailer
+
+import (
+	"log"
+
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/ZondaF12/logbook-backend/types"
+)
+
+// New returns the SMTP mailer when SMTP_HOST is configured. Otherwise mail is
+// kept in memory and logged, which is enough for local development.
+func New() types.Mailer {
+	if config.Envs.SMTPHost == "" {
+		log.Println("SMTP_HOST not set, emails will be logged instead of sent")
+		return NewMemoryMailer(true)
+	}
+
+	return NewSMTPMailer(
+		config.Envs.SMTPHost,
+		config.Envs.SMTPPort,
+		config.Envs.SMTPUser,
+		config.Envs.SMTPPassword,
+		config.Envs.MailFrom,
+	)
+}
@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"log"
+	"sync"
+
+	"github.com/ZondaF12/logbook-backend/types"
+)
+
+// MemoryMailer records emails instead of sending them. It is used in tests
+// and as the fallback when no SMTP server is configured.
+type MemoryMailer struct {
+	mu     sync.Mutex
+	sent   []types.Email
+	logged bool
+}
+
+func NewMemoryMailer(logged bool) *MemoryMailer {
+	return &MemoryMailer{logged: logged}
+}
+
+func (m *MemoryMailer) Send(email types.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, email)
+	if m.logged {
+		log.Printf("email to %s: %s\n%s", email.To, email.Subject, email.Body)
+	}
+
+	return nil
+}
+
+// Sent returns a copy of every email sent so far.
+func (m *MemoryMailer) Sent() []types.Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sent := make([]types.Email, len(m.sent))
+	copy(sent, m.sent)
+
+	return sent
+}
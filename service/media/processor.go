@@ -0,0 +1,257 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log"
+	"strings"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ErrNotImage is returned for files that can't be decoded as an image.
+var ErrNotImage = errors.New("file is not a supported image")
+
+const (
+	thumbnailSize = 320
+	mediumSize    = 1024
+	fullSize      = 2048
+
+	// maxPixels stops small files that decode into huge images from eating
+	// all the memory.
+	maxPixels = 40_000_000
+
+	jpegQuality = 85
+)
+
+// Processor stores resized renditions of uploaded images. Every rendition is
+// re-encoded as JPEG, which drops EXIF data such as where the photo was
+// taken.
+type Processor struct {
+	blobs types.BlobStore
+}
+
+func NewProcessor(blobs types.BlobStore) *Processor {
+	return &Processor{blobs: blobs}
+}
+
+// IsImage reports whether files of the content type should be processed.
+func IsImage(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/")
+}
+
+// Process decodes the image and stores its renditions under base. The
+// caller is responsible for not keeping the original.
+func (p *Processor) Process(ctx context.Context, base string, r io.Reader) (*types.Renditions, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("%w: image is too large", ErrNotImage)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	orientation := exifOrientation(data)
+
+	renditions := &types.Renditions{
+		Thumbnail: base + "/thumbnail.jpg",
+		Medium:    base + "/medium.jpg",
+		Full:      base + "/full.jpg",
+	}
+
+	sizes := []struct {
+		key  string
+		size int
+	}{
+		{renditions.Thumbnail, thumbnailSize},
+		{renditions.Medium, mediumSize},
+		{renditions.Full, fullSize},
+	}
+
+	stored := make([]string, 0, len(sizes))
+	for _, s := range sizes {
+		var buf bytes.Buffer
+		img := orient(resize(src, s.size), orientation)
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+
+		if _, err := p.blobs.Put(ctx, s.key, "image/jpeg", &buf, int64(buf.Len())); err != nil {
+			// Don't leave half the renditions behind
+			if err := p.blobs.Delete(ctx, stored, nil); err != nil {
+				log.Printf("error deleting renditions of %s: %v", base, err)
+			}
+			return nil, err
+		}
+		stored = append(stored, s.key)
+	}
+
+	return renditions, nil
+}
+
+// URLs resolves where each size of an image is served from. Media without
+// renditions falls back to its original location.
+func URLs(blobs types.BlobStore, location string, renditions *types.Renditions) types.ImageURLs {
+	if renditions == nil {
+		return types.ImageURLs{Full: location}
+	}
+
+	return types.ImageURLs{
+		Thumbnail: blobs.Location(renditions.Thumbnail),
+		Medium:    blobs.Location(renditions.Medium),
+		Full:      blobs.Location(renditions.Full),
+	}
+}
+
+// resize scales the image to fit a size x size box, never upscaling.
+// Transparent areas are flattened onto white as JPEG has no alpha.
+func resize(src image.Image, size int) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width > size || height > size {
+		if width >= height {
+			height = max(1, height*size/width)
+			width = size
+		} else {
+			width = max(1, width*size/height)
+			height = size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	return dst
+}
+
+// orient applies an EXIF orientation so the image displays upright once the
+// EXIF data is gone.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// Orientations 5 to 8 are rotated a quarter turn
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			}
+			dst.SetRGBA(dx, dy, src.RGBAAt(x, y))
+		}
+	}
+
+	return dst
+}
+
+// exifOrientation reads the orientation tag from a JPEG's EXIF segment,
+// returning 1 (upright) if there isn't one.
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(data[i+2])<<8 | int(data[i+3])
+
+		// The image data starts at the start of scan, EXIF comes before it
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var u16 func([]byte) int
+	var u32 func([]byte) int
+	switch string(tiff[:2]) {
+	case "II":
+		u16 = func(b []byte) int { return int(b[0]) | int(b[1])<<8 }
+		u32 = func(b []byte) int { return u16(b) | u16(b[2:])<<16 }
+	case "MM":
+		u16 = func(b []byte) int { return int(b[0])<<8 | int(b[1]) }
+		u32 = func(b []byte) int { return u16(b)<<16 | u16(b[2:]) }
+	default:
+		return 1
+	}
+
+	offset := u32(tiff[4:])
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+
+	count := u16(tiff[offset:])
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if u16(tiff[entry:]) == 0x0112 {
+			return u16(tiff[entry+8:])
+		}
+	}
+
+	return 1
+}
@@ -0,0 +1,88 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ZondaF12/logbook-backend/service/blob"
+)
+
+func TestProcess(t *testing.T) {
+	ctx := context.Background()
+
+	blobs, err := blob.NewLocalStore(t.TempDir(), "", "http://localhost:8080/blobs", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	processor := NewProcessor(blobs)
+
+	t.Run("should store upright renditions without EXIF data", func(t *testing.T) {
+		renditions, err := processor.Process(ctx, "vehicles/1/images/1", bytes.NewReader(rotatedJPEG(t, 600, 300)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sizes := map[string]image.Point{
+			renditions.Thumbnail: {160, 320},
+			renditions.Medium:    {300, 600},
+			renditions.Full:      {300, 600},
+		}
+
+		for key, size := range sizes {
+			body, err := blobs.Get(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(body)
+			body.Close()
+
+			if bytes.Contains(data, []byte("Exif")) || bytes.Contains(data, []byte("GPS")) {
+				t.Errorf("expected %s to have no EXIF data", key)
+			}
+
+			img, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := img.Bounds().Size(); got != size {
+				t.Errorf("expected %s to be %v, got %v", key, size, got)
+			}
+		}
+	})
+
+	t.Run("should reject files that aren't images", func(t *testing.T) {
+		_, err := processor.Process(ctx, "logbook/1/media/1", strings.NewReader("%PDF-1.7"))
+		if !errors.Is(err, ErrNotImage) {
+			t.Errorf("expected ErrNotImage, got %v", err)
+		}
+	})
+}
+
+// rotatedJPEG encodes a JPEG with an EXIF segment saying it has to be turned
+// a quarter clockwise, along with some GPS data.
+func rotatedJPEG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tiff := []byte{
+		'I', 'I', 0x2A, 0x00, 0x08, 0x00, 0x00, 0x00,
+		0x01, 0x00,
+		0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	payload := append(append([]byte("Exif\x00\x00"), tiff...), []byte("GPSLatitude 51.5")...)
+
+	segment := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	segment = append(segment, payload...)
+
+	data := buf.Bytes()
+	return append(append([]byte{0xFF, 0xD8}, segment...), data[2:]...)
+}
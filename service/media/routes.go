@@ -0,0 +1,366 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/privacy"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/ZondaF12/logbook-backend/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	store        types.MediaStore
+	userStore    types.UserStore
+	garageStore  types.GarageStore
+	logbookStore types.LogbookStore
+	policy       *privacy.Policy
+	blobs        types.BlobStore
+}
+
+func NewHandler(store types.MediaStore, userStore types.UserStore, garageStore types.GarageStore, logbookStore types.LogbookStore, policy *privacy.Policy, blobs types.BlobStore) *Handler {
+	return &Handler{
+		store:        store,
+		userStore:    userStore,
+		garageStore:  garageStore,
+		logbookStore: logbookStore,
+		policy:       policy,
+		blobs:        blobs,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *echo.Group) {
+	router.GET("/garage/vehicle/:id/media", auth.WithJWTAuth(h.HandleGetVehicleMedia, h.userStore, auth.RequireScope(auth.ScopeGarageRead)))
+	router.PUT("/garage/vehicle/:id/media/order", auth.WithJWTAuth(h.HandleReorderVehicleMedia, h.userStore, auth.RequireScope(auth.ScopeGarageWrite)))
+	router.PUT("/garage/vehicle/:id/cover", auth.WithJWTAuth(h.HandleSetVehicleCover, h.userStore, auth.RequireScope(auth.ScopeGarageWrite)))
+	router.PATCH("/garage/vehicle/:id/media/:mediaId", auth.WithJWTAuth(h.HandleUpdateVehicleMedia, h.userStore, auth.RequireScope(auth.ScopeGarageWrite)))
+	router.DELETE("/garage/vehicle/:id/media/:mediaId", auth.WithJWTAuth(h.HandleDeleteVehicleMedia, h.userStore, auth.RequireScope(auth.ScopeGarageWrite)))
+
+	router.GET("/log/:logId/media", auth.WithJWTAuth(h.HandleGetLogMedia, h.userStore, auth.RequireScope(auth.ScopeLogbookRead)))
+	router.PUT("/log/:logId/media/order", auth.WithJWTAuth(h.HandleReorderLogMedia, h.userStore, auth.RequireScope(auth.ScopeLogbookWrite)))
+	router.PATCH("/log/:logId/media/:mediaId", auth.WithJWTAuth(h.HandleUpdateLogMedia, h.userStore, auth.RequireScope(auth.ScopeLogbookWrite)))
+	router.DELETE("/log/:logId/media/:mediaId", auth.WithJWTAuth(h.HandleDeleteLogMedia, h.userStore, auth.RequireScope(auth.ScopeLogbookWrite)))
+}
+
+// parent is the vehicle or log media is attached to.
+type parent struct {
+	kind string
+	id   uuid.UUID
+}
+
+func (p parent) owns(item *types.MediaItem) bool {
+	if p.kind == types.UploadVehicleImage {
+		return item.VehicleID != nil && *item.VehicleID == p.id
+	}
+
+	return item.LogID != nil && *item.LogID == p.id
+}
+
+func (h *Handler) HandleGetVehicleMedia(c echo.Context) error {
+	p, err := h.vehicleAccess(c, false)
+	if err != nil {
+		return err
+	}
+
+	return h.list(c, p)
+}
+
+func (h *Handler) HandleReorderVehicleMedia(c echo.Context) error {
+	p, err := h.vehicleAccess(c, true)
+	if err != nil {
+		return err
+	}
+
+	return h.reorder(c, p)
+}
+
+func (h *Handler) HandleSetVehicleCover(c echo.Context) error {
+	p, err := h.vehicleAccess(c, true)
+	if err != nil {
+		return err
+	}
+
+	// Parse payload
+	var payload types.SetCoverPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	item, err := h.store.GetMediaByID(payload.MediaID)
+	if err != nil || !p.owns(item) {
+		return echo.NewHTTPError(http.StatusNotFound, "Media not found")
+	}
+
+	if !IsImage(item.FileType) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Only images can be the cover")
+	}
+
+	if err := h.store.SetVehicleCover(p.id, item.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, "Cover updated")
+}
+
+func (h *Handler) HandleUpdateVehicleMedia(c echo.Context) error {
+	p, err := h.vehicleAccess(c, true)
+	if err != nil {
+		return err
+	}
+
+	return h.update(c, p)
+}
+
+func (h *Handler) HandleDeleteVehicleMedia(c echo.Context) error {
+	p, err := h.vehicleAccess(c, true)
+	if err != nil {
+		return err
+	}
+
+	return h.delete(c, p)
+}
+
+func (h *Handler) HandleGetLogMedia(c echo.Context) error {
+	p, err := h.logAccess(c, false)
+	if err != nil {
+		return err
+	}
+
+	return h.list(c, p)
+}
+
+func (h *Handler) HandleReorderLogMedia(c echo.Context) error {
+	p, err := h.logAccess(c, true)
+	if err != nil {
+		return err
+	}
+
+	return h.reorder(c, p)
+}
+
+func (h *Handler) HandleUpdateLogMedia(c echo.Context) error {
+	p, err := h.logAccess(c, true)
+	if err != nil {
+		return err
+	}
+
+	return h.update(c, p)
+}
+
+func (h *Handler) HandleDeleteLogMedia(c echo.Context) error {
+	p, err := h.logAccess(c, true)
+	if err != nil {
+		return err
+	}
+
+	return h.delete(c, p)
+}
+
+func (h *Handler) list(c echo.Context, p parent) error {
+	items, err := h.items(p)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	for _, item := range items {
+		item.URLs = URLs(h.blobs, item.Location, item.Renditions)
+	}
+
+	return c.JSON(http.StatusOK, items)
+}
+
+func (h *Handler) reorder(c echo.Context, p parent) error {
+	// Parse payload
+	var payload types.ReorderMediaPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	items, err := h.items(p)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	// The order has to name every item exactly once, so positions can't be
+	// left over from before
+	remaining := make(map[uuid.UUID]bool, len(items))
+	for _, item := range items {
+		remaining[item.ID] = true
+	}
+	for _, id := range payload.MediaIDs {
+		if !remaining[id] {
+			return echo.NewHTTPError(http.StatusBadRequest, "Order must list each media item once")
+		}
+		delete(remaining, id)
+	}
+	if len(remaining) > 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Order must list each media item once")
+	}
+
+	if err := h.store.ReorderMedia(payload.MediaIDs); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, "Media reordered")
+}
+
+func (h *Handler) update(c echo.Context, p parent) error {
+	item, err := h.item(c, p)
+	if err != nil {
+		return err
+	}
+
+	// Parse payload
+	var payload types.UpdateMediaPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	if err := h.store.UpdateCaption(item.ID, *payload.Caption); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	item.Caption = *payload.Caption
+	item.URLs = URLs(h.blobs, item.Location, item.Renditions)
+
+	return c.JSON(http.StatusOK, item)
+}
+
+// delete removes the stored files first. If that fails the row is still
+// there, so deleting can be retried.
+func (h *Handler) delete(c echo.Context, p parent) error {
+	item, err := h.item(c, p)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{OriginalKey(p.kind, p.id, item.ID)}
+	if key := h.blobs.KeyFromLocation(item.Location); key != "" {
+		keys = append(keys, key)
+	}
+	if item.Renditions != nil {
+		keys = append(keys, item.Renditions.Thumbnail, item.Renditions.Medium, item.Renditions.Full)
+	}
+
+	if err := h.blobs.Delete(c.Request().Context(), keys, nil); err != nil {
+		log.Printf("error deleting media %s: %v", item.ID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Error deleting media")
+	}
+
+	if err := h.store.DeleteMedia(item.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, "Media deleted")
+}
+
+func (h *Handler) items(p parent) ([]*types.MediaItem, error) {
+	if p.kind == types.UploadVehicleImage {
+		return h.store.GetVehicleMedia(p.id)
+	}
+
+	return h.store.GetLogMedia(p.id)
+}
+
+// item gets the media item in the path, as long as it belongs to the parent.
+func (h *Handler) item(c echo.Context, p parent) (*types.MediaItem, error) {
+	id, err := uuid.Parse(c.Param("mediaId"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid media ID")
+	}
+
+	item, err := h.store.GetMediaByID(id)
+	if err != nil || !p.owns(item) {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Media not found")
+	}
+
+	return item, nil
+}
+
+func (h *Handler) vehicleAccess(c echo.Context, write bool) (parent, error) {
+	vehicleId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return parent{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid vehicle ID")
+	}
+
+	if err := h.checkVehicle(c, vehicleId, write); err != nil {
+		return parent{}, err
+	}
+
+	return parent{kind: types.UploadVehicleImage, id: vehicleId}, nil
+}
+
+func (h *Handler) logAccess(c echo.Context, write bool) (parent, error) {
+	logId, err := uuid.Parse(c.Param("logId"))
+	if err != nil {
+		return parent{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid log ID")
+	}
+
+	l, err := h.logbookStore.GetLogByID(logId)
+	if err != nil {
+		return parent{}, echo.NewHTTPError(http.StatusNotFound, "Log not found")
+	}
+
+	if err := h.checkVehicle(c, l.VehicleID, write); err != nil {
+		return parent{}, err
+	}
+
+	return parent{kind: types.UploadLogMedia, id: logId}, nil
+}
+
+// checkVehicle lets anyone who can see the vehicle read its media, only the
+// owner can change it.
+func (h *Handler) checkVehicle(c echo.Context, vehicleId uuid.UUID, write bool) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	vehicle, err := h.garageStore.GetVehicleByID(vehicleId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if vehicle.ID == uuid.Nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Vehicle not found")
+	}
+
+	if write {
+		if vehicle.UserID != userId {
+			return echo.NewHTTPError(http.StatusForbidden, "Not your vehicle")
+		}
+		return nil
+	}
+
+	err = h.policy.CanViewContent(userId, vehicle.UserID)
+	if errors.Is(err, privacy.ErrNotVisible) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
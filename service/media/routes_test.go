@@ -0,0 +1,295 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/blob"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestReorderVehicleMedia(t *testing.T) {
+	userId := uuid.New()
+	vehicleId := uuid.New()
+
+	store := newMockMediaStore()
+	first := store.add(vehicleId, "image/jpeg")
+	second := store.add(vehicleId, "image/jpeg")
+	handler, _ := newTestHandler(t, store, userId, vehicleId)
+
+	reorder := func(ids ...uuid.UUID) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(map[string]interface{}{"media_ids": ids})
+
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/garage/vehicle/%s/media/order", vehicleId), bytes.NewBuffer(marshalled))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userId))
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.PUT("/garage/vehicle/:id/media/order", handler.HandleReorderVehicleMedia)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should reject an order missing items", func(t *testing.T) {
+		rr := reorder(second.ID)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should reject an order with another vehicle's media", func(t *testing.T) {
+		other := store.add(uuid.New(), "image/jpeg")
+
+		rr := reorder(second.ID, first.ID, other.ID)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should reorder the media", func(t *testing.T) {
+		rr := reorder(second.ID, first.ID)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if second.Position != 0 || first.Position != 1 {
+			t.Errorf("unexpected positions %d and %d", second.Position, first.Position)
+		}
+	})
+}
+
+func TestSetVehicleCover(t *testing.T) {
+	userId := uuid.New()
+	vehicleId := uuid.New()
+
+	store := newMockMediaStore()
+	image := store.add(vehicleId, "image/jpeg")
+	document := store.add(vehicleId, "application/pdf")
+	handler, _ := newTestHandler(t, store, userId, vehicleId)
+
+	setCover := func(mediaId uuid.UUID) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(map[string]interface{}{"media_id": mediaId})
+
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/garage/vehicle/%s/cover", vehicleId), bytes.NewBuffer(marshalled))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userId))
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.PUT("/garage/vehicle/:id/cover", handler.HandleSetVehicleCover)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should only accept images", func(t *testing.T) {
+		rr := setCover(document.ID)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should set the cover", func(t *testing.T) {
+		rr := setCover(image.ID)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if !image.Cover || document.Cover {
+			t.Error("expected only the image to be the cover")
+		}
+	})
+}
+
+func TestDeleteVehicleMedia(t *testing.T) {
+	userId := uuid.New()
+	vehicleId := uuid.New()
+	otherVehicleId := uuid.New()
+	ctx := context.Background()
+
+	store := newMockMediaStore()
+	handler, blobs := newTestHandler(t, store, userId, vehicleId)
+	handler.garageStore.(*mockGarageStore).vehicles[otherVehicleId] = &types.Vehicle{ID: otherVehicleId, UserID: uuid.New()}
+
+	item := store.add(vehicleId, "image/jpeg")
+	renditions, err := NewProcessor(blobs).Process(ctx, Key(types.UploadVehicleImage, vehicleId, item.ID), bytes.NewReader(rotatedJPEG(t, 40, 30)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.Renditions = renditions
+	item.Location = blobs.Location(renditions.Full)
+
+	remove := func(vehicleId, mediaId uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/garage/vehicle/%s/media/%s", vehicleId, mediaId), nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userId))
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.DELETE("/garage/vehicle/:id/media/:mediaId", handler.HandleDeleteVehicleMedia)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should not delete from another user's vehicle", func(t *testing.T) {
+		other := store.add(otherVehicleId, "image/jpeg")
+
+		rr := remove(otherVehicleId, other.ID)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should not delete media through another vehicle", func(t *testing.T) {
+		other := store.add(uuid.New(), "image/jpeg")
+
+		rr := remove(vehicleId, other.ID)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should delete the media and its files", func(t *testing.T) {
+		rr := remove(vehicleId, item.ID)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if _, ok := store.items[item.ID]; ok {
+			t.Error("expected the media to be deleted")
+		}
+
+		for _, key := range []string{renditions.Thumbnail, renditions.Medium, renditions.Full} {
+			if _, err := blobs.Stat(ctx, key); err != blob.ErrNotFound {
+				t.Errorf("expected %s to be deleted, got %v", key, err)
+			}
+		}
+	})
+}
+
+func newTestHandler(t *testing.T, store *mockMediaStore, userId, vehicleId uuid.UUID) (*Handler, *blob.LocalStore) {
+	blobs, err := blob.NewLocalStore(t.TempDir(), "", "http://localhost:8080/blobs", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	garage := &mockGarageStore{vehicles: map[uuid.UUID]*types.Vehicle{
+		vehicleId: {ID: vehicleId, UserID: userId},
+	}}
+
+	return NewHandler(store, nil, garage, nil, nil, blobs), blobs
+}
+
+type mockMediaStore struct {
+	items map[uuid.UUID]*types.MediaItem
+}
+
+func newMockMediaStore() *mockMediaStore {
+	return &mockMediaStore{items: make(map[uuid.UUID]*types.MediaItem)}
+}
+
+func (m *mockMediaStore) add(vehicleId uuid.UUID, fileType string) *types.MediaItem {
+	item := &types.MediaItem{ID: uuid.New(), VehicleID: &vehicleId, FileType: fileType, Position: len(m.items)}
+	m.items[item.ID] = item
+	return item
+}
+
+func (m *mockMediaStore) AddNewVehicleMedia(media types.Media) error {
+	return nil
+}
+
+func (m *mockMediaStore) AddNewLogMedia(media types.Media) error {
+	return nil
+}
+
+func (m *mockMediaStore) GetMediaByID(id uuid.UUID) (*types.MediaItem, error) {
+	item, ok := m.items[id]
+	if !ok {
+		return nil, fmt.Errorf("media not found")
+	}
+	return item, nil
+}
+
+func (m *mockMediaStore) GetVehicleMedia(vehicleId uuid.UUID) ([]*types.MediaItem, error) {
+	items := make([]*types.MediaItem, 0)
+	for _, item := range m.items {
+		if item.VehicleID != nil && *item.VehicleID == vehicleId {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Position < items[j].Position })
+	return items, nil
+}
+
+func (m *mockMediaStore) GetLogMedia(logId uuid.UUID) ([]*types.MediaItem, error) {
+	return []*types.MediaItem{}, nil
+}
+
+func (m *mockMediaStore) ReorderMedia(ids []uuid.UUID) error {
+	for position, id := range ids {
+		m.items[id].Position = position
+	}
+	return nil
+}
+
+func (m *mockMediaStore) SetVehicleCover(vehicleId, mediaId uuid.UUID) error {
+	for _, item := range m.items {
+		if item.VehicleID != nil && *item.VehicleID == vehicleId {
+			item.Cover = item.ID == mediaId
+		}
+	}
+	return nil
+}
+
+func (m *mockMediaStore) UpdateCaption(id uuid.UUID, caption string) error {
+	m.items[id].Caption = caption
+	return nil
+}
+
+func (m *mockMediaStore) DeleteMedia(id uuid.UUID) error {
+	delete(m.items, id)
+	return nil
+}
+
+type mockGarageStore struct {
+	vehicles map[uuid.UUID]*types.Vehicle
+}
+
+func (m *mockGarageStore) GetVehicleByID(id uuid.UUID) (*types.Vehicle, error) {
+	if vehicle, ok := m.vehicles[id]; ok {
+		return vehicle, nil
+	}
+	return &types.Vehicle{}, nil
+}
+
+func (m *mockGarageStore) GetAuthenticatedUserVehicles(userID uuid.UUID) ([]*types.Vehicle, error) {
+	return nil, nil
+}
+
+func (m *mockGarageStore) GetVehicleByRegistration(userId uuid.UUID, registration string) (*types.Vehicle, error) {
+	return nil, nil
+}
+
+func (m *mockGarageStore) AddUserVehicle(userID uuid.UUID, vehicle types.NewVehiclePostData) (uuid.UUID, error) {
+	return uuid.Nil, nil
+}
+
+func (m *mockGarageStore) CheckVehicleAdded(userId uuid.UUID, registration string) (bool, error) {
+	return false, nil
+}
+
+func (m *mockGarageStore) UpdateVehicle(userId uuid.UUID, registration string, data types.UpdateVehiclePatchData) error {
+	return nil
+}
@@ -2,6 +2,7 @@ package media
 
 import (
 	"database/sql"
+	"fmt"
 
 	"github.com/ZondaF12/logbook-backend/types"
 	"github.com/google/uuid"
@@ -18,10 +19,13 @@ func NewStore(db *sql.DB) *Store {
 }
 
 func (s *Store) AddNewVehicleMedia(media types.Media) error {
+	thumbnail, medium, full := renditionKeys(media.Renditions)
+
+	// New media goes after the existing items
 	_, err := s.db.Exec(`
-		INSERT INTO media (id, filename, file_type, s3_location, vehicle_id)
-		VALUES (?, ?, ?, ?, ?)`,
-		uuid.New(), media.Filename, media.FileType, media.S3Location, media.VehicleID,
+		INSERT INTO media (id, filename, file_type, s3_location, vehicle_id, user_id, thumbnail_key, medium_key, full_key, position)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(MAX(position) + 1, 0) FROM media WHERE vehicle_id = ?`,
+		media.ID, media.Filename, media.FileType, media.S3Location, media.VehicleID, media.UserID, thumbnail, medium, full, media.VehicleID,
 	)
 	if err != nil {
 		return err
@@ -31,10 +35,12 @@ func (s *Store) AddNewVehicleMedia(media types.Media) error {
 }
 
 func (s *Store) AddNewLogMedia(media types.Media) error {
+	thumbnail, medium, full := renditionKeys(media.Renditions)
+
 	_, err := s.db.Exec(`
-		INSERT INTO media (id, filename, file_type, s3_location, log_id)
-		VALUES (?, ?, ?, ?, ?)`,
-		uuid.New(), media.Filename, media.FileType, media.S3Location, media.LogID,
+		INSERT INTO media (id, filename, file_type, s3_location, log_id, user_id, thumbnail_key, medium_key, full_key, position)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(MAX(position) + 1, 0) FROM media WHERE log_id = ?`,
+		media.ID, media.Filename, media.FileType, media.S3Location, media.LogID, media.UserID, thumbnail, medium, full, media.LogID,
 	)
 	if err != nil {
 		return err
@@ -42,3 +48,122 @@ func (s *Store) AddNewLogMedia(media types.Media) error {
 
 	return nil
 }
+
+// renditionKeys leaves the columns NULL for media without renditions.
+func renditionKeys(r *types.Renditions) (thumbnail, medium, full *string) {
+	if r == nil {
+		return nil, nil, nil
+	}
+
+	return &r.Thumbnail, &r.Medium, &r.Full
+}
+
+const mediaItemColumns = `
+	id, vehicle_id, log_id, filename, file_type, caption, position, cover, uploaded_at,
+	s3_location, thumbnail_key, medium_key, full_key`
+
+func scanRowIntoMediaItem(rows *sql.Rows) (*types.MediaItem, error) {
+	item := new(types.MediaItem)
+	var thumbnail, medium, full sql.NullString
+
+	err := rows.Scan(
+		&item.ID,
+		&item.VehicleID,
+		&item.LogID,
+		&item.Filename,
+		&item.FileType,
+		&item.Caption,
+		&item.Position,
+		&item.Cover,
+		&item.UploadedAt,
+		&item.Location,
+		&thumbnail,
+		&medium,
+		&full,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if full.Valid {
+		item.Renditions = &types.Renditions{
+			Thumbnail: thumbnail.String,
+			Medium:    medium.String,
+			Full:      full.String,
+		}
+	}
+
+	return item, nil
+}
+
+func (s *Store) getMediaItems(query string, args ...interface{}) ([]*types.MediaItem, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*types.MediaItem, 0)
+	for rows.Next() {
+		item, err := scanRowIntoMediaItem(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func (s *Store) GetMediaByID(id uuid.UUID) (*types.MediaItem, error) {
+	items, err := s.getMediaItems("SELECT"+mediaItemColumns+" FROM media WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("media not found")
+	}
+
+	return items[0], nil
+}
+
+func (s *Store) GetVehicleMedia(vehicleId uuid.UUID) ([]*types.MediaItem, error) {
+	return s.getMediaItems("SELECT"+mediaItemColumns+" FROM media WHERE vehicle_id = ? ORDER BY position, uploaded_at", vehicleId)
+}
+
+func (s *Store) GetLogMedia(logId uuid.UUID) ([]*types.MediaItem, error) {
+	return s.getMediaItems("SELECT"+mediaItemColumns+" FROM media WHERE log_id = ? ORDER BY position, uploaded_at", logId)
+}
+
+func (s *Store) ReorderMedia(ids []uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for position, id := range ids {
+		if _, err := tx.Exec("UPDATE media SET position = ? WHERE id = ?", position, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) SetVehicleCover(vehicleId, mediaId uuid.UUID) error {
+	_, err := s.db.Exec("UPDATE media SET cover = (id = ?) WHERE vehicle_id = ?", mediaId, vehicleId)
+	return err
+}
+
+func (s *Store) UpdateCaption(id uuid.UUID, caption string) error {
+	_, err := s.db.Exec("UPDATE media SET caption = ? WHERE id = ?", caption, id)
+	return err
+}
+
+func (s *Store) DeleteMedia(id uuid.UUID) error {
+	_, err := s.db.Exec("DELETE FROM media WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,202 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const maxFilenameLength = 255
+
+// multipartOverhead is room for the boundaries, part headers and any other
+// form fields sent along with a file.
+const multipartOverhead = 1 << 20
+
+// allowedTypes lists the content types each kind of upload accepts.
+var allowedTypes = map[string][]string{
+	types.UploadVehicleImage: {"image/jpeg", "image/png", "image/webp"},
+	types.UploadLogMedia:     {"image/jpeg", "image/png", "image/webp", "application/pdf"},
+	types.UploadAvatar:       {"image/jpeg", "image/png", "image/webp"},
+}
+
+// MaxSize is the largest file allowed for the kind of upload.
+func MaxSize(kind string) int64 {
+	switch kind {
+	case types.UploadAvatar:
+		return config.Envs.UploadAvatarMaxSize
+	case types.UploadVehicleImage:
+		return config.Envs.UploadVehicleImageMaxSize
+	case types.UploadLogMedia:
+		return config.Envs.UploadLogMediaMaxSize
+	}
+
+	return 0
+}
+
+// CheckType rejects content types the kind of upload doesn't accept.
+func CheckType(kind, contentType string) error {
+	for _, t := range allowedTypes[kind] {
+		if t == contentType {
+			return nil
+		}
+	}
+
+	return echo.NewHTTPError(http.StatusUnsupportedMediaType, fmt.Sprintf("File type %s is not allowed", contentType))
+}
+
+// CheckSize rejects empty files and files over the kind's limit.
+func CheckSize(kind string, size int64) error {
+	if size <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "File is empty")
+	}
+
+	if size > MaxSize(kind) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("File is larger than %d bytes", MaxSize(kind)))
+	}
+
+	return nil
+}
+
+// DetectType sniffs the content type from the first bytes of a file, without
+// any parameters such as the charset.
+func DetectType(head []byte) string {
+	contentType, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	return contentType
+}
+
+// SanitizeFilename keeps the base name of a client supplied filename with
+// control and quoting characters removed. Filenames are only ever shown back
+// to users, storage keys never include them.
+func SanitizeFilename(name string) (string, error) {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+
+	name = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) || strings.ContainsRune(`"<>:|?*`, r) {
+			return -1
+		}
+		return r
+	}, name)
+
+	// Leading dots would make it a hidden file once downloaded
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if name == "" || name == "/" {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "Invalid filename")
+	}
+
+	for len(name) > maxFilenameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	return name, nil
+}
+
+// Key is where media is stored. It is built from IDs only, so uploads never
+// overwrite each other whatever the client calls the file.
+func Key(kind string, targetId, mediaId uuid.UUID) string {
+	switch kind {
+	case types.UploadVehicleImage:
+		return fmt.Sprintf("vehicles/%s/images/%s", targetId, mediaId)
+	case types.UploadLogMedia:
+		return fmt.Sprintf("logbook/%s/media/%s", targetId, mediaId)
+	}
+
+	return fmt.Sprintf("avatars/user/%s/%s", targetId, mediaId)
+}
+
+// OriginalKey is where a file is kept as uploaded. Vehicle and log media keep
+// it apart from the renditions stored under their key.
+func OriginalKey(kind string, targetId, mediaId uuid.UUID) string {
+	if kind == types.UploadAvatar {
+		return Key(kind, targetId, mediaId)
+	}
+
+	return Key(kind, targetId, mediaId) + "/original"
+}
+
+// File is an uploaded file that passed validation. Its content type is
+// sniffed from the contents rather than taken from the client.
+type File struct {
+	io.Reader
+	io.Closer
+
+	Filename    string
+	ContentType string
+	Size        int64
+}
+
+// FormFile opens the multipart file in field and checks it is acceptable for
+// the kind of upload. The caller has to close the file.
+func FormFile(c echo.Context, field, kind string) (*File, error) {
+	// Parsing the form reads the whole body, so stop once it can no longer
+	// hold a file within the limit
+	req := c.Request()
+	if req.Body != nil {
+		req.Body = http.MaxBytesReader(c.Response(), req.Body, MaxSize(kind)+multipartOverhead)
+	}
+
+	header, err := c.FormFile(field)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("File is larger than %d bytes", MaxSize(kind)))
+	}
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Missing %s file", field))
+	}
+
+	if err := CheckSize(kind, header.Size); err != nil {
+		return nil, err
+	}
+
+	filename, err := SanitizeFilename(header.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := header.Open()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Could not read file")
+	}
+
+	file, err := sniff(src, header)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	file.Filename = filename
+
+	if err := CheckType(kind, file.ContentType); err != nil {
+		src.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func sniff(src multipart.File, header *multipart.FileHeader) (*File, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Could not read file")
+	}
+	head = head[:n]
+
+	return &File{
+		Reader:      io.MultiReader(bytes.NewReader(head), io.LimitReader(src, header.Size-int64(n))),
+		Closer:      src,
+		ContentType: DetectType(head),
+		Size:        header.Size,
+	}, nil
+}
@@ -0,0 +1,147 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"car.jpg", "car.jpg"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\me\car.png`, "car.png"},
+		{".htaccess", "htaccess"},
+		{"bad\"name\r\n.png", "badname.png"},
+		{"  spaced.png  ", "spaced.png"},
+		{strings.Repeat("a", 300) + ".png", strings.Repeat("a", 255)},
+	}
+
+	for _, tt := range tests {
+		got, err := SanitizeFilename(tt.name)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", tt.name, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("expected %q to become %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+
+	for _, name := range []string{"", "..", "/", "\x00"} {
+		if _, err := SanitizeFilename(name); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+}
+
+func TestFormFile(t *testing.T) {
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+
+	open := func(filename, contentType string, data []byte) (*File, error) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="avatar"; filename="`+filename+`"`)
+		header.Set("Content-Type", contentType)
+		part, _ := writer.CreatePart(header)
+		part.Write(data)
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/self/avatar", &body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+
+		return FormFile(echo.New().NewContext(req, httptest.NewRecorder()), "avatar", types.UploadAvatar)
+	}
+
+	status := func(err error) int {
+		if httpErr, ok := err.(*echo.HTTPError); ok {
+			return httpErr.Code
+		}
+		return 0
+	}
+
+	t.Run("should sniff the type rather than trust the client", func(t *testing.T) {
+		file, err := open("avatar.txt", "text/plain", pngData.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		if file.ContentType != "image/png" {
+			t.Errorf("expected image/png, got %s", file.ContentType)
+		}
+
+		data, _ := io.ReadAll(file)
+		if !bytes.Equal(data, pngData.Bytes()) {
+			t.Error("expected the whole file to be readable after sniffing")
+		}
+	})
+
+	t.Run("should reject a type the kind doesn't allow", func(t *testing.T) {
+		_, err := open("avatar.png", "image/png", []byte("<html><script>alert(1)</script></html>"))
+		if status(err) != http.StatusUnsupportedMediaType {
+			t.Errorf("expected status code %d, got %v", http.StatusUnsupportedMediaType, err)
+		}
+	})
+
+	t.Run("should reject a file over the kind's limit", func(t *testing.T) {
+		limit := config.Envs.UploadAvatarMaxSize
+		config.Envs.UploadAvatarMaxSize = 10
+		defer func() { config.Envs.UploadAvatarMaxSize = limit }()
+
+		_, err := open("avatar.png", "image/png", pngData.Bytes())
+		if status(err) != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status code %d, got %v", http.StatusRequestEntityTooLarge, err)
+		}
+	})
+
+	t.Run("should stop reading a body that is too large", func(t *testing.T) {
+		limit := config.Envs.UploadAvatarMaxSize
+		config.Envs.UploadAvatarMaxSize = 10
+		defer func() { config.Envs.UploadAvatarMaxSize = limit }()
+
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, _ := writer.CreateFormFile("avatar", "avatar.png")
+		part.Write(make([]byte, 4*multipartOverhead))
+		writer.Close()
+
+		size := body.Len()
+		req := httptest.NewRequest(http.MethodPost, "/self/avatar", &body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+
+		_, err := FormFile(echo.New().NewContext(req, httptest.NewRecorder()), "avatar", types.UploadAvatar)
+		if status(err) != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status code %d, got %v", http.StatusRequestEntityTooLarge, err)
+		}
+
+		if read := size - body.Len(); read > 2*multipartOverhead {
+			t.Errorf("expected the body to be cut off, read %d of %d bytes", read, size)
+		}
+	})
+
+	t.Run("should reject a missing file", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/self/avatar", nil)
+		_, err := FormFile(echo.New().NewContext(req, httptest.NewRecorder()), "avatar", types.UploadAvatar)
+		if status(err) != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %v", http.StatusBadRequest, err)
+		}
+	})
+}
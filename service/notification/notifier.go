@@ -0,0 +1,91 @@
+package notification
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+// Notifier stores notifications the recipient wants. Notifications about
+// yourself, from users you muted or blocked, and of types you turned off are
+// dropped. Stored notifications are pushed to the recipient's connected
+// clients through the hub.
+type Notifier struct {
+	store    types.NotificationStore
+	safety   types.SafetyStore
+	profiles types.ProfileStore
+	hub      types.Hub
+}
+
+func NewNotifier(store types.NotificationStore, safety types.SafetyStore, profiles types.ProfileStore, hub types.Hub) *Notifier {
+	return &Notifier{
+		store:    store,
+		safety:   safety,
+		profiles: profiles,
+		hub:      hub,
+	}
+}
+
+func (n *Notifier) Notify(notification types.Notification) {
+	deliver, err := n.wanted(notification)
+	if err != nil {
+		log.Printf("error checking %s notification for user %s: %v", notification.Type, notification.UserID, err)
+		return
+	}
+
+	if !deliver {
+		return
+	}
+
+	if notification.ID == uuid.Nil {
+		notification.ID = uuid.New()
+	}
+	notification.CreatedAt = time.Now()
+
+	created, err := n.store.CreateNotification(notification)
+	if err != nil {
+		log.Printf("error creating %s notification for user %s: %v", notification.Type, notification.UserID, err)
+		return
+	}
+
+	if !created {
+		return
+	}
+
+	// Pushed notifications look the same as listed ones
+	if notification.ActorID != nil {
+		if p, err := n.profiles.GetProfileByUserId(*notification.ActorID); err == nil {
+			notification.Actor = p.Summary()
+		}
+	}
+
+	n.hub.Publish(notification.UserID, types.EventNotification, notification)
+}
+
+func (n *Notifier) wanted(notification types.Notification) (bool, error) {
+	if actor := notification.ActorID; actor != nil {
+		if *actor == notification.UserID {
+			return false, nil
+		}
+
+		blocked, err := n.safety.IsBlocked(notification.UserID, *actor)
+		if err != nil || blocked {
+			return false, err
+		}
+
+		muted, err := n.safety.GetMutedUserIDs(notification.UserID)
+		if err != nil || slices.Contains(muted, *actor) {
+			return false, err
+		}
+	}
+
+	preferences, err := n.store.GetPreferences(notification.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	return preferences[notification.Type], nil
+}
@@ -0,0 +1,208 @@
+package notification
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+func TestNotify(t *testing.T) {
+	userId := uuid.New()
+	actorId := uuid.New()
+	mutedId := uuid.New()
+	blockedId := uuid.New()
+
+	store := &mockNotificationStore{preferences: map[string]bool{types.NotificationLike: false}}
+	safety := &mockSafetyStore{
+		blocked: map[uuid.UUID]bool{blockedId: true},
+		muted:   []uuid.UUID{mutedId},
+	}
+	hub := &mockHub{}
+	notifier := NewNotifier(store, safety, &mockProfileStore{}, hub)
+
+	tests := []struct {
+		name      string
+		actorId   uuid.UUID
+		notifType string
+		delivered bool
+	}{
+		{"should deliver a follow", actorId, types.NotificationFollow, true},
+		{"should drop notifications about yourself", userId, types.NotificationFollow, false},
+		{"should drop notifications from muted users", mutedId, types.NotificationComment, false},
+		{"should drop notifications from blocked users", blockedId, types.NotificationComment, false},
+		{"should drop types the user turned off", actorId, types.NotificationLike, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.created = nil
+			hub.published = nil
+			actor := tt.actorId
+
+			notifier.Notify(types.Notification{UserID: userId, ActorID: &actor, Type: tt.notifType})
+
+			if delivered := len(store.created) == 1; delivered != tt.delivered {
+				t.Errorf("expected delivered to be %v, got %v", tt.delivered, delivered)
+			}
+
+			if pushed := len(hub.published) == 1; pushed != tt.delivered {
+				t.Errorf("expected pushed to be %v, got %v", tt.delivered, pushed)
+			}
+		})
+	}
+
+	t.Run("should deliver reminders without an actor", func(t *testing.T) {
+		store.created = nil
+
+		notifier.Notify(types.Notification{UserID: userId, Type: types.NotificationVehicleReminder})
+
+		if len(store.created) != 1 || store.created[0].ID == uuid.Nil {
+			t.Error("expected the reminder to be stored with an ID")
+		}
+	})
+}
+
+func TestDueReminders(t *testing.T) {
+	now := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	vehicle := &types.Vehicle{
+		ID:            uuid.New(),
+		UserID:        uuid.New(),
+		Registration:  "AB12CDE",
+		TaxDate:       "2024-06-01",
+		MotDate:       "2024-06-10",
+		InsuranceDate: "2024-05-31",
+		ServiceDate:   "",
+	}
+
+	reminders := DueReminders(vehicle, now, 7*24*time.Hour)
+	if len(reminders) != 1 {
+		t.Fatalf("expected 1 reminder, got %d", len(reminders))
+	}
+
+	if reminders[0].Message != "Tax for AB12CDE is due on 2024-06-01" {
+		t.Errorf("unexpected message %q", reminders[0].Message)
+	}
+
+	// The MOT comes into range later on
+	reminders = DueReminders(vehicle, now.Add(3*24*time.Hour), 7*24*time.Hour)
+	if len(reminders) != 1 || *reminders[0].DedupeKey != "reminder:mot:"+vehicle.ID.String()+":2024-06-10" {
+		t.Errorf("expected only the MOT reminder, got %d reminders", len(reminders))
+	}
+}
+
+type mockNotificationStore struct {
+	created     []types.Notification
+	preferences map[string]bool
+}
+
+func (m *mockNotificationStore) CreateNotification(n types.Notification) (bool, error) {
+	m.created = append(m.created, n)
+	return true, nil
+}
+
+func (m *mockNotificationStore) GetNotifications(userId uuid.UUID, page types.PageRequest) ([]*types.Notification, error) {
+	return nil, nil
+}
+
+func (m *mockNotificationStore) CountUnread(userId uuid.UUID) (int, error) {
+	return 0, nil
+}
+
+func (m *mockNotificationStore) MarkRead(id, userId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockNotificationStore) MarkAllRead(userId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockNotificationStore) GetPreferences(userId uuid.UUID) (map[string]bool, error) {
+	preferences := make(map[string]bool)
+	for _, t := range types.NotificationTypes {
+		enabled, ok := m.preferences[t]
+		preferences[t] = !ok || enabled
+	}
+
+	return preferences, nil
+}
+
+func (m *mockNotificationStore) SetPreferences(userId uuid.UUID, preferences map[string]bool) error {
+	return nil
+}
+
+func (m *mockNotificationStore) GetVehicleReminderDates() ([]*types.Vehicle, error) {
+	return nil, nil
+}
+
+type mockHub struct {
+	published []types.Notification
+}
+
+func (m *mockHub) Publish(userId uuid.UUID, eventType string, data any) {
+	m.published = append(m.published, data.(types.Notification))
+}
+
+func (m *mockHub) Subscribe(userId uuid.UUID, lastEventId string) (<-chan types.Event, func()) {
+	return nil, func() {}
+}
+
+type mockProfileStore struct{}
+
+func (m *mockProfileStore) GetProfileByUserId(userId uuid.UUID) (*types.Profile, error) {
+	return &types.Profile{UserID: userId, Username: "actor"}, nil
+}
+
+func (m *mockProfileStore) CreateProfile(types.Profile) error {
+	return nil
+}
+
+func (m *mockProfileStore) UpdateAvatar(userId uuid.UUID, avatar string) error {
+	return nil
+}
+
+func (m *mockProfileStore) IsUsernameAvailable(username string, userId uuid.UUID) (bool, error) {
+	return true, nil
+}
+
+func (m *mockProfileStore) UpdateProfile(userId uuid.UUID, payload types.UpdateProfilePayload, reserveOldUntil time.Time) error {
+	return nil
+}
+
+type mockSafetyStore struct {
+	blocked map[uuid.UUID]bool
+	muted   []uuid.UUID
+}
+
+func (m *mockSafetyStore) BlockUser(blockerId, blockedId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockSafetyStore) UnblockUser(blockerId, blockedId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockSafetyStore) IsBlocked(userId, otherId uuid.UUID) (bool, error) {
+	return m.blocked[otherId], nil
+}
+
+func (m *mockSafetyStore) GetBlockedUsers(userId uuid.UUID) ([]*types.UserRelation, error) {
+	return nil, nil
+}
+
+func (m *mockSafetyStore) MuteUser(muterId, mutedId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockSafetyStore) UnmuteUser(muterId, mutedId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockSafetyStore) GetMutedUsers(userId uuid.UUID) ([]*types.UserRelation, error) {
+	return nil, nil
+}
+
+func (m *mockSafetyStore) GetMutedUserIDs(userId uuid.UUID) ([]uuid.UUID, error) {
+	return m.muted, nil
+}
@@ -0,0 +1,107 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+)
+
+// dateLayout is the format vehicle due dates are stored in.
+const dateLayout = "2006-01-02"
+
+// Reminder notifies owners when a vehicle's tax, MOT, insurance or service
+// falls due within the lead time. Each due date is only notified once.
+type Reminder struct {
+	store    types.NotificationStore
+	notifier types.Notifier
+	lead     time.Duration
+}
+
+func NewReminder(store types.NotificationStore, notifier types.Notifier, lead time.Duration) *Reminder {
+	return &Reminder{
+		store:    store,
+		notifier: notifier,
+		lead:     lead,
+	}
+}
+
+// Run sends due reminders every interval until ctx is cancelled.
+func (r *Reminder) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.SendDue(time.Now()); err != nil {
+			log.Printf("error sending vehicle reminders: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Reminder) SendDue(now time.Time) error {
+	vehicles, err := r.store.GetVehicleReminderDates()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range vehicles {
+		for _, n := range DueReminders(v, now, r.lead) {
+			r.notifier.Notify(n)
+		}
+	}
+
+	return nil
+}
+
+// DueReminders returns a notification for every date on the vehicle that
+// falls between now and now+lead.
+func DueReminders(v *types.Vehicle, now time.Time, lead time.Duration) []types.Notification {
+	dates := []struct {
+		key   string
+		label string
+		date  string
+	}{
+		{"tax", "Tax", v.TaxDate},
+		{"mot", "MOT", v.MotDate},
+		{"insurance", "Insurance", v.InsuranceDate},
+		{"service", "Service", v.ServiceDate},
+	}
+
+	name := v.Registration
+	if v.Nickname != "" {
+		name = v.Nickname
+	}
+
+	// Dates have no time or zone, so compare against the start of today
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	reminders := make([]types.Notification, 0)
+	for _, d := range dates {
+		due, err := time.Parse(dateLayout, d.date)
+		if err != nil || due.Before(today) || due.After(now.Add(lead)) {
+			continue
+		}
+
+		// The date is part of the key so the next renewal is reminded again
+		key := fmt.Sprintf("reminder:%s:%s:%s", d.key, v.ID, d.date)
+		vehicleId := v.ID
+
+		reminders = append(reminders, types.Notification{
+			UserID:    v.UserID,
+			Type:      types.NotificationVehicleReminder,
+			SubjectID: &vehicleId,
+			Message:   fmt.Sprintf("%s for %s is due on %s", d.label, name, d.date),
+			DedupeKey: &key,
+		})
+	}
+
+	return reminders
+}
@@ -0,0 +1,137 @@
+package notification
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/ZondaF12/logbook-backend/utils"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	store     types.NotificationStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.NotificationStore, userStore types.UserStore) *Handler {
+	return &Handler{
+		store:     store,
+		userStore: userStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *echo.Group) {
+	router.GET("/notifications", auth.WithJWTAuth(h.HandleGetNotifications, h.userStore))
+	router.GET("/notifications/unread", auth.WithJWTAuth(h.HandleGetUnreadCount, h.userStore))
+	router.POST("/notifications/read", auth.WithJWTAuth(h.HandleMarkAllRead, h.userStore))
+	router.POST("/notifications/:id/read", auth.WithJWTAuth(h.HandleMarkRead, h.userStore))
+	router.GET("/notifications/preferences", auth.WithJWTAuth(h.HandleGetPreferences, h.userStore))
+	router.PATCH("/notifications/preferences", auth.WithJWTAuth(h.HandleUpdatePreferences, h.userStore))
+}
+
+func (h *Handler) HandleGetNotifications(c echo.Context) error {
+	page, err := utils.ParsePage(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	notifications, err := h.store.GetNotifications(userId, *page)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, utils.NewPage(notifications, page.Limit, func(n *types.Notification) types.Cursor {
+		return types.Cursor{CreatedAt: n.CreatedAt, ID: n.ID}
+	}))
+}
+
+func (h *Handler) HandleGetUnreadCount(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	count, err := h.store.CountUnread(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]int{"unread": count})
+}
+
+func (h *Handler) HandleMarkRead(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid notification ID")
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	if err := h.store.MarkRead(id, userId); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Notification marked as read")
+}
+
+func (h *Handler) HandleMarkAllRead(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	if err := h.store.MarkAllRead(userId); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, "All notifications marked as read")
+}
+
+func (h *Handler) HandleGetPreferences(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	preferences, err := h.store.GetPreferences(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, preferences)
+}
+
+func (h *Handler) HandleUpdatePreferences(c echo.Context) error {
+	// Parse payload
+	var payload map[string]bool
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if len(payload) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "No preferences to update")
+	}
+
+	for t := range payload {
+		if !slices.Contains(types.NotificationTypes, t) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Unknown notification type %s", t))
+		}
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	if err := h.store.SetPreferences(userId, payload); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	preferences, err := h.store.GetPreferences(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, preferences)
+}
@@ -0,0 +1,232 @@
+package notification
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/ZondaF12/logbook-backend/utils"
+	"github.com/google/uuid"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) CreateNotification(n types.Notification) (bool, error) {
+	res, err := s.db.Exec(`
+		INSERT IGNORE INTO notifications (id, user_id, actor_id, type, subject_id, message, dedupe_key, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		n.ID, n.UserID, n.ActorID, n.Type, n.SubjectID, n.Message, n.DedupeKey, n.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (s *Store) GetNotifications(userId uuid.UUID, page types.PageRequest) ([]*types.Notification, error) {
+	query := `
+		SELECT
+			n.id,
+			n.user_id,
+			n.actor_id,
+			n.type,
+			n.subject_id,
+			n.message,
+			n.created_at,
+			n.read_at,
+			` + utils.ProfileSummaryColumns + `
+		FROM notifications n
+		LEFT JOIN profiles p ON p.user_id = n.actor_id
+		WHERE n.user_id = ?
+			AND (n.actor_id IS NULL OR NOT EXISTS(
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = ? AND b.blocked_id = n.actor_id) OR (b.blocker_id = n.actor_id AND b.blocked_id = ?)
+			))`
+	args := []interface{}{userId, userId, userId}
+
+	if page.After != nil {
+		query += " AND (n.created_at < ? OR (n.created_at = ? AND n.id < ?))"
+		args = append(args, page.After.CreatedAt, page.After.CreatedAt, page.After.ID)
+	}
+
+	query += " ORDER BY n.created_at DESC, n.id DESC LIMIT ?"
+	args = append(args, page.Limit+1)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := make([]*types.Notification, 0)
+	for rows.Next() {
+		n := new(types.Notification)
+		actor := new(types.ProfileSummary)
+
+		err := rows.Scan(
+			&n.ID,
+			&n.UserID,
+			&n.ActorID,
+			&n.Type,
+			&n.SubjectID,
+			&n.Message,
+			&n.CreatedAt,
+			&n.ReadAt,
+			&actor.ID,
+			&actor.Username,
+			&actor.Name,
+			&actor.Avatar,
+			&actor.Public,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if n.ActorID != nil {
+			actor.UserID = *n.ActorID
+			n.Actor = actor
+		}
+
+		notifications = append(notifications, n)
+	}
+
+	return notifications, nil
+}
+
+func (s *Store) CountUnread(userId uuid.UUID) (int, error) {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM notifications n
+		WHERE n.user_id = ? AND n.read_at IS NULL
+			AND (n.actor_id IS NULL OR NOT EXISTS(
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = ? AND b.blocked_id = n.actor_id) OR (b.blocker_id = n.actor_id AND b.blocked_id = ?)
+			))`, userId, userId, userId).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (s *Store) MarkRead(id, userId uuid.UUID) error {
+	res, err := s.db.Exec("UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ? AND read_at IS NULL", id, userId)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected > 0 {
+		return nil
+	}
+
+	// Nothing changed, either it was already read or it isn't the user's
+	var exists bool
+	err = s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM notifications WHERE id = ? AND user_id = ?)", id, userId).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("notification not found")
+	}
+
+	return nil
+}
+
+func (s *Store) MarkAllRead(userId uuid.UUID) error {
+	_, err := s.db.Exec("UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = ? AND read_at IS NULL", userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) GetPreferences(userId uuid.UUID) (map[string]bool, error) {
+	preferences := make(map[string]bool, len(types.NotificationTypes))
+	for _, t := range types.NotificationTypes {
+		preferences[t] = true
+	}
+
+	rows, err := s.db.Query("SELECT type, enabled FROM notification_preferences WHERE user_id = ?", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t string
+		var enabled bool
+		if err := rows.Scan(&t, &enabled); err != nil {
+			return nil, err
+		}
+
+		// Types that no longer exist are ignored
+		if _, ok := preferences[t]; ok {
+			preferences[t] = enabled
+		}
+	}
+
+	return preferences, nil
+}
+
+func (s *Store) SetPreferences(userId uuid.UUID, preferences map[string]bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for t, enabled := range preferences {
+		_, err := tx.Exec(`
+			INSERT INTO notification_preferences (user_id, type, enabled) VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE enabled = ?`, userId, t, enabled, enabled)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) GetVehicleReminderDates() ([]*types.Vehicle, error) {
+	rows, err := s.db.Query(`
+		SELECT id, user_id, registration, nickname, tax_date, mot_date, insurance_date, service_date
+		FROM vehicles`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vehicles := make([]*types.Vehicle, 0)
+	for rows.Next() {
+		v := new(types.Vehicle)
+
+		err := rows.Scan(&v.ID, &v.UserID, &v.Registration, &v.Nickname, &v.TaxDate, &v.MotDate, &v.InsuranceDate, &v.ServiceDate)
+		if err != nil {
+			return nil, err
+		}
+
+		vehicles = append(vehicles, v)
+	}
+
+	return vehicles, nil
+}
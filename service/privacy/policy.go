@@ -0,0 +1,135 @@
+package privacy
+
+import (
+	"errors"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+// ErrNotVisible is returned when the viewer may not see the owner's content.
+var ErrNotVisible = errors.New("this account is private")
+
+// Access is how much of another user's account a viewer may see.
+type Access int
+
+const (
+	// AccessNone hides the account entirely, used between blocked users.
+	AccessNone Access = iota
+	// AccessSummary only exposes the profile summary.
+	AccessSummary
+	// AccessFull exposes the whole profile, vehicles and logs.
+	AccessFull
+)
+
+// Policy decides what a viewer may see of another user's account. Read
+// handlers ask the policy rather than checking ownership or the public flag
+// themselves.
+type Policy struct {
+	profiles  types.ProfileStore
+	followers types.FollowerStore
+	safety    types.SafetyStore
+}
+
+func NewPolicy(profiles types.ProfileStore, followers types.FollowerStore, safety types.SafetyStore) *Policy {
+	return &Policy{
+		profiles:  profiles,
+		followers: followers,
+		safety:    safety,
+	}
+}
+
+// Blocked reports whether either user has blocked the other.
+func (p *Policy) Blocked(userId, otherId uuid.UUID) (bool, error) {
+	if userId == otherId {
+		return false, nil
+	}
+
+	return p.safety.IsBlocked(userId, otherId)
+}
+
+// Access works out what viewerId may see of ownerId. Owners always see
+// everything, blocked users see nothing, everyone else sees public profiles
+// and followers see private ones. An account without a profile is treated as
+// private.
+func (p *Policy) Access(viewerId, ownerId uuid.UUID) (Access, error) {
+	if viewerId == ownerId {
+		return AccessFull, nil
+	}
+
+	profile, err := p.profiles.GetProfileByUserId(ownerId)
+	if err != nil {
+		profile = nil
+	}
+
+	return p.access(viewerId, ownerId, profile)
+}
+
+func (p *Policy) access(viewerId, ownerId uuid.UUID, profile *types.Profile) (Access, error) {
+	if viewerId == ownerId {
+		return AccessFull, nil
+	}
+
+	blocked, err := p.safety.IsBlocked(viewerId, ownerId)
+	if err != nil {
+		return AccessNone, err
+	}
+
+	if blocked {
+		return AccessNone, nil
+	}
+
+	if profile != nil && profile.Public {
+		return AccessFull, nil
+	}
+
+	f, err := p.followers.GetFollower(viewerId, ownerId)
+	if err != nil {
+		return AccessSummary, err
+	}
+
+	// A pending request doesn't grant anything yet
+	if f != nil && f.Accepted() {
+		return AccessFull, nil
+	}
+
+	return AccessSummary, nil
+}
+
+// Profile returns the owner's profile as the viewer may see it, either the
+// full *types.Profile or a *types.ProfileSummary.
+func (p *Policy) Profile(viewerId, ownerId uuid.UUID) (interface{}, error) {
+	profile, err := p.profiles.GetProfileByUserId(ownerId)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := p.access(viewerId, ownerId, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	switch access {
+	case AccessFull:
+		return profile, nil
+	case AccessSummary:
+		return profile.Summary(), nil
+	}
+
+	return nil, ErrNotVisible
+}
+
+// CanViewContent returns ErrNotVisible unless the viewer may see the owner's
+// vehicles and logs.
+func (p *Policy) CanViewContent(viewerId, ownerId uuid.UUID) error {
+	access, err := p.Access(viewerId, ownerId)
+	if err != nil {
+		return err
+	}
+
+	if access != AccessFull {
+		return ErrNotVisible
+	}
+
+	return nil
+}
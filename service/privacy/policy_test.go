@@ -0,0 +1,217 @@
+package privacy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+func TestPolicy(t *testing.T) {
+	viewer := uuid.New()
+	public := uuid.New()
+	private := uuid.New()
+	followed := uuid.New()
+	noProfile := uuid.New()
+
+	profiles := &mockProfileStore{profiles: map[uuid.UUID]*types.Profile{
+		public:   {ID: uuid.New(), UserID: public, Username: "public", Bio: "hello", Public: true},
+		private:  {ID: uuid.New(), UserID: private, Username: "private", Bio: "hidden", Public: false},
+		followed: {ID: uuid.New(), UserID: followed, Username: "followed", Bio: "friends only", Public: false},
+	}}
+	followers := &mockFollowerStore{follows: map[[2]uuid.UUID]bool{{viewer, followed}: true}}
+	safety := &mockSafetyStore{}
+	policy := NewPolicy(profiles, followers, safety)
+
+	tests := []struct {
+		name  string
+		owner uuid.UUID
+		want  Access
+	}{
+		{"own account", viewer, AccessFull},
+		{"public profile", public, AccessFull},
+		{"private profile", private, AccessSummary},
+		{"followed private profile", followed, AccessFull},
+		{"no profile", noProfile, AccessSummary},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.Access(viewer, tt.owner)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("expected access %d, got %d", tt.want, got)
+			}
+
+			err = policy.CanViewContent(viewer, tt.owner)
+			if (tt.want == AccessFull) != (err == nil) {
+				t.Errorf("unexpected content visibility error: %v", err)
+			}
+		})
+	}
+
+	t.Run("blocked users see nothing", func(t *testing.T) {
+		blocker := uuid.New()
+		profiles.profiles[blocker] = &types.Profile{ID: uuid.New(), UserID: blocker, Public: true}
+		safety.BlockUser(blocker, viewer)
+
+		access, err := policy.Access(viewer, blocker)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if access != AccessNone {
+			t.Errorf("expected no access, got %d", access)
+		}
+
+		if _, err := policy.Profile(viewer, blocker); err != ErrNotVisible {
+			t.Errorf("expected ErrNotVisible, got %v", err)
+		}
+
+		// Blocking hides the blocker from the blocked user too
+		if err := policy.CanViewContent(blocker, viewer); err != ErrNotVisible {
+			t.Errorf("expected ErrNotVisible, got %v", err)
+		}
+	})
+
+	t.Run("private profiles only return a summary", func(t *testing.T) {
+		p, err := policy.Profile(viewer, private)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := p.(*types.ProfileSummary); !ok {
+			t.Errorf("expected a profile summary, got %T", p)
+		}
+	})
+
+	t.Run("followers see the full private profile", func(t *testing.T) {
+		p, err := policy.Profile(viewer, followed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if full, ok := p.(*types.Profile); !ok || full.Bio != "friends only" {
+			t.Errorf("expected the full profile, got %+v", p)
+		}
+	})
+}
+
+type mockProfileStore struct {
+	profiles map[uuid.UUID]*types.Profile
+}
+
+func (m *mockProfileStore) GetProfileByUserId(userId uuid.UUID) (*types.Profile, error) {
+	p, ok := m.profiles[userId]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return p, nil
+}
+
+func (m *mockProfileStore) CreateProfile(types.Profile) error {
+	return nil
+}
+
+func (m *mockProfileStore) UpdateAvatar(userId uuid.UUID, avatar string) error {
+	return nil
+}
+
+func (m *mockProfileStore) IsUsernameAvailable(username string, userId uuid.UUID) (bool, error) {
+	return true, nil
+}
+
+func (m *mockProfileStore) UpdateProfile(userId uuid.UUID, payload types.UpdateProfilePayload, reserveOldUntil time.Time) error {
+	return nil
+}
+
+type mockFollowerStore struct {
+	follows map[[2]uuid.UUID]bool
+}
+
+func (m *mockFollowerStore) FollowUser(followerId, followingId uuid.UUID, status string) error {
+	return nil
+}
+
+func (m *mockFollowerStore) UnfollowUser(followerId, followingId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockFollowerStore) GetFollower(followerId, followingId uuid.UUID) (*types.Follower, error) {
+	if !m.follows[[2]uuid.UUID{followerId, followingId}] {
+		return nil, nil
+	}
+
+	return &types.Follower{ID: uuid.New(), FollowerID: followerId, FollowingID: followingId, Status: types.FollowStatusAccepted}, nil
+}
+
+func (m *mockFollowerStore) GetIncomingFollowRequests(userId uuid.UUID) ([]*types.FollowRequest, error) {
+	return nil, nil
+}
+
+func (m *mockFollowerStore) GetOutgoingFollowRequests(userId uuid.UUID) ([]*types.FollowRequest, error) {
+	return nil, nil
+}
+
+func (m *mockFollowerStore) AcceptFollowRequest(id, followingId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockFollowerStore) RejectFollowRequest(id, followingId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockFollowerStore) GetFollowers(userId, viewerId uuid.UUID, page types.PageRequest) ([]*types.FollowListEntry, error) {
+	return nil, nil
+}
+
+func (m *mockFollowerStore) GetFollowing(userId, viewerId uuid.UUID, page types.PageRequest) ([]*types.FollowListEntry, error) {
+	return nil, nil
+}
+
+type mockSafetyStore struct {
+	blocks map[[2]uuid.UUID]bool
+}
+
+func (m *mockSafetyStore) BlockUser(blockerId, blockedId uuid.UUID) error {
+	if m.blocks == nil {
+		m.blocks = make(map[[2]uuid.UUID]bool)
+	}
+	m.blocks[[2]uuid.UUID{blockerId, blockedId}] = true
+	return nil
+}
+
+func (m *mockSafetyStore) UnblockUser(blockerId, blockedId uuid.UUID) error {
+	delete(m.blocks, [2]uuid.UUID{blockerId, blockedId})
+	return nil
+}
+
+func (m *mockSafetyStore) IsBlocked(userId, otherId uuid.UUID) (bool, error) {
+	return m.blocks[[2]uuid.UUID{userId, otherId}] || m.blocks[[2]uuid.UUID{otherId, userId}], nil
+}
+
+func (m *mockSafetyStore) GetBlockedUsers(userId uuid.UUID) ([]*types.UserRelation, error) {
+	return nil, nil
+}
+
+func (m *mockSafetyStore) MuteUser(muterId, mutedId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockSafetyStore) UnmuteUser(muterId, mutedId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockSafetyStore) GetMutedUsers(userId uuid.UUID) ([]*types.UserRelation, error) {
+	return nil, nil
+}
+
+func (m *mockSafetyStore) GetMutedUserIDs(userId uuid.UUID) ([]uuid.UUID, error) {
+	return nil, nil
+}
@@ -1,18 +1,20 @@
 package profile
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/ZondaF12/logbook-backend/config"
 	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/media"
+	"github.com/ZondaF12/logbook-backend/service/privacy"
 	"github.com/ZondaF12/logbook-backend/types"
 	"github.com/ZondaF12/logbook-backend/utils"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -21,21 +23,25 @@ import (
 type Handler struct {
 	store     types.ProfileStore
 	userStore types.UserStore
+	policy    *privacy.Policy
+	blobs     types.BlobStore
 }
 
-func NewHandler(store types.ProfileStore, userStore types.UserStore) *Handler {
+func NewHandler(store types.ProfileStore, userStore types.UserStore, policy *privacy.Policy, blobs types.BlobStore) *Handler {
 	return &Handler{
 		store:     store,
 		userStore: userStore,
+		policy:    policy,
+		blobs:     blobs,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *echo.Group) {
-	router.POST("/self", auth.WithJWTAuth(h.HandlerCreateProfile, h.userStore))
-	router.PUT("/self", auth.WithJWTAuth(h.HandleUpdateProfile, h.userStore))
-	router.GET("/self", auth.WithJWTAuth(h.HandleGetProfile, h.userStore))
-	router.POST("/self/avatar", auth.WithJWTAuth(h.HandleUploadAvatar, h.userStore))
-	router.GET("/user/:id", auth.WithJWTAuth(h.HandleGetUserById, h.userStore))
+	router.POST("/self", auth.WithJWTAuth(h.HandlerCreateProfile, h.userStore, auth.RequireVerifiedEmail(), auth.RequireScope(auth.ScopeProfileWrite)))
+	router.PUT("/self", auth.WithJWTAuth(h.HandleUpdateProfile, h.userStore, auth.RequireScope(auth.ScopeProfileWrite)))
+	router.GET("/self", auth.WithJWTAuth(h.HandleGetProfile, h.userStore, auth.RequireScope(auth.ScopeProfileRead)))
+	router.POST("/self/avatar", auth.WithJWTAuth(h.HandleUploadAvatar, h.userStore, auth.RequireScope(auth.ScopeProfileWrite)))
+	router.GET("/user/:id", auth.WithJWTAuth(h.HandleGetUserById, h.userStore, auth.RequireScope(auth.ScopeProfileRead)))
 }
 
 func (h *Handler) HandlerCreateProfile(c echo.Context) error {
@@ -62,6 +68,15 @@ func (h *Handler) HandlerCreateProfile(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Profile already created")
 	}
 
+	available, err := h.store.IsUsernameAvailable(payload.Username, userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if !available {
+		return echo.NewHTTPError(http.StatusConflict, "Username already taken")
+	}
+
 	// Create user
 	err = h.store.CreateProfile(types.Profile{
 		UserID:   userId,
@@ -77,7 +92,60 @@ func (h *Handler) HandlerCreateProfile(c echo.Context) error {
 }
 
 func (h *Handler) HandleUpdateProfile(c echo.Context) error {
-	return c.JSON(200, "Update")
+	// Parse payload
+	var payload types.UpdateProfilePayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	if payload.Empty() {
+		return echo.NewHTTPError(http.StatusBadRequest, "Nothing to update")
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	profile, err := h.store.GetProfileByUserId(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Profile not found")
+	}
+
+	if payload.Username != nil && *payload.Username == profile.Username {
+		payload.Username = nil
+	}
+
+	if payload.Username != nil {
+		// Usernames can only change once per interval
+		if profile.UsernameChangedAt != nil {
+			interval := time.Second * time.Duration(config.Envs.UsernameChangeIntervalInSeconds)
+			if wait := time.Until(profile.UsernameChangedAt.Add(interval)); wait > 0 {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "Username was changed too recently")
+			}
+		}
+	}
+
+	reserveUntil := time.Now().Add(time.Second * time.Duration(config.Envs.UsernameReservationInSeconds))
+	err = h.store.UpdateProfile(userId, payload, reserveUntil)
+	if errors.Is(err, ErrUsernameTaken) {
+		return echo.NewHTTPError(http.StatusConflict, "Username already taken")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	profile, err = h.store.GetProfileByUserId(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, profile)
 }
 
 func (h *Handler) HandleGetProfile(c echo.Context) error {
@@ -97,56 +165,43 @@ func (h *Handler) HandleUploadAvatar(c echo.Context) error {
 	userId := auth.GetUserIDFromContext(c.Request().Context())
 
 	// Get avatar file
-	file, err := c.FormFile("avatar")
+	file, err := media.FormFile(c, "avatar", types.UploadAvatar)
 	if err != nil {
-		fmt.Println(err)
-		return err
-	}
-	src, err := file.Open()
-	if err != nil {
-		fmt.Println(err)
 		return err
 	}
-	defer src.Close()
+	defer file.Close()
 
-	// Upload avatar to S3
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		log.Printf("error: %v", err)
-		return c.JSON(http.StatusInternalServerError, "Error uploading avatar")
-	}
-
-	client := s3.NewFromConfig(cfg)
-
-	uploader := manager.NewUploader(client)
-	result, err := uploader.Upload(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String("logbook-app"),
-		Key:    aws.String(fmt.Sprintf("avatars/user/%d/%s", userId, file.Filename)),
-		Body:   src,
-	})
+	// Upload avatar to storage
+	key := media.Key(types.UploadAvatar, userId, uuid.New())
+	location, err := h.blobs.Put(c.Request().Context(), key, file.ContentType, file, file.Size)
 	if err != nil {
 		log.Printf("error: %v", err)
 		return c.JSON(http.StatusInternalServerError, "Error uploading avatar")
 	}
 
 	// Update user avatar
-	err = h.store.UpdateAvatar(userId, result.Location)
+	err = h.store.UpdateAvatar(userId, location)
 	if err != nil {
 		log.Printf("error: %v", err)
 		return c.JSON(http.StatusInternalServerError, "Error setting avatar in db")
 	}
 
-	return c.JSON(http.StatusOK, result.Location)
+	return c.JSON(http.StatusOK, location)
 }
 
 func (h *Handler) HandleGetUserById(c echo.Context) error {
-	userId := c.Param("id")
-	userIdInt := uuid.MustParse(userId)
+	ownerId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
 
-	u, err := h.store.GetProfileByUserId(userIdInt)
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	// Private profiles only show their summary to non-followers
+	u, err := h.policy.Profile(userId, ownerId)
 	if err != nil {
-		fmt.Println(err)
-		return c.JSON(http.StatusBadRequest, err)
+		return echo.NewHTTPError(http.StatusNotFound, "User not found")
 	}
 
 	return c.JSON(http.StatusOK, u)
@@ -0,0 +1,174 @@
+package profile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestUpdateProfile(t *testing.T) {
+	userId := uuid.New()
+	otherId := uuid.New()
+
+	store := &mockProfileStore{
+		profiles: map[uuid.UUID]*types.Profile{
+			userId:  {ID: uuid.New(), UserID: userId, Username: "driver", Name: "Driver", Public: true},
+			otherId: {ID: uuid.New(), UserID: otherId, Username: "taken", Name: "Other"},
+		},
+	}
+	handler := NewHandler(store, nil, nil, nil)
+
+	update := func(payload map[string]interface{}) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(payload)
+
+		req := httptest.NewRequest(http.MethodPut, "/self", bytes.NewBuffer(marshalled))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userId))
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.PUT("/self", handler.HandleUpdateProfile)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should reject an empty update", func(t *testing.T) {
+		rr := update(map[string]interface{}{})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should reject an invalid username", func(t *testing.T) {
+		rr := update(map[string]interface{}{"username": "not valid!"})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should only change the fields sent", func(t *testing.T) {
+		rr := update(map[string]interface{}{"bio": "Track days", "public": false})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		p := store.profiles[userId]
+		if p.Bio != "Track days" || p.Public || p.Name != "Driver" || p.Username != "driver" {
+			t.Errorf("unexpected profile after update: %+v", p)
+		}
+	})
+
+	t.Run("should conflict on a taken username", func(t *testing.T) {
+		rr := update(map[string]interface{}{"username": "taken"})
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should conflict on a username reserved by someone else", func(t *testing.T) {
+		store.reserved = map[string]uuid.UUID{"held": otherId}
+
+		rr := update(map[string]interface{}{"username": "held"})
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should rate limit username changes", func(t *testing.T) {
+		rr := update(map[string]interface{}{"username": "renamed"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if store.reserved["driver"] != userId {
+			t.Error("expected the old username to be reserved")
+		}
+
+		rr = update(map[string]interface{}{"username": "renamed_again"})
+		if rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+
+		if rr.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+	})
+}
+
+type mockProfileStore struct {
+	profiles map[uuid.UUID]*types.Profile
+	reserved map[string]uuid.UUID
+}
+
+func (m *mockProfileStore) GetProfileByUserId(userId uuid.UUID) (*types.Profile, error) {
+	p, ok := m.profiles[userId]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	copied := *p
+	return &copied, nil
+}
+
+func (m *mockProfileStore) CreateProfile(types.Profile) error {
+	return nil
+}
+
+func (m *mockProfileStore) UpdateAvatar(userId uuid.UUID, avatar string) error {
+	return nil
+}
+
+func (m *mockProfileStore) IsUsernameAvailable(username string, userId uuid.UUID) (bool, error) {
+	for _, p := range m.profiles {
+		if p.Username == username && p.UserID != userId {
+			return false, nil
+		}
+	}
+
+	if owner, ok := m.reserved[username]; ok && owner != userId {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (m *mockProfileStore) UpdateProfile(userId uuid.UUID, payload types.UpdateProfilePayload, reserveOldUntil time.Time) error {
+	p := m.profiles[userId]
+
+	if payload.Username != nil {
+		if available, _ := m.IsUsernameAvailable(*payload.Username, userId); !available {
+			return ErrUsernameTaken
+		}
+
+		if m.reserved == nil {
+			m.reserved = make(map[string]uuid.UUID)
+		}
+		m.reserved[p.Username] = userId
+
+		now := time.Now()
+		p.Username = *payload.Username
+		p.UsernameChangedAt = &now
+	}
+	if payload.Name != nil {
+		p.Name = *payload.Name
+	}
+	if payload.Bio != nil {
+		p.Bio = *payload.Bio
+	}
+	if payload.Public != nil {
+		p.Public = *payload.Public
+	}
+
+	return nil
+}
@@ -2,12 +2,23 @@ package profile
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
 )
 
+// ErrUsernameTaken is returned when another profile claimed the username
+// between the availability check and the update.
+var ErrUsernameTaken = errors.New("username already taken")
+
+// mysqlDuplicateEntry is the error number for a unique key violation.
+const mysqlDuplicateEntry = 1062
+
 type Store struct {
 	db *sql.DB
 }
@@ -22,8 +33,8 @@ func (s *Store) GetProfileByUserId(userId uuid.UUID) (*types.Profile, error) {
 	rows, err := s.db.Query(`
 	SELECT
 		p.*,
-		(SELECT COUNT(*) FROM followers f WHERE f.following_id = p.user_id) AS followers,
-		(SELECT COUNT(*) FROM followers f WHERE f.follower_id = p.user_id) AS following
+		(SELECT COUNT(*) FROM followers f WHERE f.following_id = p.user_id AND f.status = 'accepted') AS followers,
+		(SELECT COUNT(*) FROM followers f WHERE f.follower_id = p.user_id AND f.status = 'accepted') AS following
 	FROM
 		profiles p
 	WHERE 
@@ -59,6 +70,7 @@ func scanRowIntoUser(rows *sql.Rows) (*types.Profile, error) {
 		&user.Bio,
 		&user.Avatar,
 		&user.Public,
+		&user.UsernameChangedAt,
 		&user.Followers,
 		&user.Following,
 	)
@@ -86,3 +98,116 @@ func (s *Store) UpdateAvatar(userId uuid.UUID, avatar string) error {
 
 	return nil
 }
+
+func (s *Store) IsUsernameAvailable(username string, userId uuid.UUID) (bool, error) {
+	var taken bool
+	err := s.db.QueryRow(`
+		SELECT
+			EXISTS(SELECT 1 FROM profiles WHERE username = ? AND user_id <> ?)
+			OR EXISTS(SELECT 1 FROM reserved_usernames WHERE username = ? AND user_id <> ? AND reserved_until > ?)`,
+		username, userId, username, userId, time.Now()).Scan(&taken)
+	if err != nil {
+		return false, err
+	}
+
+	return !taken, nil
+}
+
+func (s *Store) UpdateProfile(userId uuid.UUID, payload types.UpdateProfilePayload, reserveOldUntil time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRow("SELECT username FROM profiles WHERE user_id = ? FOR UPDATE", userId).Scan(&current)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	sets := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	if payload.Username != nil && *payload.Username != current {
+		// Lock the new name's reservation so a rename elsewhere can't hold it
+		// between this check and the update. Other profiles using the name are
+		// caught by the unique key on profiles.username
+		var reserved bool
+		err = tx.QueryRow(`
+			SELECT EXISTS(
+				SELECT 1 FROM reserved_usernames
+				WHERE username = ? AND user_id <> ? AND reserved_until > ?
+				FOR UPDATE
+			)`,
+			*payload.Username, userId, time.Now()).Scan(&reserved)
+		if err != nil {
+			return err
+		}
+
+		if reserved {
+			return ErrUsernameTaken
+		}
+
+		// Hold on to the old name so nobody can impersonate the user right
+		// after a rename, and release any hold the user had on the new one
+		_, err = tx.Exec(`
+			INSERT INTO reserved_usernames (username, user_id, reserved_until) VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE user_id = ?, reserved_until = ?`,
+			current, userId, reserveOldUntil, userId, reserveOldUntil)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM reserved_usernames WHERE username = ? AND user_id = ?", *payload.Username, userId)
+		if err != nil {
+			return err
+		}
+
+		sets = append(sets, "username = ?", "username_changed_at = CURRENT_TIMESTAMP")
+		args = append(args, *payload.Username)
+	}
+
+	if payload.Name != nil {
+		sets = append(sets, "name = ?")
+		args = append(args, *payload.Name)
+	}
+
+	if payload.Bio != nil {
+		sets = append(sets, "bio = ?")
+		args = append(args, *payload.Bio)
+	}
+
+	if payload.Public != nil {
+		sets = append(sets, "public = ?")
+		args = append(args, *payload.Public)
+	}
+
+	// Going public lets everyone follow, so waiting requests are accepted
+	if payload.Public != nil && *payload.Public {
+		_, err = tx.Exec("UPDATE followers SET status = ? WHERE following_id = ? AND status = ?",
+			types.FollowStatusAccepted, userId, types.FollowStatusPending)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(sets) == 0 {
+		return nil
+	}
+
+	args = append(args, userId)
+	_, err = tx.Exec(fmt.Sprintf("UPDATE profiles SET %s WHERE user_id = ?", strings.Join(sets, ", ")), args...)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+			return ErrUsernameTaken
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,140 @@
+package safety
+
+import (
+	"net/http"
+
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	store     types.SafetyStore
+	userStore types.UserStore
+	feeds     types.FeedCache
+}
+
+func NewHandler(store types.SafetyStore, userStore types.UserStore, feeds types.FeedCache) *Handler {
+	return &Handler{
+		store:     store,
+		userStore: userStore,
+		feeds:     feeds,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *echo.Group) {
+	router.POST("/user/:id/block", auth.WithJWTAuth(h.HandleBlockUser, h.userStore, auth.RequireScope(auth.ScopeFollowersWrite)))
+	router.DELETE("/user/:id/block", auth.WithJWTAuth(h.HandleUnblockUser, h.userStore, auth.RequireScope(auth.ScopeFollowersWrite)))
+	router.GET("/self/blocks", auth.WithJWTAuth(h.HandleGetBlockedUsers, h.userStore, auth.RequireScope(auth.ScopeFollowersRead)))
+	router.POST("/user/:id/mute", auth.WithJWTAuth(h.HandleMuteUser, h.userStore, auth.RequireScope(auth.ScopeFollowersWrite)))
+	router.DELETE("/user/:id/mute", auth.WithJWTAuth(h.HandleUnmuteUser, h.userStore, auth.RequireScope(auth.ScopeFollowersWrite)))
+	router.GET("/self/mutes", auth.WithJWTAuth(h.HandleGetMutedUsers, h.userStore, auth.RequireScope(auth.ScopeFollowersRead)))
+}
+
+// targetUser reads the user the request is about from the path and makes sure
+// it isn't the caller.
+func targetUser(c echo.Context) (uuid.UUID, uuid.UUID, error) {
+	targetId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	if userId == targetId {
+		return uuid.Nil, uuid.Nil, echo.NewHTTPError(http.StatusBadRequest, "Cannot do this to yourself")
+	}
+
+	return userId, targetId, nil
+}
+
+func (h *Handler) HandleBlockUser(c echo.Context) error {
+	userId, targetId, err := targetUser(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.userStore.GetUserByID(targetId); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "User not found")
+	}
+
+	if err := h.store.BlockUser(userId, targetId); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	// Neither should see the other's posts in a cached feed page
+	h.feeds.Forget(userId, targetId)
+
+	return c.JSON(http.StatusOK, "User blocked")
+}
+
+func (h *Handler) HandleUnblockUser(c echo.Context) error {
+	userId, targetId, err := targetUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.UnblockUser(userId, targetId); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, "User unblocked")
+}
+
+func (h *Handler) HandleGetBlockedUsers(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	users, err := h.store.GetBlockedUsers(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, users)
+}
+
+func (h *Handler) HandleMuteUser(c echo.Context) error {
+	userId, targetId, err := targetUser(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.userStore.GetUserByID(targetId); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "User not found")
+	}
+
+	if err := h.store.MuteUser(userId, targetId); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	h.feeds.Forget(userId)
+
+	return c.JSON(http.StatusOK, "User muted")
+}
+
+func (h *Handler) HandleUnmuteUser(c echo.Context) error {
+	userId, targetId, err := targetUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.UnmuteUser(userId, targetId); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, "User unmuted")
+}
+
+func (h *Handler) HandleGetMutedUsers(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	users, err := h.store.GetMutedUsers(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, users)
+}
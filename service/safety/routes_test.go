@@ -0,0 +1,366 @@
+package safety
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/privacy"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSafetyHandlers(t *testing.T) {
+	userId := uuid.New()
+	otherId := uuid.New()
+
+	store := newMockSafetyStore()
+	users := &mockUserStore{users: map[uuid.UUID]bool{userId: true, otherId: true}}
+	feeds := &mockFeedCache{}
+	handler := NewHandler(store, users, feeds)
+
+	serve := func(method, path, route string, h echo.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userId))
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.Add(method, route, h)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should not block or mute yourself", func(t *testing.T) {
+		rr := serve(http.MethodPost, fmt.Sprintf("/user/%s/block", userId), "/user/:id/block", handler.HandleBlockUser)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+
+		rr = serve(http.MethodPost, fmt.Sprintf("/user/%s/mute", userId), "/user/:id/mute", handler.HandleMuteUser)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should not block an unknown user", func(t *testing.T) {
+		rr := serve(http.MethodPost, fmt.Sprintf("/user/%s/block", uuid.New()), "/user/:id/block", handler.HandleBlockUser)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should hide blocked users from each other", func(t *testing.T) {
+		profiles := &mockProfileStore{profiles: map[uuid.UUID]*types.Profile{
+			userId:  {UserID: userId, Public: true},
+			otherId: {UserID: otherId, Public: true},
+		}}
+		policy := privacy.NewPolicy(profiles, nil, store)
+
+		rr := serve(http.MethodPost, fmt.Sprintf("/user/%s/block", otherId), "/user/:id/block", handler.HandleBlockUser)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if !feeds.forgot(userId) || !feeds.forgot(otherId) {
+			t.Error("expected both users' cached feeds to be dropped")
+		}
+
+		// Either way round, whoever did the blocking
+		for _, pair := range [][2]uuid.UUID{{userId, otherId}, {otherId, userId}} {
+			if err := policy.CanViewContent(pair[0], pair[1]); err != privacy.ErrNotVisible {
+				t.Errorf("expected content to be hidden, got %v", err)
+			}
+
+			if _, err := policy.Profile(pair[0], pair[1]); err != privacy.ErrNotVisible {
+				t.Errorf("expected profile to be hidden, got %v", err)
+			}
+		}
+
+		rr = serve(http.MethodDelete, fmt.Sprintf("/user/%s/block", otherId), "/user/:id/block", handler.HandleUnblockUser)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if err := policy.CanViewContent(otherId, userId); err != nil {
+			t.Errorf("expected content to be visible once unblocked, got %v", err)
+		}
+	})
+
+	t.Run("should list muted users", func(t *testing.T) {
+		mutes := func() []*types.UserRelation {
+			rr := serve(http.MethodGet, "/self/mutes", "/self/mutes", handler.HandleGetMutedUsers)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+
+			var relations []*types.UserRelation
+			if err := json.Unmarshal(rr.Body.Bytes(), &relations); err != nil {
+				t.Fatal(err)
+			}
+
+			return relations
+		}
+
+		feeds.forgotten = nil
+		rr := serve(http.MethodPost, fmt.Sprintf("/user/%s/mute", otherId), "/user/:id/mute", handler.HandleMuteUser)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if !feeds.forgot(userId) {
+			t.Error("expected the cached feed to be dropped")
+		}
+
+		if relations := mutes(); len(relations) != 1 || relations[0].UserID != otherId {
+			t.Errorf("expected %s to be muted, got %v", otherId, relations)
+		}
+
+		rr = serve(http.MethodDelete, fmt.Sprintf("/user/%s/mute", otherId), "/user/:id/mute", handler.HandleUnmuteUser)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if relations := mutes(); len(relations) != 0 {
+			t.Errorf("expected no muted users, got %d", len(relations))
+		}
+	})
+}
+
+type mockSafetyStore struct {
+	blocks map[[2]uuid.UUID]bool
+	mutes  map[[2]uuid.UUID]bool
+}
+
+func newMockSafetyStore() *mockSafetyStore {
+	return &mockSafetyStore{
+		blocks: make(map[[2]uuid.UUID]bool),
+		mutes:  make(map[[2]uuid.UUID]bool),
+	}
+}
+
+func (m *mockSafetyStore) BlockUser(blockerId, blockedId uuid.UUID) error {
+	m.blocks[[2]uuid.UUID{blockerId, blockedId}] = true
+	return nil
+}
+
+func (m *mockSafetyStore) UnblockUser(blockerId, blockedId uuid.UUID) error {
+	delete(m.blocks, [2]uuid.UUID{blockerId, blockedId})
+	return nil
+}
+
+func (m *mockSafetyStore) IsBlocked(userId, otherId uuid.UUID) (bool, error) {
+	return m.blocks[[2]uuid.UUID{userId, otherId}] || m.blocks[[2]uuid.UUID{otherId, userId}], nil
+}
+
+func (m *mockSafetyStore) GetBlockedUsers(userId uuid.UUID) ([]*types.UserRelation, error) {
+	return m.relations(m.blocks, userId), nil
+}
+
+func (m *mockSafetyStore) MuteUser(muterId, mutedId uuid.UUID) error {
+	m.mutes[[2]uuid.UUID{muterId, mutedId}] = true
+	return nil
+}
+
+func (m *mockSafetyStore) UnmuteUser(muterId, mutedId uuid.UUID) error {
+	delete(m.mutes, [2]uuid.UUID{muterId, mutedId})
+	return nil
+}
+
+func (m *mockSafetyStore) GetMutedUsers(userId uuid.UUID) ([]*types.UserRelation, error) {
+	return m.relations(m.mutes, userId), nil
+}
+
+func (m *mockSafetyStore) GetMutedUserIDs(userId uuid.UUID) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0)
+	for _, relation := range m.relations(m.mutes, userId) {
+		ids = append(ids, relation.UserID)
+	}
+	return ids, nil
+}
+
+func (m *mockSafetyStore) relations(pairs map[[2]uuid.UUID]bool, userId uuid.UUID) []*types.UserRelation {
+	relations := make([]*types.UserRelation, 0)
+	for pair := range pairs {
+		if pair[0] == userId {
+			relations = append(relations, &types.UserRelation{ProfileSummary: types.ProfileSummary{UserID: pair[1]}})
+		}
+	}
+	return relations
+}
+
+type mockProfileStore struct {
+	profiles map[uuid.UUID]*types.Profile
+}
+
+func (m *mockProfileStore) GetProfileByUserId(userId uuid.UUID) (*types.Profile, error) {
+	p, ok := m.profiles[userId]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return p, nil
+}
+
+func (m *mockProfileStore) CreateProfile(types.Profile) error {
+	return nil
+}
+
+func (m *mockProfileStore) UpdateAvatar(userId uuid.UUID, avatar string) error {
+	return nil
+}
+
+func (m *mockProfileStore) IsUsernameAvailable(username string, userId uuid.UUID) (bool, error) {
+	return true, nil
+}
+
+func (m *mockProfileStore) UpdateProfile(userId uuid.UUID, payload types.UpdateProfilePayload, reserveOldUntil time.Time) error {
+	return nil
+}
+
+type mockUserStore struct {
+	users map[uuid.UUID]bool
+}
+
+func (m *mockUserStore) CreateSession(session types.Session) error {
+	return nil
+}
+
+func (m *mockUserStore) GetSessionByID(id uuid.UUID) (*types.Session, error) {
+	return nil, fmt.Errorf("not found")
+}
+
+func (m *mockUserStore) GetSessionByRefreshTokenHash(hash string) (*types.Session, error) {
+	return nil, fmt.Errorf("not found")
+}
+
+func (m *mockUserStore) GetSessionByRotatedRefreshTokenHash(hash string) (*types.Session, error) {
+	return nil, fmt.Errorf("not found")
+}
+
+func (m *mockUserStore) RotateSession(id uuid.UUID, oldHash, newHash string, expiresAt time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) RevokeSession(id uuid.UUID) error {
+	return nil
+}
+
+func (m *mockUserStore) RevokeUserSessions(userId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockUserStore) RevokeOtherSessions(userId, keepId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockUserStore) CreatePasswordReset(passwordReset types.PasswordReset) error {
+	return nil
+}
+
+func (m *mockUserStore) GetPasswordResetByTokenHash(hash string) (*types.PasswordReset, error) {
+	return nil, fmt.Errorf("not found")
+}
+
+func (m *mockUserStore) ResetPassword(resetId, userId uuid.UUID, passwordHash string) error {
+	return nil
+}
+
+func (m *mockUserStore) CreateAccessToken(accessToken types.AccessToken) error {
+	return nil
+}
+
+func (m *mockUserStore) GetAccessTokenByHash(hash string) (*types.AccessToken, error) {
+	return nil, fmt.Errorf("not found")
+}
+
+func (m *mockUserStore) GetUserAccessTokens(userId uuid.UUID) ([]*types.AccessToken, error) {
+	return nil, nil
+}
+
+func (m *mockUserStore) RevokeAccessToken(userId, id uuid.UUID) error {
+	return nil
+}
+
+func (m *mockUserStore) TouchAccessToken(id uuid.UUID) error {
+	return nil
+}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("not found")
+}
+
+func (m *mockUserStore) GetUserByID(id uuid.UUID) (*types.User, error) {
+	if !m.users[id] {
+		return nil, fmt.Errorf("user not found")
+	}
+	return &types.User{ID: id}, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) MarkEmailVerified(userId uuid.UUID, email string) error {
+	return nil
+}
+
+func (m *mockUserStore) SetTOTPSecret(userId uuid.UUID, secret string) error {
+	return nil
+}
+
+func (m *mockUserStore) EnableTOTP(userId uuid.UUID, recoveryCodeHashes []string) error {
+	return nil
+}
+
+func (m *mockUserStore) UseRecoveryCode(userId uuid.UUID, codeHash string) error {
+	return nil
+}
+
+func (m *mockUserStore) UseTOTPStep(userId uuid.UUID, step int64) error {
+	return nil
+}
+
+func (m *mockUserStore) SetTwoFactorChallenge(userId, challengeId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockUserStore) UseTwoFactorChallenge(userId, challengeId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(userId, keepSessionId uuid.UUID, passwordHash string) error {
+	return nil
+}
+
+func (m *mockUserStore) SetPendingEmail(userId uuid.UUID, email string) error {
+	return nil
+}
+
+func (m *mockUserStore) ConfirmEmailChange(userId uuid.UUID, email string) error {
+	return nil
+}
+
+type mockFeedCache struct {
+	forgotten []uuid.UUID
+}
+
+func (m *mockFeedCache) Forget(userIds ...uuid.UUID) {
+	m.forgotten = append(m.forgotten, userIds...)
+}
+
+func (m *mockFeedCache) forgot(userId uuid.UUID) bool {
+	for _, id := range m.forgotten {
+		if id == userId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package safety
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/ZondaF12/logbook-backend/utils"
+	"github.com/google/uuid"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) BlockUser(blockerId, blockedId uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT IGNORE INTO user_blocks (blocker_id, blocked_id) VALUES (?, ?)", blockerId, blockedId)
+	if err != nil {
+		return err
+	}
+
+	// Follows and pending requests go both ways
+	_, err = tx.Exec(`
+		DELETE FROM followers
+		WHERE (follower_id = ? AND following_id = ?) OR (follower_id = ? AND following_id = ?)`,
+		blockerId, blockedId, blockedId, blockerId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) UnblockUser(blockerId, blockedId uuid.UUID) error {
+	_, err := s.db.Exec("DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?", blockerId, blockedId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) IsBlocked(userId, otherId uuid.UUID) (bool, error) {
+	var blocked bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)
+		)`, userId, otherId, otherId, userId).Scan(&blocked)
+	if err != nil {
+		return false, err
+	}
+
+	return blocked, nil
+}
+
+func (s *Store) GetBlockedUsers(userId uuid.UUID) ([]*types.UserRelation, error) {
+	return s.getRelations("user_blocks", "blocker_id", "blocked_id", userId)
+}
+
+func (s *Store) MuteUser(muterId, mutedId uuid.UUID) error {
+	_, err := s.db.Exec("INSERT IGNORE INTO user_mutes (muter_id, muted_id) VALUES (?, ?)", muterId, mutedId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) UnmuteUser(muterId, mutedId uuid.UUID) error {
+	_, err := s.db.Exec("DELETE FROM user_mutes WHERE muter_id = ? AND muted_id = ?", muterId, mutedId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) GetMutedUsers(userId uuid.UUID) ([]*types.UserRelation, error) {
+	return s.getRelations("user_mutes", "muter_id", "muted_id", userId)
+}
+
+func (s *Store) GetMutedUserIDs(userId uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := s.db.Query("SELECT muted_id FROM user_mutes WHERE muter_id = ?", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// getRelations lists the users in otherColumn of table for the user in
+// selfColumn, along with their profile summaries.
+func (s *Store) getRelations(table, selfColumn, otherColumn string, userId uuid.UUID) ([]*types.UserRelation, error) {
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT
+			r.%[3]s,
+			r.created_at,
+			`+utils.ProfileSummaryColumns+`
+		FROM %[1]s r
+		LEFT JOIN profiles p ON p.user_id = r.%[3]s
+		WHERE r.%[2]s = ?
+		ORDER BY r.created_at DESC`, table, selfColumn, otherColumn), userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	relations := make([]*types.UserRelation, 0)
+	for rows.Next() {
+		relation := new(types.UserRelation)
+
+		err := rows.Scan(
+			&relation.UserID,
+			&relation.CreatedAt,
+			&relation.ID,
+			&relation.Username,
+			&relation.Name,
+			&relation.Avatar,
+			&relation.Public,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		relations = append(relations, relation)
+	}
+
+	return relations, nil
+}
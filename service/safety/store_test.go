@@ -0,0 +1,118 @@
+package safety
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBlockUser(t *testing.T) {
+	recorder := &recordingDriver{}
+	sql.Register("safety-recorder", recorder)
+
+	db, err := sql.Open("safety-recorder", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	blocker, blocked := uuid.New(), uuid.New()
+	if err := NewStore(db).BlockUser(blocker, blocked); err != nil {
+		t.Fatal(err)
+	}
+
+	if !recorder.committed {
+		t.Fatal("expected the block to be committed")
+	}
+
+	var unfollow *recordedExec
+	for i, exec := range recorder.execs {
+		if strings.Contains(exec.query, "DELETE FROM followers") {
+			unfollow = &recorder.execs[i]
+		}
+	}
+
+	if unfollow == nil {
+		t.Fatal("expected follows to be removed")
+	}
+
+	// Both directions, follows and pending requests alike
+	want := []string{blocker.String(), blocked.String(), blocked.String(), blocker.String()}
+	if fmt.Sprint(unfollow.args) != fmt.Sprint(want) {
+		t.Errorf("expected follows between %v to be removed, got %v", want, unfollow.args)
+	}
+	if strings.Contains(unfollow.query, "status") {
+		t.Error("expected follows to be removed whatever their status")
+	}
+}
+
+type recordedExec struct {
+	query string
+	args  []driver.Value
+}
+
+// recordingDriver records the statements run against it instead of running
+// them, which is enough to check what a store asks the database to do.
+type recordingDriver struct {
+	execs     []recordedExec
+	committed bool
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	return &recordingConn{driver: d}, nil
+}
+
+type recordingConn struct {
+	driver *recordingDriver
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{driver: c.driver, query: query}, nil
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return &recordingTx{driver: c.driver}, nil
+}
+
+type recordingTx struct {
+	driver *recordingDriver
+}
+
+func (tx *recordingTx) Commit() error {
+	tx.driver.committed = true
+	return nil
+}
+
+func (tx *recordingTx) Rollback() error {
+	return nil
+}
+
+type recordingStmt struct {
+	driver *recordingDriver
+	query  string
+}
+
+func (s *recordingStmt) Close() error {
+	return nil
+}
+
+func (s *recordingStmt) NumInput() int {
+	return -1
+}
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.driver.execs = append(s.driver.execs, recordedExec{query: s.query, args: args})
+	return driver.RowsAffected(1), nil
+}
+
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, fmt.Errorf("queries are not recorded")
+}
@@ -0,0 +1,66 @@
+package search
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/ZondaF12/logbook-backend/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	store     types.SearchStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.SearchStore, userStore types.UserStore) *Handler {
+	return &Handler{
+		store:     store,
+		userStore: userStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *echo.Group) {
+	router.GET("/search/users", auth.WithJWTAuth(h.HandleSearchUsers, h.userStore, auth.RequireScope(auth.ScopeProfileRead)))
+}
+
+func (h *Handler) HandleSearchUsers(c echo.Context) error {
+	// Parse query
+	var search types.UserSearch
+	if err := c.Bind(&search); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	search.Query = strings.TrimPrefix(strings.TrimSpace(search.Query), "@")
+	search.Make = strings.TrimSpace(search.Make)
+	search.Model = strings.TrimSpace(search.Model)
+
+	// Validate query
+	if err := utils.Validate.Struct(search); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid search %v", errors))
+	}
+
+	if search.Query == "" && search.Make == "" && search.Model == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Search needs a query, make or model")
+	}
+
+	offset, limit, err := utils.ParseOffsetPage(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	users, err := h.store.SearchUsers(userId, search, offset, limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, utils.NewOffsetPage(users, offset, limit))
+}
@@ -0,0 +1,93 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSearchUsers(t *testing.T) {
+	userId := uuid.New()
+	store := &mockSearchStore{}
+	handler := NewHandler(store, nil)
+
+	search := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/search/users"+query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userId))
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.GET("/search/users", handler.HandleSearchUsers)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should require something to search for", func(t *testing.T) {
+		rr := search("")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should reject a one character query", func(t *testing.T) {
+		rr := search("?q=a")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should search by username and vehicle", func(t *testing.T) {
+		rr := search("?q=@driver&make=Ford&model=Focus&limit=1")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if store.last.Query != "driver" || store.last.Make != "Ford" || store.last.Model != "Focus" {
+			t.Errorf("unexpected search %+v", store.last)
+		}
+
+		var page types.Page[*types.ProfileSummary]
+		if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(page.Items) != 1 || page.NextCursor == "" {
+			t.Errorf("expected 1 item and a next cursor, got %d items and %q", len(page.Items), page.NextCursor)
+		}
+
+		rr = search("?q=driver&limit=1&cursor=" + page.NextCursor)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if store.offset != 1 {
+			t.Errorf("expected offset 1, got %d", store.offset)
+		}
+	})
+}
+
+type mockSearchStore struct {
+	last   types.UserSearch
+	offset int
+}
+
+func (m *mockSearchStore) SearchUsers(viewerId uuid.UUID, search types.UserSearch, offset, limit int) ([]*types.ProfileSummary, error) {
+	m.last = search
+	m.offset = offset
+
+	users := make([]*types.ProfileSummary, 0)
+	for i := 0; i < limit+1; i++ {
+		users = append(users, &types.ProfileSummary{UserID: uuid.New(), Username: "driver", Public: true})
+	}
+
+	return users, nil
+}
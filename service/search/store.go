@@ -0,0 +1,122 @@
+package search
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+// likeEscaper escapes the LIKE wildcards so they match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// minSoundexLength is the shortest query worth matching by sound, shorter
+// ones match far too much.
+const minSoundexLength = 3
+
+func (s *Store) SearchUsers(viewerId uuid.UUID, search types.UserSearch, offset, limit int) ([]*types.ProfileSummary, error) {
+	// Only public profiles are discoverable and blocks hide users both ways
+	where := []string{
+		"p.public = TRUE",
+		"p.user_id <> ?",
+		`NOT EXISTS(
+			SELECT 1 FROM user_blocks b
+			WHERE (b.blocker_id = ? AND b.blocked_id = p.user_id) OR (b.blocker_id = p.user_id AND b.blocked_id = ?)
+		)`,
+	}
+	whereArgs := []interface{}{viewerId, viewerId, viewerId}
+
+	rank := "0"
+	rankArgs := make([]interface{}, 0)
+
+	if search.Query != "" {
+		escaped := likeEscaper.Replace(search.Query)
+		prefix := escaped + "%"
+		wordPrefix := "% " + escaped + "%"
+		contains := "%" + escaped + "%"
+
+		// Best matches first: exact username, username prefix, name prefix,
+		// prefix of a later word in the name, anywhere, then sounds alike
+		rank = `CASE
+			WHEN p.username = ? THEN 0
+			WHEN p.username LIKE ? THEN 1
+			WHEN p.name LIKE ? THEN 2
+			WHEN p.name LIKE ? THEN 3
+			WHEN p.username LIKE ? OR p.name LIKE ? THEN 4
+			ELSE 5
+		END`
+		rankArgs = append(rankArgs, search.Query, prefix, prefix, wordPrefix, contains, contains)
+
+		match := "p.username LIKE ? OR p.name LIKE ?"
+		whereArgs = append(whereArgs, contains, contains)
+
+		if len(search.Query) >= minSoundexLength {
+			match += " OR SOUNDEX(p.username) = SOUNDEX(?) OR SOUNDEX(p.name) = SOUNDEX(?)"
+			whereArgs = append(whereArgs, search.Query, search.Query)
+		}
+
+		where = append(where, "("+match+")")
+	}
+
+	if search.Make != "" || search.Model != "" {
+		vehicle := "SELECT 1 FROM vehicles v WHERE v.user_id = p.user_id"
+		if search.Make != "" {
+			vehicle += " AND v.make = ?"
+			whereArgs = append(whereArgs, search.Make)
+		}
+		if search.Model != "" {
+			vehicle += " AND v.model = ?"
+			whereArgs = append(whereArgs, search.Model)
+		}
+
+		where = append(where, "EXISTS("+vehicle+")")
+	}
+
+	args := append(rankArgs, whereArgs...)
+	args = append(args, limit+1, offset)
+
+	rows, err := s.db.Query(`
+		SELECT p.id, p.user_id, p.username, p.name, p.avatar, p.public, `+rank+` AS search_rank
+		FROM profiles p
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY search_rank, p.username
+		LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*types.ProfileSummary, 0)
+	for rows.Next() {
+		user := new(types.ProfileSummary)
+
+		var searchRank int
+		err := rows.Scan(
+			&user.ID,
+			&user.UserID,
+			&user.Username,
+			&user.Name,
+			&user.Avatar,
+			&user.Public,
+			&searchRank,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+
+	return users, nil
+}
@@ -0,0 +1,292 @@
+package social
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/privacy"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/ZondaF12/logbook-backend/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	store     types.SocialStore
+	userStore types.UserStore
+	policy    *privacy.Policy
+	notifier  types.Notifier
+}
+
+func NewHandler(store types.SocialStore, userStore types.UserStore, policy *privacy.Policy, notifier types.Notifier) *Handler {
+	return &Handler{
+		store:     store,
+		userStore: userStore,
+		policy:    policy,
+		notifier:  notifier,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *echo.Group) {
+	router.POST("/log/:logId/like", auth.WithJWTAuth(h.HandleLikeLog, h.userStore, auth.RequireScope(auth.ScopeLogbookWrite)))
+	router.DELETE("/log/:logId/like", auth.WithJWTAuth(h.HandleUnlikeLog, h.userStore, auth.RequireScope(auth.ScopeLogbookWrite)))
+	router.GET("/log/:logId/comments", auth.WithJWTAuth(h.HandleGetComments, h.userStore, auth.RequireScope(auth.ScopeLogbookRead)))
+	router.POST("/log/:logId/comments", auth.WithJWTAuth(h.HandleCreateComment, h.userStore, auth.RequireVerifiedEmail(), auth.RequireScope(auth.ScopeLogbookWrite)))
+	router.PATCH("/comments/:id", auth.WithJWTAuth(h.HandleUpdateComment, h.userStore, auth.RequireScope(auth.ScopeLogbookWrite)))
+	router.DELETE("/comments/:id", auth.WithJWTAuth(h.HandleDeleteComment, h.userStore, auth.RequireScope(auth.ScopeLogbookWrite)))
+}
+
+// logAccess checks the user may see the log and returns the log and owner
+// IDs.
+func (h *Handler) logAccess(c echo.Context, userId uuid.UUID) (uuid.UUID, uuid.UUID, error) {
+	logId, err := uuid.Parse(c.Param("logId"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid log ID")
+	}
+
+	ownerId, err := h.canAccessLog(userId, logId)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	return logId, ownerId, nil
+}
+
+// canAccessLog returns the log's owner if userId may see the log.
+func (h *Handler) canAccessLog(userId, logId uuid.UUID) (uuid.UUID, error) {
+	ownerId, err := h.store.GetLogOwner(logId)
+	if err != nil {
+		return uuid.Nil, echo.NewHTTPError(http.StatusNotFound, "Log not found")
+	}
+
+	err = h.policy.CanViewContent(userId, ownerId)
+	if errors.Is(err, privacy.ErrNotVisible) {
+		return uuid.Nil, echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		return uuid.Nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return ownerId, nil
+}
+
+func (h *Handler) HandleLikeLog(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	logId, ownerId, err := h.logAccess(c, userId)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.LikeLog(logId, userId); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	// Liking the same log again doesn't notify the owner twice
+	key := fmt.Sprintf("like:%s:%s", logId, userId)
+	h.notifier.Notify(types.Notification{UserID: ownerId, ActorID: &userId, Type: types.NotificationLike, SubjectID: &logId, DedupeKey: &key})
+
+	return c.JSON(http.StatusOK, "Log liked")
+}
+
+func (h *Handler) HandleUnlikeLog(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	logId, err := uuid.Parse(c.Param("logId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid log ID")
+	}
+
+	// Removing a like is always allowed, even after losing access to the log
+	if err := h.store.UnlikeLog(logId, userId); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, "Log unliked")
+}
+
+func (h *Handler) HandleGetComments(c echo.Context) error {
+	page, err := utils.ParsePage(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	logId, _, err := h.logAccess(c, userId)
+	if err != nil {
+		return err
+	}
+
+	comments, err := h.store.GetLogComments(logId, userId, *page)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, utils.NewPage(comments, page.Limit, func(comment *types.Comment) types.Cursor {
+		return types.Cursor{CreatedAt: comment.CreatedAt, ID: comment.ID}
+	}))
+}
+
+func (h *Handler) HandleCreateComment(c echo.Context) error {
+	// Parse payload
+	var payload types.CreateCommentPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	logId, ownerId, err := h.logAccess(c, userId)
+	if err != nil {
+		return err
+	}
+
+	var parent *types.Comment
+	if payload.ParentID != nil {
+		parent, err = h.store.GetCommentByID(*payload.ParentID)
+		if err != nil || parent.LogID != logId {
+			return echo.NewHTTPError(http.StatusBadRequest, "Parent comment not found on this log")
+		}
+
+		blocked, err := h.policy.Blocked(userId, parent.UserID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+
+		if blocked {
+			return echo.NewHTTPError(http.StatusForbidden, "Cannot reply to this comment")
+		}
+	}
+
+	// Limit how many comments a user can post in a window
+	window := time.Second * time.Duration(config.Envs.CommentRateWindowInSeconds)
+	count, err := h.store.CountUserCommentsSince(userId, time.Now().Add(-window))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if int64(count) >= config.Envs.CommentRateLimit {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(window.Seconds())))
+		return echo.NewHTTPError(http.StatusTooManyRequests, "Too many comments, try again later")
+	}
+
+	comment := types.Comment{
+		ID:        uuid.New(),
+		LogID:     logId,
+		UserID:    userId,
+		ParentID:  payload.ParentID,
+		Body:      payload.Body,
+		CreatedAt: time.Now(),
+	}
+
+	if err := h.store.CreateComment(comment); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	h.notifier.Notify(types.Notification{UserID: ownerId, ActorID: &userId, Type: types.NotificationComment, SubjectID: &logId})
+
+	// The owner already heard about it as a comment on their log
+	if parent != nil && parent.UserID != ownerId {
+		h.notifier.Notify(types.Notification{UserID: parent.UserID, ActorID: &userId, Type: types.NotificationReply, SubjectID: &logId})
+	}
+
+	return c.JSON(http.StatusCreated, comment)
+}
+
+func (h *Handler) HandleUpdateComment(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid comment ID")
+	}
+
+	// Parse payload
+	var payload types.UpdateCommentPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	comment, err := h.store.GetCommentByID(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Comment not found")
+	}
+
+	// Only the author can edit a comment
+	if comment.UserID != userId {
+		return echo.NewHTTPError(http.StatusForbidden, "Cannot edit another user's comment")
+	}
+
+	// and only while they can still see the log, not after the owner blocked
+	// them or made the account private
+	if _, err := h.canAccessLog(userId, comment.LogID); err != nil {
+		return err
+	}
+
+	if err := h.store.UpdateComment(id, payload.Body); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	now := time.Now()
+	comment.Body = payload.Body
+	comment.EditedAt = &now
+
+	return c.JSON(http.StatusOK, comment)
+}
+
+func (h *Handler) HandleDeleteComment(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid comment ID")
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	comment, err := h.store.GetCommentByID(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Comment not found")
+	}
+
+	// The author and the vehicle owner can delete a comment
+	if comment.UserID != userId {
+		ownerId, err := h.store.GetLogOwner(comment.LogID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+
+		if ownerId != userId {
+			return echo.NewHTTPError(http.StatusForbidden, "Cannot delete another user's comment")
+		}
+	}
+
+	if err := h.store.DeleteComment(id); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, "Comment deleted")
+}
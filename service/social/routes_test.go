@@ -0,0 +1,432 @@
+package social
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/privacy"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func newTestHandler(store *mockSocialStore, profiles map[uuid.UUID]*types.Profile, safety *mockSafetyStore, notifier *mockNotifier) *Handler {
+	profileStore := &mockProfileStore{profiles: profiles}
+	return NewHandler(store, nil, privacy.NewPolicy(profileStore, &mockFollowerStore{}, safety), notifier)
+}
+
+func serve(handler echo.HandlerFunc, method, route, path string, userId uuid.UUID, body any) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userId))
+
+	rr := httptest.NewRecorder()
+	router := echo.New()
+
+	router.Add(method, route, handler)
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestLikeLog(t *testing.T) {
+	userId := uuid.New()
+	publicId := uuid.New()
+	privateId := uuid.New()
+	publicLog := uuid.New()
+	privateLog := uuid.New()
+
+	store := &mockSocialStore{owners: map[uuid.UUID]uuid.UUID{publicLog: publicId, privateLog: privateId}}
+	notifier := &mockNotifier{}
+	handler := newTestHandler(store, map[uuid.UUID]*types.Profile{
+		publicId:  {UserID: publicId, Public: true},
+		privateId: {UserID: privateId, Public: false},
+	}, &mockSafetyStore{}, notifier)
+
+	like := func(logId uuid.UUID) *httptest.ResponseRecorder {
+		return serve(handler.HandleLikeLog, http.MethodPost, "/log/:logId/like", fmt.Sprintf("/log/%s/like", logId), userId, nil)
+	}
+
+	t.Run("should like a public log", func(t *testing.T) {
+		rr := like(publicLog)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if !store.likes[[2]uuid.UUID{publicLog, userId}] {
+			t.Error("expected the like to be stored")
+		}
+
+		if len(notifier.sent) != 1 || notifier.sent[0].UserID != publicId || notifier.sent[0].Type != types.NotificationLike {
+			t.Error("expected the owner to be notified of the like")
+		}
+	})
+
+	t.Run("should not like a private account's log", func(t *testing.T) {
+		rr := like(privateLog)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should fail if the log does not exist", func(t *testing.T) {
+		rr := like(uuid.New())
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func TestCreateComment(t *testing.T) {
+	userId := uuid.New()
+	ownerId := uuid.New()
+	blockerId := uuid.New()
+	logId := uuid.New()
+	otherLogId := uuid.New()
+
+	store := &mockSocialStore{owners: map[uuid.UUID]uuid.UUID{logId: ownerId, otherLogId: ownerId}}
+	safety := &mockSafetyStore{blocks: map[[2]uuid.UUID]bool{{blockerId, userId}: true}}
+	notifier := &mockNotifier{}
+	handler := newTestHandler(store, map[uuid.UUID]*types.Profile{
+		ownerId: {UserID: ownerId, Public: true},
+	}, safety, notifier)
+
+	comment := func(payload types.CreateCommentPayload) *httptest.ResponseRecorder {
+		return serve(handler.HandleCreateComment, http.MethodPost, "/log/:logId/comments", fmt.Sprintf("/log/%s/comments", logId), userId, payload)
+	}
+
+	t.Run("should fail if the body is empty", func(t *testing.T) {
+		rr := comment(types.CreateCommentPayload{})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should reply to a comment on the same log", func(t *testing.T) {
+		authorId := uuid.New()
+		parent := types.Comment{ID: uuid.New(), LogID: logId, UserID: authorId, CreatedAt: time.Now()}
+		store.CreateComment(parent)
+
+		rr := comment(types.CreateCommentPayload{Body: "Nice work", ParentID: &parent.ID})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		if len(notifier.sent) != 2 || notifier.sent[0].UserID != ownerId || notifier.sent[1].UserID != authorId {
+			t.Error("expected the owner and the parent's author to be notified")
+		}
+	})
+
+	t.Run("should not reply to a comment on another log", func(t *testing.T) {
+		parent := types.Comment{ID: uuid.New(), LogID: otherLogId, UserID: ownerId, CreatedAt: time.Now()}
+		store.CreateComment(parent)
+
+		rr := comment(types.CreateCommentPayload{Body: "Nice work", ParentID: &parent.ID})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should not reply to a user who blocked the caller", func(t *testing.T) {
+		parent := types.Comment{ID: uuid.New(), LogID: logId, UserID: blockerId, CreatedAt: time.Now()}
+		store.CreateComment(parent)
+
+		rr := comment(types.CreateCommentPayload{Body: "Nice work", ParentID: &parent.ID})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should rate limit comments", func(t *testing.T) {
+		limit := config.Envs.CommentRateLimit
+		config.Envs.CommentRateLimit = 1
+		defer func() { config.Envs.CommentRateLimit = limit }()
+
+		rr := comment(types.CreateCommentPayload{Body: "Again"})
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+
+		if rr.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+	})
+}
+
+func TestUpdateComment(t *testing.T) {
+	authorId := uuid.New()
+	ownerId := uuid.New()
+	logId := uuid.New()
+
+	store := &mockSocialStore{owners: map[uuid.UUID]uuid.UUID{logId: ownerId}}
+	safety := &mockSafetyStore{blocks: map[[2]uuid.UUID]bool{}}
+	handler := newTestHandler(store, map[uuid.UUID]*types.Profile{
+		ownerId: {UserID: ownerId, Public: true},
+	}, safety, &mockNotifier{})
+
+	c := types.Comment{ID: uuid.New(), LogID: logId, UserID: authorId}
+	store.CreateComment(c)
+
+	update := func(userId uuid.UUID) *httptest.ResponseRecorder {
+		return serve(handler.HandleUpdateComment, http.MethodPatch, "/comments/:id", fmt.Sprintf("/comments/%s", c.ID), userId, types.UpdateCommentPayload{Body: "Edited"})
+	}
+
+	t.Run("should not let another user edit a comment", func(t *testing.T) {
+		rr := update(ownerId)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should let the author edit a comment", func(t *testing.T) {
+		rr := update(authorId)
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("should not let the author edit once the owner blocked them", func(t *testing.T) {
+		safety.blocks[[2]uuid.UUID{ownerId, authorId}] = true
+
+		rr := update(authorId)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+}
+
+func TestDeleteComment(t *testing.T) {
+	authorId := uuid.New()
+	ownerId := uuid.New()
+	logId := uuid.New()
+
+	store := &mockSocialStore{owners: map[uuid.UUID]uuid.UUID{logId: ownerId}}
+	handler := newTestHandler(store, map[uuid.UUID]*types.Profile{
+		ownerId: {UserID: ownerId, Public: true},
+	}, &mockSafetyStore{}, &mockNotifier{})
+
+	remove := func(id, userId uuid.UUID) *httptest.ResponseRecorder {
+		return serve(handler.HandleDeleteComment, http.MethodDelete, "/comments/:id", fmt.Sprintf("/comments/%s", id), userId, nil)
+	}
+
+	t.Run("should not let another user delete a comment", func(t *testing.T) {
+		c := types.Comment{ID: uuid.New(), LogID: logId, UserID: authorId}
+		store.CreateComment(c)
+
+		rr := remove(c.ID, uuid.New())
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should let the vehicle owner delete a comment", func(t *testing.T) {
+		c := types.Comment{ID: uuid.New(), LogID: logId, UserID: authorId}
+		store.CreateComment(c)
+
+		rr := remove(c.ID, ownerId)
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if _, err := store.GetCommentByID(c.ID); err == nil {
+			t.Error("expected the comment to be deleted")
+		}
+	})
+}
+
+type mockSocialStore struct {
+	owners   map[uuid.UUID]uuid.UUID
+	likes    map[[2]uuid.UUID]bool
+	comments []*types.Comment
+}
+
+func (m *mockSocialStore) GetLogOwner(logId uuid.UUID) (uuid.UUID, error) {
+	owner, ok := m.owners[logId]
+	if !ok {
+		return uuid.Nil, fmt.Errorf("log not found")
+	}
+
+	return owner, nil
+}
+
+func (m *mockSocialStore) LikeLog(logId, userId uuid.UUID) error {
+	if m.likes == nil {
+		m.likes = make(map[[2]uuid.UUID]bool)
+	}
+	m.likes[[2]uuid.UUID{logId, userId}] = true
+	return nil
+}
+
+func (m *mockSocialStore) UnlikeLog(logId, userId uuid.UUID) error {
+	delete(m.likes, [2]uuid.UUID{logId, userId})
+	return nil
+}
+
+func (m *mockSocialStore) CreateComment(comment types.Comment) error {
+	m.comments = append(m.comments, &comment)
+	return nil
+}
+
+func (m *mockSocialStore) GetCommentByID(id uuid.UUID) (*types.Comment, error) {
+	for _, c := range m.comments {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+
+	return nil, fmt.Errorf("comment not found")
+}
+
+func (m *mockSocialStore) GetLogComments(logId, viewerId uuid.UUID, page types.PageRequest) ([]*types.Comment, error) {
+	return nil, nil
+}
+
+func (m *mockSocialStore) UpdateComment(id uuid.UUID, body string) error {
+	return nil
+}
+
+func (m *mockSocialStore) DeleteComment(id uuid.UUID) error {
+	for i, c := range m.comments {
+		if c.ID == id {
+			m.comments = append(m.comments[:i], m.comments[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (m *mockSocialStore) CountUserCommentsSince(userId uuid.UUID, since time.Time) (int, error) {
+	count := 0
+	for _, c := range m.comments {
+		if c.UserID == userId && !c.CreatedAt.Before(since) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+type mockNotifier struct {
+	sent []types.Notification
+}
+
+func (m *mockNotifier) Notify(n types.Notification) {
+	m.sent = append(m.sent, n)
+}
+
+type mockProfileStore struct {
+	profiles map[uuid.UUID]*types.Profile
+}
+
+func (m *mockProfileStore) GetProfileByUserId(userId uuid.UUID) (*types.Profile, error) {
+	p, ok := m.profiles[userId]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return p, nil
+}
+
+func (m *mockProfileStore) CreateProfile(types.Profile) error {
+	return nil
+}
+
+func (m *mockProfileStore) UpdateAvatar(userId uuid.UUID, avatar string) error {
+	return nil
+}
+
+func (m *mockProfileStore) IsUsernameAvailable(username string, userId uuid.UUID) (bool, error) {
+	return true, nil
+}
+
+func (m *mockProfileStore) UpdateProfile(userId uuid.UUID, payload types.UpdateProfilePayload, reserveOldUntil time.Time) error {
+	return nil
+}
+
+type mockFollowerStore struct{}
+
+func (m *mockFollowerStore) FollowUser(followerId, followingId uuid.UUID, status string) error {
+	return nil
+}
+
+func (m *mockFollowerStore) UnfollowUser(followerId, followingId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockFollowerStore) GetFollower(followerId, followingId uuid.UUID) (*types.Follower, error) {
+	return nil, nil
+}
+
+func (m *mockFollowerStore) GetIncomingFollowRequests(userId uuid.UUID) ([]*types.FollowRequest, error) {
+	return nil, nil
+}
+
+func (m *mockFollowerStore) GetOutgoingFollowRequests(userId uuid.UUID) ([]*types.FollowRequest, error) {
+	return nil, nil
+}
+
+func (m *mockFollowerStore) AcceptFollowRequest(id, followingId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockFollowerStore) RejectFollowRequest(id, followingId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockFollowerStore) GetFollowers(userId, viewerId uuid.UUID, page types.PageRequest) ([]*types.FollowListEntry, error) {
+	return nil, nil
+}
+
+func (m *mockFollowerStore) GetFollowing(userId, viewerId uuid.UUID, page types.PageRequest) ([]*types.FollowListEntry, error) {
+	return nil, nil
+}
+
+type mockSafetyStore struct {
+	blocks map[[2]uuid.UUID]bool
+}
+
+func (m *mockSafetyStore) BlockUser(blockerId, blockedId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockSafetyStore) UnblockUser(blockerId, blockedId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockSafetyStore) IsBlocked(userId, otherId uuid.UUID) (bool, error) {
+	return m.blocks[[2]uuid.UUID{userId, otherId}] || m.blocks[[2]uuid.UUID{otherId, userId}], nil
+}
+
+func (m *mockSafetyStore) GetBlockedUsers(userId uuid.UUID) ([]*types.UserRelation, error) {
+	return nil, nil
+}
+
+func (m *mockSafetyStore) MuteUser(muterId, mutedId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockSafetyStore) UnmuteUser(muterId, mutedId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockSafetyStore) GetMutedUsers(userId uuid.UUID) ([]*types.UserRelation, error) {
+	return nil, nil
+}
+
+func (m *mockSafetyStore) GetMutedUserIDs(userId uuid.UUID) ([]uuid.UUID, error) {
+	return nil, nil
+}
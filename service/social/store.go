@@ -0,0 +1,191 @@
+package social
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/ZondaF12/logbook-backend/utils"
+	"github.com/google/uuid"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) GetLogOwner(logId uuid.UUID) (uuid.UUID, error) {
+	var ownerId uuid.UUID
+	err := s.db.QueryRow("SELECT v.user_id FROM logs l JOIN vehicles v ON v.id = l.vehicle_id WHERE l.id = ?", logId).Scan(&ownerId)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, fmt.Errorf("log not found")
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return ownerId, nil
+}
+
+func (s *Store) LikeLog(logId, userId uuid.UUID) error {
+	_, err := s.db.Exec("INSERT IGNORE INTO log_likes (log_id, user_id) VALUES (?, ?)", logId, userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) UnlikeLog(logId, userId uuid.UUID) error {
+	_, err := s.db.Exec("DELETE FROM log_likes WHERE log_id = ? AND user_id = ?", logId, userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) CreateComment(comment types.Comment) error {
+	_, err := s.db.Exec(`
+		INSERT INTO log_comments (id, log_id, user_id, parent_id, body)
+		VALUES (?, ?, ?, ?, ?)`,
+		comment.ID, comment.LogID, comment.UserID, comment.ParentID, comment.Body)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func scanRowIntoComment(rows *sql.Rows) (*types.Comment, error) {
+	comment := new(types.Comment)
+
+	err := rows.Scan(
+		&comment.ID,
+		&comment.LogID,
+		&comment.UserID,
+		&comment.ParentID,
+		&comment.Body,
+		&comment.CreatedAt,
+		&comment.EditedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+func (s *Store) GetCommentByID(id uuid.UUID) (*types.Comment, error) {
+	rows, err := s.db.Query("SELECT * FROM log_comments WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comment := new(types.Comment)
+	for rows.Next() {
+		comment, err = scanRowIntoComment(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if comment.ID == uuid.Nil {
+		return nil, fmt.Errorf("comment not found")
+	}
+
+	return comment, nil
+}
+
+func (s *Store) GetLogComments(logId, viewerId uuid.UUID, page types.PageRequest) ([]*types.Comment, error) {
+	query := `
+		SELECT
+			c.*,
+			` + utils.ProfileSummaryColumns + `
+		FROM log_comments c
+		LEFT JOIN profiles p ON p.user_id = c.user_id
+		WHERE c.log_id = ?
+			AND NOT EXISTS(
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = ? AND b.blocked_id = c.user_id) OR (b.blocker_id = c.user_id AND b.blocked_id = ?)
+			)`
+	args := []interface{}{logId, viewerId, viewerId}
+
+	if page.After != nil {
+		query += " AND (c.created_at > ? OR (c.created_at = ? AND c.id > ?))"
+		args = append(args, page.After.CreatedAt, page.After.CreatedAt, page.After.ID)
+	}
+
+	query += " ORDER BY c.created_at, c.id LIMIT ?"
+	args = append(args, page.Limit+1)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := make([]*types.Comment, 0)
+	for rows.Next() {
+		comment := &types.Comment{Author: new(types.ProfileSummary)}
+
+		err := rows.Scan(
+			&comment.ID,
+			&comment.LogID,
+			&comment.UserID,
+			&comment.ParentID,
+			&comment.Body,
+			&comment.CreatedAt,
+			&comment.EditedAt,
+			&comment.Author.ID,
+			&comment.Author.Username,
+			&comment.Author.Name,
+			&comment.Author.Avatar,
+			&comment.Author.Public,
+		)
+		if err != nil {
+			return nil, err
+		}
+		comment.Author.UserID = comment.UserID
+
+		comments = append(comments, comment)
+	}
+
+	return comments, nil
+}
+
+func (s *Store) UpdateComment(id uuid.UUID, body string) error {
+	_, err := s.db.Exec("UPDATE log_comments SET body = ?, edited_at = CURRENT_TIMESTAMP WHERE id = ?", body, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteComment removes the comment and, through the foreign key, its replies.
+func (s *Store) DeleteComment(id uuid.UUID) error {
+	_, err := s.db.Exec("DELETE FROM log_comments WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) CountUserCommentsSince(userId uuid.UUID, since time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM log_comments WHERE user_id = ? AND created_at >= ?", userId, since).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
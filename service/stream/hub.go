@@ -0,0 +1,144 @@
+package stream
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+// MemoryHub is a Hub for single instance deployments. It keeps the last
+// backlog events of every user with a client connected, or one that
+// disconnected less than retention ago.
+type MemoryHub struct {
+	backlog   int
+	retention time.Duration
+
+	mu      sync.Mutex
+	lastId  uint64
+	streams map[uuid.UUID]*userStream
+}
+
+type userStream struct {
+	recent      []types.Event
+	subscribers map[chan types.Event]struct{}
+	idleSince   time.Time
+}
+
+func NewMemoryHub(backlog int, retention time.Duration) *MemoryHub {
+	return &MemoryHub{
+		backlog:   backlog,
+		retention: retention,
+		// Seeding from the clock keeps IDs increasing across restarts, so an
+		// old Last-Event-ID never hides new events
+		lastId:  uint64(time.Now().UnixMicro()),
+		streams: make(map[uuid.UUID]*userStream),
+	}
+}
+
+func (h *MemoryHub) Publish(userId uuid.UUID, eventType string, data any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Nobody is listening or about to resume
+	stream, ok := h.streams[userId]
+	if !ok {
+		return
+	}
+
+	h.lastId++
+	event := types.Event{ID: strconv.FormatUint(h.lastId, 10), Type: eventType, Data: data}
+
+	stream.recent = append(stream.recent, event)
+	if len(stream.recent) > h.backlog {
+		stream.recent = stream.recent[len(stream.recent)-h.backlog:]
+	}
+
+	for ch := range stream.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// A slow client is dropped rather than blocking everyone else, it
+			// can reconnect and resume from the kept events
+			delete(stream.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	if len(stream.subscribers) == 0 && stream.idleSince.IsZero() {
+		stream.idleSince = time.Now()
+	}
+}
+
+func (h *MemoryHub) Subscribe(userId uuid.UUID, lastEventId string) (<-chan types.Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stream, ok := h.streams[userId]
+	if !ok {
+		stream = &userStream{subscribers: make(map[chan types.Event]struct{})}
+		h.streams[userId] = stream
+	}
+
+	ch := make(chan types.Event, h.backlog)
+
+	if last, err := strconv.ParseUint(lastEventId, 10, 64); err == nil {
+		for _, event := range stream.recent {
+			if id, _ := strconv.ParseUint(event.ID, 10, 64); id > last {
+				ch <- event
+			}
+		}
+	}
+
+	stream.subscribers[ch] = struct{}{}
+	stream.idleSince = time.Time{}
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			if _, ok := stream.subscribers[ch]; ok {
+				delete(stream.subscribers, ch)
+				close(ch)
+			}
+
+			if len(stream.subscribers) == 0 {
+				stream.idleSince = time.Now()
+			}
+		})
+	}
+
+	return ch, cancel
+}
+
+// Run drops the kept events of users who have been disconnected for longer
+// than the retention every interval until ctx is cancelled.
+func (h *MemoryHub) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.Prune(time.Now())
+		}
+	}
+}
+
+func (h *MemoryHub) Prune(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for userId, stream := range h.streams {
+		if len(stream.subscribers) == 0 && now.Sub(stream.idleSince) > h.retention {
+			delete(h.streams, userId)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+func receive(t *testing.T, events <-chan types.Event) types.Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("expected an event, the channel was closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+
+	return types.Event{}
+}
+
+func TestMemoryHub(t *testing.T) {
+	t.Run("should only deliver to the user's subscribers", func(t *testing.T) {
+		hub := NewMemoryHub(10, time.Minute)
+		userId := uuid.New()
+
+		events, cancel := hub.Subscribe(userId, "")
+		defer cancel()
+
+		hub.Publish(uuid.New(), types.EventNotification, "someone else")
+		hub.Publish(userId, types.EventNotification, "hello")
+
+		if event := receive(t, events); event.Data != "hello" {
+			t.Errorf("expected hello, got %v", event.Data)
+		}
+	})
+
+	t.Run("should resume after the last event", func(t *testing.T) {
+		hub := NewMemoryHub(10, time.Minute)
+		userId := uuid.New()
+
+		events, cancel := hub.Subscribe(userId, "")
+		hub.Publish(userId, types.EventNotification, "first")
+		first := receive(t, events)
+		cancel()
+
+		// Published while the client was reconnecting
+		hub.Publish(userId, types.EventNotification, "second")
+		hub.Publish(userId, types.EventFeedItem, "third")
+
+		events, cancel = hub.Subscribe(userId, first.ID)
+		defer cancel()
+
+		if event := receive(t, events); event.Data != "second" {
+			t.Errorf("expected second, got %v", event.Data)
+		}
+		if event := receive(t, events); event.Data != "third" || event.Type != types.EventFeedItem {
+			t.Errorf("expected third feed item, got %v %v", event.Type, event.Data)
+		}
+	})
+
+	t.Run("should drop a subscriber that falls behind", func(t *testing.T) {
+		hub := NewMemoryHub(2, time.Minute)
+		userId := uuid.New()
+
+		events, cancel := hub.Subscribe(userId, "")
+		defer cancel()
+
+		for i := 0; i < 3; i++ {
+			hub.Publish(userId, types.EventNotification, i)
+		}
+
+		receive(t, events)
+		receive(t, events)
+		if _, ok := <-events; ok {
+			t.Error("expected the channel to be closed")
+		}
+	})
+
+	t.Run("should forget users that stay disconnected", func(t *testing.T) {
+		hub := NewMemoryHub(10, time.Minute)
+		userId := uuid.New()
+
+		_, cancel := hub.Subscribe(userId, "")
+		hub.Publish(userId, types.EventNotification, "missed")
+		cancel()
+
+		hub.Prune(time.Now().Add(2 * time.Minute))
+
+		events, cancel := hub.Subscribe(userId, "0")
+		defer cancel()
+
+		select {
+		case event := <-events:
+			t.Errorf("expected no events to be kept, got %v", event.Data)
+		default:
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	hub       types.Hub
+	userStore types.UserStore
+	heartbeat time.Duration
+}
+
+func NewHandler(hub types.Hub, userStore types.UserStore, heartbeat time.Duration) *Handler {
+	return &Handler{
+		hub:       hub,
+		userStore: userStore,
+		heartbeat: heartbeat,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *echo.Group) {
+	router.GET("/stream", auth.WithJWTAuth(h.HandleStream, h.userStore))
+}
+
+// HandleStream pushes the user's events as Server-Sent Events until the
+// client disconnects. Comments are sent as heartbeats so proxies don't close
+// an idle connection.
+func (h *Handler) HandleStream(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	// EventSource sends the header on reconnect, the query parameter is for
+	// clients that can't set headers
+	lastEventId := c.Request().Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = c.QueryParam("last_event_id")
+	}
+
+	events, cancel := h.hub.Subscribe(userId, lastEventId)
+	defer cancel()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(res, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+	res.Flush()
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case event, ok := <-events:
+			// The hub dropped us for falling behind, the client reconnects
+			// and resumes
+			if !ok {
+				return nil
+			}
+
+			if err := writeEvent(res, event); err != nil {
+				return nil
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+		}
+
+		res.Flush()
+	}
+}
+
+func writeEvent(res *echo.Response, event types.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(res, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
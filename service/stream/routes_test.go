@@ -0,0 +1,53 @@
+package stream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestHandleStream(t *testing.T) {
+	userId := uuid.New()
+	hub := NewMemoryHub(10, time.Minute)
+
+	// An earlier connection saw nothing before this event was published
+	_, cancel := hub.Subscribe(userId, "")
+	hub.Publish(userId, types.EventNotification, map[string]string{"type": "follow"})
+	cancel()
+
+	handler := NewHandler(hub, nil, 10*time.Millisecond)
+
+	ctx, stop := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer stop()
+
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	req = req.WithContext(context.WithValue(ctx, auth.UserKey, userId))
+
+	rr := httptest.NewRecorder()
+	router := echo.New()
+
+	router.GET("/stream", handler.HandleStream)
+	router.ServeHTTP(rr, req)
+
+	if ct := rr.Header().Get(echo.HeaderContentType); ct != "text/event-stream" {
+		t.Errorf("expected an event stream, got %q", ct)
+	}
+
+	body := rr.Body.String()
+	if !strings.Contains(body, "event: notification\ndata: {\"type\":\"follow\"}\n\n") {
+		t.Errorf("expected the missed notification to be replayed, got %q", body)
+	}
+
+	if !strings.Contains(body, ": heartbeat\n\n") {
+		t.Errorf("expected a heartbeat, got %q", body)
+	}
+}
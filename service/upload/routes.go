@@ -0,0 +1,401 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/config"
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/blob"
+	"github.com/ZondaF12/logbook-backend/service/media"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/ZondaF12/logbook-backend/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	store        types.UploadStore
+	userStore    types.UserStore
+	garageStore  types.GarageStore
+	logbookStore types.LogbookStore
+	mediaStore   types.MediaStore
+	profileStore types.ProfileStore
+	publisher    types.FeedPublisher
+	blobs        types.BlobStore
+	images       *media.Processor
+}
+
+func NewHandler(store types.UploadStore, userStore types.UserStore, garageStore types.GarageStore, logbookStore types.LogbookStore, mediaStore types.MediaStore, profileStore types.ProfileStore, publisher types.FeedPublisher, blobs types.BlobStore, images *media.Processor) *Handler {
+	return &Handler{
+		store:        store,
+		userStore:    userStore,
+		garageStore:  garageStore,
+		logbookStore: logbookStore,
+		mediaStore:   mediaStore,
+		profileStore: profileStore,
+		publisher:    publisher,
+		blobs:        blobs,
+		images:       images,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *echo.Group) {
+	router.POST("/uploads", auth.WithJWTAuth(h.HandleCreateUpload, h.userStore))
+	router.POST("/uploads/:id/confirm", auth.WithJWTAuth(h.HandleConfirmUpload, h.userStore))
+}
+
+func (h *Handler) HandleCreateUpload(c echo.Context) error {
+	// Parse payload
+	var payload types.CreateUploadPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	if err := media.CheckType(payload.Kind, payload.ContentType); err != nil {
+		return err
+	}
+
+	if err := media.CheckSize(payload.Kind, payload.Size); err != nil {
+		return err
+	}
+
+	filename, err := media.SanitizeFilename(payload.Filename)
+	if err != nil {
+		return err
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	if err := h.checkTarget(userId, payload.Kind, payload.TargetID); err != nil {
+		return err
+	}
+
+	if payload.Kind == types.UploadAvatar {
+		payload.TargetID = nil
+	}
+
+	// The checksum is compared against a lowercase hex digest on confirm
+	now := time.Now()
+	upload := types.Upload{
+		ID:          uuid.New(),
+		UserID:      userId,
+		Kind:        payload.Kind,
+		TargetID:    payload.TargetID,
+		Filename:    filename,
+		ContentType: payload.ContentType,
+		Size:        payload.Size,
+		Checksum:    strings.ToLower(payload.Checksum),
+		ExpiresAt:   now.Add(time.Second * time.Duration(config.Envs.UploadExpirationInSeconds)),
+		CreatedAt:   now,
+	}
+	upload.ObjectKey = objectKey(upload)
+
+	// The URL never outlives the upload itself
+	ttl := time.Second * time.Duration(config.Envs.UploadURLExpirationInSeconds)
+	if remaining := upload.ExpiresAt.Sub(now); remaining < ttl {
+		ttl = remaining
+	}
+
+	uploadURL, err := h.blobs.SignedUploadURL(c.Request().Context(), upload.ObjectKey, upload.ContentType, upload.Size, ttl)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if err := h.store.CreateUpload(upload); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	upload.UploadURL = uploadURL
+
+	return c.JSON(http.StatusCreated, upload)
+}
+
+func (h *Handler) HandleConfirmUpload(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid upload ID")
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	upload, err := h.store.GetUploadByID(id)
+	if err != nil || upload.UserID != userId {
+		return echo.NewHTTPError(http.StatusNotFound, "Upload not found")
+	}
+
+	if upload.ConfirmedAt != nil {
+		return echo.NewHTTPError(http.StatusConflict, "Upload already confirmed")
+	}
+
+	if time.Now().After(upload.ExpiresAt) {
+		return echo.NewHTTPError(http.StatusGone, "Upload expired")
+	}
+
+	// The target may have been deleted or changed hands since the upload
+	// was created
+	if err := h.checkTarget(userId, upload.Kind, upload.TargetID); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.verify(c, upload); err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) && httpErr.Code == http.StatusBadRequest {
+			// Throw away the bad file so the client can retry with the same
+			// upload until it expires
+			if err := h.blobs.Delete(ctx, []string{upload.ObjectKey}, nil); err != nil {
+				log.Printf("error deleting upload %s: %v", upload.ID, err)
+			}
+		}
+		return err
+	}
+
+	// Claim the upload so a concurrent confirm can't attach it twice. Once
+	// claimed the file may become the media or avatar itself, so the sweeper
+	// leaves it alone
+	if err := h.store.ConfirmUpload(upload.ID); err != nil {
+		return echo.NewHTTPError(http.StatusConflict, "Upload already confirmed")
+	}
+
+	uploaded, location, err := h.attach(c, userId, upload)
+	if err != nil {
+		// Hand the upload back so the client can retry until it expires
+		if err := h.store.ReleaseUpload(upload.ID); err != nil {
+			log.Printf("error releasing upload %s: %v", upload.ID, err)
+		}
+		return err
+	}
+
+	if err := h.store.DeleteUpload(upload.ID); err != nil {
+		log.Printf("error deleting upload %s: %v", upload.ID, err)
+	}
+
+	if uploaded == nil {
+		return c.JSON(http.StatusOK, location)
+	}
+
+	return c.JSON(http.StatusOK, uploaded)
+}
+
+// attach turns a verified upload into media, or the user's avatar. Nothing
+// it wrote is left behind when it fails.
+func (h *Handler) attach(c echo.Context, userId uuid.UUID, upload *types.Upload) (*types.Media, string, error) {
+	ctx := c.Request().Context()
+	location := h.blobs.Location(upload.ObjectKey)
+	fileType := upload.ContentType
+
+	// Vehicle and log images are swapped for resized copies without their
+	// EXIF data
+	var renditions *types.Renditions
+	var err error
+	if upload.Kind != types.UploadAvatar && media.IsImage(upload.ContentType) {
+		renditions, err = h.process(c, upload)
+		if err != nil {
+			return nil, "", err
+		}
+
+		location = h.blobs.Location(renditions.Full)
+		fileType = "image/jpeg"
+	}
+
+	var uploaded *types.Media
+	switch upload.Kind {
+	case types.UploadVehicleImage:
+		uploaded = newMedia(upload, fileType, location, renditions)
+		uploaded.VehicleID = upload.TargetID
+		err = h.mediaStore.AddNewVehicleMedia(*uploaded)
+	case types.UploadLogMedia:
+		uploaded = newMedia(upload, fileType, location, renditions)
+		uploaded.LogID = upload.TargetID
+		err = h.mediaStore.AddNewLogMedia(*uploaded)
+	case types.UploadAvatar:
+		err = h.profileStore.UpdateAvatar(userId, location)
+	}
+	if err != nil {
+		if renditions != nil {
+			keys := []string{renditions.Thumbnail, renditions.Medium, renditions.Full}
+			if err := h.blobs.Delete(ctx, keys, nil); err != nil {
+				log.Printf("error deleting renditions of upload %s: %v", upload.ID, err)
+			}
+		}
+		return nil, "", echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	// The original is only needed until the renditions are in use
+	if renditions != nil {
+		if err := h.blobs.Delete(ctx, []string{upload.ObjectKey}, nil); err != nil {
+			log.Printf("error deleting original of upload %s: %v", upload.ID, err)
+		}
+	}
+
+	if upload.Kind == types.UploadVehicleImage {
+		if vehicle, err := h.garageStore.GetVehicleByID(*upload.TargetID); err == nil {
+			h.publisher.Publish(vehicle.UserID, types.FeedItem{
+				ID:        upload.ID,
+				Type:      types.FeedItemVehicleImage,
+				VehicleID: vehicle.ID,
+				Make:      vehicle.Make,
+				Model:     vehicle.Model,
+				Nickname:  vehicle.Nickname,
+				ImageURL:  media.URLs(h.blobs, location, renditions).Preview(),
+			})
+		}
+	}
+
+	return uploaded, location, nil
+}
+
+// process stores the renditions of an uploaded image. A file that isn't an
+// image is thrown away so the client can upload it again.
+func (h *Handler) process(c echo.Context, upload *types.Upload) (*types.Renditions, error) {
+	ctx := c.Request().Context()
+
+	body, err := h.blobs.Get(ctx, upload.ObjectKey)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	defer body.Close()
+
+	renditions, err := h.images.Process(ctx, baseKey(*upload), body)
+	if errors.Is(err, media.ErrNotImage) {
+		if err := h.blobs.Delete(ctx, []string{upload.ObjectKey}, nil); err != nil {
+			log.Printf("error deleting upload %s: %v", upload.ID, err)
+		}
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return renditions, nil
+}
+
+// verify checks the stored file is the one the upload was created for.
+func (h *Handler) verify(c echo.Context, upload *types.Upload) error {
+	ctx := c.Request().Context()
+
+	info, err := h.blobs.Stat(ctx, upload.ObjectKey)
+	if errors.Is(err, blob.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusConflict, "File has not been uploaded")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if info.Size != upload.Size {
+		return echo.NewHTTPError(http.StatusBadRequest, "File size does not match")
+	}
+
+	body, err := h.blobs.Get(ctx, upload.ObjectKey)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	defer body.Close()
+
+	// The declared type can't be trusted, so sniff it from the first bytes
+	head := make([]byte, 512)
+	n, err := io.ReadFull(body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	head = head[:n]
+
+	hash := sha256.New()
+	hash.Write(head)
+	if _, err := io.Copy(hash, body); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != upload.Checksum {
+		return echo.NewHTTPError(http.StatusBadRequest, "File checksum does not match")
+	}
+
+	if media.DetectType(head) != upload.ContentType {
+		return echo.NewHTTPError(http.StatusBadRequest, "File type does not match")
+	}
+
+	return nil
+}
+
+// checkTarget makes sure the user owns the vehicle or log the upload is for.
+func (h *Handler) checkTarget(userId uuid.UUID, kind string, targetId *uuid.UUID) error {
+	if kind == types.UploadAvatar {
+		return nil
+	}
+	if targetId == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing target ID")
+	}
+
+	vehicleId := *targetId
+	if kind == types.UploadLogMedia {
+		l, err := h.logbookStore.GetLogByID(*targetId)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, "Log not found")
+		}
+		vehicleId = l.VehicleID
+	}
+
+	vehicle, err := h.garageStore.GetVehicleByID(vehicleId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if vehicle.ID == uuid.Nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Vehicle not found")
+	}
+
+	if vehicle.UserID != userId {
+		return echo.NewHTTPError(http.StatusForbidden, "Not your vehicle")
+	}
+
+	return nil
+}
+
+func newMedia(upload *types.Upload, fileType, location string, renditions *types.Renditions) *types.Media {
+	return &types.Media{
+		ID:         &upload.ID,
+		Filename:   &upload.Filename,
+		FileType:   &fileType,
+		S3Location: &location,
+		UserID:     &upload.UserID,
+		Renditions: renditions,
+	}
+}
+
+// targetKeyId is the ID keys of the upload are built from. Keys go under the
+// same prefixes as the files they sit next to, so purging an account or
+// vehicle removes them too.
+func targetKeyId(upload types.Upload) uuid.UUID {
+	if upload.Kind == types.UploadAvatar {
+		return upload.UserID
+	}
+
+	return *upload.TargetID
+}
+
+func baseKey(upload types.Upload) string {
+	return media.Key(upload.Kind, targetKeyId(upload), upload.ID)
+}
+
+// objectKey is where the client uploads to.
+func objectKey(upload types.Upload) string {
+	return media.OriginalKey(upload.Kind, targetKeyId(upload), upload.ID)
+}
@@ -0,0 +1,485 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/blob"
+	"github.com/ZondaF12/logbook-backend/service/media"
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+var pngData = func() []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 30)))
+	return buf.Bytes()
+}()
+
+func TestCreateUpload(t *testing.T) {
+	userId := uuid.New()
+	vehicleId := uuid.New()
+	otherVehicleId := uuid.New()
+
+	handler, store, _ := newTestHandler(t, userId, vehicleId, otherVehicleId)
+
+	create := func(payload map[string]interface{}) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(payload)
+
+		req := httptest.NewRequest(http.MethodPost, "/uploads", bytes.NewBuffer(marshalled))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userId))
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.POST("/uploads", handler.HandleCreateUpload)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	payload := func(targetId uuid.UUID, contentType string, size int) map[string]interface{} {
+		return map[string]interface{}{
+			"kind":         types.UploadVehicleImage,
+			"target_id":    targetId,
+			"filename":     "car.png",
+			"content_type": contentType,
+			"size":         size,
+			"checksum":     checksum(pngData),
+		}
+	}
+
+	t.Run("should return a signed upload URL", func(t *testing.T) {
+		rr := create(payload(vehicleId, "image/png", len(pngData)))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		var upload types.Upload
+		json.NewDecoder(rr.Body).Decode(&upload)
+
+		if upload.UploadURL == "" {
+			t.Error("expected an upload URL")
+		}
+
+		stored := store.uploads[upload.ID]
+		if stored == nil || stored.ObjectKey != fmt.Sprintf("vehicles/%s/images/%s/original", vehicleId, upload.ID) {
+			t.Errorf("unexpected stored upload %+v", stored)
+		}
+	})
+
+	t.Run("should accept an uppercase checksum", func(t *testing.T) {
+		body := payload(vehicleId, "image/png", len(pngData))
+		body["checksum"] = strings.ToUpper(checksum(pngData))
+
+		rr := create(body)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		var upload types.Upload
+		json.NewDecoder(rr.Body).Decode(&upload)
+
+		if stored := store.uploads[upload.ID]; stored == nil || stored.Checksum != checksum(pngData) {
+			t.Errorf("expected the checksum to be stored in lowercase, got %+v", stored)
+		}
+	})
+
+	t.Run("should reject another user's vehicle", func(t *testing.T) {
+		rr := create(payload(otherVehicleId, "image/png", len(pngData)))
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should reject a type that isn't allowed", func(t *testing.T) {
+		rr := create(payload(vehicleId, "application/pdf", len(pngData)))
+		if rr.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("expected status code %d, got %d", http.StatusUnsupportedMediaType, rr.Code)
+		}
+	})
+
+	t.Run("should reject a file that is too large", func(t *testing.T) {
+		rr := create(payload(vehicleId, "image/png", 1<<30))
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status code %d, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+		}
+	})
+}
+
+func TestConfirmUpload(t *testing.T) {
+	userId := uuid.New()
+	vehicleId := uuid.New()
+
+	handler, store, blobs := newTestHandler(t, userId, vehicleId, uuid.New())
+	mediaStore := handler.mediaStore.(*mockMediaStore)
+
+	newUpload := func(data []byte, expiresAt time.Time) *types.Upload {
+		upload := &types.Upload{
+			ID:          uuid.New(),
+			UserID:      userId,
+			Kind:        types.UploadVehicleImage,
+			TargetID:    &vehicleId,
+			Filename:    "car.png",
+			ContentType: "image/png",
+			Size:        int64(len(pngData)),
+			Checksum:    checksum(pngData),
+			ExpiresAt:   expiresAt,
+		}
+		upload.ObjectKey = objectKey(*upload)
+		store.uploads[upload.ID] = upload
+
+		if data != nil {
+			if _, err := blobs.Put(context.Background(), upload.ObjectKey, "image/png", bytes.NewReader(data), int64(len(data))); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return upload
+	}
+
+	confirm := func(id uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/uploads/%s/confirm", id), nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userId))
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.POST("/uploads/:id/confirm", handler.HandleConfirmUpload)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should add the media once the file matches", func(t *testing.T) {
+		upload := newUpload(pngData, time.Now().Add(time.Hour))
+
+		rr := confirm(upload.ID)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		if len(mediaStore.vehicleMedia) != 1 || mediaStore.vehicleMedia[0].Renditions == nil {
+			t.Fatalf("expected the media to be added with renditions, got %+v", mediaStore.vehicleMedia)
+		}
+
+		full := mediaStore.vehicleMedia[0].Renditions.Full
+		if *mediaStore.vehicleMedia[0].S3Location != blobs.Location(full) {
+			t.Errorf("expected the media to point at the full rendition, got %s", *mediaStore.vehicleMedia[0].S3Location)
+		}
+
+		if _, err := blobs.Stat(context.Background(), upload.ObjectKey); err != blob.ErrNotFound {
+			t.Errorf("expected the original to be removed, got %v", err)
+		}
+
+		if _, ok := store.uploads[upload.ID]; ok {
+			t.Error("expected the pending upload to be removed")
+		}
+	})
+
+	t.Run("should conflict before the file is uploaded", func(t *testing.T) {
+		upload := newUpload(nil, time.Now().Add(time.Hour))
+
+		rr := confirm(upload.ID)
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should reject and remove a file that doesn't match", func(t *testing.T) {
+		tampered := bytes.Clone(pngData)
+		tampered[len(tampered)-1] ^= 0xFF
+		upload := newUpload(tampered, time.Now().Add(time.Hour))
+
+		rr := confirm(upload.ID)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+
+		if _, err := blobs.Stat(context.Background(), upload.ObjectKey); err != blob.ErrNotFound {
+			t.Errorf("expected the file to be removed, got %v", err)
+		}
+	})
+
+	t.Run("should reject a file that isn't the declared type", func(t *testing.T) {
+		text := []byte(strings.Repeat("x", len(pngData)))
+		upload := newUpload(text, time.Now().Add(time.Hour))
+		upload.Checksum = checksum(text)
+
+		rr := confirm(upload.ID)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should release an upload that isn't an image", func(t *testing.T) {
+		// Sniffs as a PNG but can't be decoded
+		broken := append(bytes.Clone(pngData[:8]), bytes.Repeat([]byte{0xFF}, 64)...)
+		upload := newUpload(broken, time.Now().Add(time.Hour))
+		upload.Size = int64(len(broken))
+		upload.Checksum = checksum(broken)
+
+		rr := confirm(upload.ID)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+		}
+
+		if upload.ConfirmedAt != nil {
+			t.Error("expected the upload to be released")
+		}
+
+		// The file is gone, so a retry asks for it to be uploaded again
+		rr = confirm(upload.ID)
+		if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "File has not been uploaded") {
+			t.Errorf("expected the file to be missing, got %d: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("should clean up when the media can't be added", func(t *testing.T) {
+		upload := newUpload(pngData, time.Now().Add(time.Hour))
+		mediaStore.err = fmt.Errorf("database unavailable")
+
+		rr := confirm(upload.ID)
+		mediaStore.err = nil
+		if rr.Code != http.StatusInternalServerError {
+			t.Fatalf("expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+
+		if upload.ConfirmedAt != nil {
+			t.Error("expected the upload to be released")
+		}
+
+		if _, err := blobs.Stat(context.Background(), baseKey(*upload)+"/full.jpg"); err != blob.ErrNotFound {
+			t.Errorf("expected the renditions to be removed, got %v", err)
+		}
+
+		if _, err := blobs.Stat(context.Background(), upload.ObjectKey); err != nil {
+			t.Errorf("expected the original to be kept for a retry, got %v", err)
+		}
+
+		rr = confirm(upload.ID)
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected the retry to succeed, got %d: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("should reject an expired upload", func(t *testing.T) {
+		upload := newUpload(pngData, time.Now().Add(-time.Minute))
+
+		rr := confirm(upload.ID)
+		if rr.Code != http.StatusGone {
+			t.Errorf("expected status code %d, got %d", http.StatusGone, rr.Code)
+		}
+	})
+
+	t.Run("should not confirm an upload twice", func(t *testing.T) {
+		upload := newUpload(pngData, time.Now().Add(time.Hour))
+		confirmedAt := time.Now()
+		upload.ConfirmedAt = &confirmedAt
+
+		rr := confirm(upload.ID)
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+}
+
+func TestSweepExpired(t *testing.T) {
+	handler, store, blobs := newTestHandler(t, uuid.New(), uuid.New(), uuid.New())
+	ctx := context.Background()
+
+	confirmedAt := time.Now().Add(-time.Hour)
+	expired := &types.Upload{ID: uuid.New(), ObjectKey: "avatars/user/1/expired", ExpiresAt: time.Now().Add(-time.Minute)}
+	active := &types.Upload{ID: uuid.New(), ObjectKey: "avatars/user/1/active", ExpiresAt: time.Now().Add(time.Hour)}
+	confirmed := &types.Upload{ID: uuid.New(), ObjectKey: "avatars/user/1/confirmed", ExpiresAt: time.Now().Add(-time.Minute), ConfirmedAt: &confirmedAt}
+	for _, upload := range []*types.Upload{expired, active, confirmed} {
+		store.uploads[upload.ID] = upload
+		blobs.Put(ctx, upload.ObjectKey, "image/png", bytes.NewReader(pngData), int64(len(pngData)))
+	}
+
+	if err := NewSweeper(store, handler.blobs).SweepExpired(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.uploads[expired.ID]; ok {
+		t.Error("expected the expired upload to be removed")
+	}
+	if _, err := blobs.Stat(ctx, expired.ObjectKey); err != blob.ErrNotFound {
+		t.Errorf("expected the expired file to be removed, got %v", err)
+	}
+	if _, ok := store.uploads[active.ID]; !ok {
+		t.Error("expected the active upload to be kept")
+	}
+	if _, ok := store.uploads[confirmed.ID]; ok {
+		t.Error("expected the confirmed upload to be removed")
+	}
+	if _, err := blobs.Stat(ctx, confirmed.ObjectKey); err != nil {
+		t.Errorf("expected the confirmed file to be kept, got %v", err)
+	}
+}
+
+func newTestHandler(t *testing.T, userId, vehicleId, otherVehicleId uuid.UUID) (*Handler, *mockUploadStore, *blob.LocalStore) {
+	blobs, err := blob.NewLocalStore(t.TempDir(), "", "http://localhost:8080/blobs", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &mockUploadStore{uploads: make(map[uuid.UUID]*types.Upload)}
+	garage := &mockGarageStore{vehicles: map[uuid.UUID]*types.Vehicle{
+		vehicleId:      {ID: vehicleId, UserID: userId},
+		otherVehicleId: {ID: otherVehicleId, UserID: uuid.New()},
+	}}
+
+	handler := NewHandler(store, nil, garage, nil, &mockMediaStore{}, nil, &mockPublisher{}, blobs, media.NewProcessor(blobs))
+
+	return handler, store, blobs
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type mockUploadStore struct {
+	uploads map[uuid.UUID]*types.Upload
+}
+
+func (m *mockUploadStore) CreateUpload(upload types.Upload) error {
+	m.uploads[upload.ID] = &upload
+	return nil
+}
+
+func (m *mockUploadStore) GetUploadByID(id uuid.UUID) (*types.Upload, error) {
+	upload, ok := m.uploads[id]
+	if !ok {
+		return nil, fmt.Errorf("upload not found")
+	}
+	return upload, nil
+}
+
+func (m *mockUploadStore) ConfirmUpload(id uuid.UUID) error {
+	upload, ok := m.uploads[id]
+	if !ok || upload.ConfirmedAt != nil {
+		return fmt.Errorf("upload already confirmed")
+	}
+	now := time.Now()
+	upload.ConfirmedAt = &now
+	return nil
+}
+
+func (m *mockUploadStore) ReleaseUpload(id uuid.UUID) error {
+	if upload, ok := m.uploads[id]; ok {
+		upload.ConfirmedAt = nil
+	}
+	return nil
+}
+
+func (m *mockUploadStore) DeleteUpload(id uuid.UUID) error {
+	delete(m.uploads, id)
+	return nil
+}
+
+func (m *mockUploadStore) GetExpiredUploads(now time.Time) ([]*types.Upload, error) {
+	uploads := make([]*types.Upload, 0)
+	for _, upload := range m.uploads {
+		if !upload.ExpiresAt.After(now) {
+			uploads = append(uploads, upload)
+		}
+	}
+	return uploads, nil
+}
+
+type mockGarageStore struct {
+	vehicles map[uuid.UUID]*types.Vehicle
+}
+
+func (m *mockGarageStore) GetVehicleByID(id uuid.UUID) (*types.Vehicle, error) {
+	if vehicle, ok := m.vehicles[id]; ok {
+		return vehicle, nil
+	}
+	return &types.Vehicle{}, nil
+}
+
+func (m *mockGarageStore) GetAuthenticatedUserVehicles(userID uuid.UUID) ([]*types.Vehicle, error) {
+	return nil, nil
+}
+
+func (m *mockGarageStore) GetVehicleByRegistration(userId uuid.UUID, registration string) (*types.Vehicle, error) {
+	return nil, nil
+}
+
+func (m *mockGarageStore) AddUserVehicle(userID uuid.UUID, vehicle types.NewVehiclePostData) (uuid.UUID, error) {
+	return uuid.Nil, nil
+}
+
+func (m *mockGarageStore) CheckVehicleAdded(userId uuid.UUID, registration string) (bool, error) {
+	return false, nil
+}
+
+func (m *mockGarageStore) UpdateVehicle(userId uuid.UUID, registration string, data types.UpdateVehiclePatchData) error {
+	return nil
+}
+
+type mockMediaStore struct {
+	vehicleMedia []types.Media
+	logMedia     []types.Media
+	err          error
+}
+
+func (m *mockMediaStore) AddNewVehicleMedia(media types.Media) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.vehicleMedia = append(m.vehicleMedia, media)
+	return nil
+}
+
+func (m *mockMediaStore) AddNewLogMedia(media types.Media) error {
+	m.logMedia = append(m.logMedia, media)
+	return nil
+}
+
+func (m *mockMediaStore) GetMediaByID(id uuid.UUID) (*types.MediaItem, error) {
+	return nil, fmt.Errorf("media not found")
+}
+
+func (m *mockMediaStore) GetVehicleMedia(vehicleId uuid.UUID) ([]*types.MediaItem, error) {
+	return nil, nil
+}
+
+func (m *mockMediaStore) GetLogMedia(logId uuid.UUID) ([]*types.MediaItem, error) {
+	return nil, nil
+}
+
+func (m *mockMediaStore) ReorderMedia(ids []uuid.UUID) error {
+	return nil
+}
+
+func (m *mockMediaStore) SetVehicleCover(vehicleId, mediaId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockMediaStore) UpdateCaption(id uuid.UUID, caption string) error {
+	return nil
+}
+
+func (m *mockMediaStore) DeleteMedia(id uuid.UUID) error {
+	return nil
+}
+
+type mockPublisher struct{}
+
+func (m *mockPublisher) Publish(authorId uuid.UUID, item types.FeedItem) {}
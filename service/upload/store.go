@@ -0,0 +1,129 @@
+package upload
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func scanRowIntoUpload(rows *sql.Rows) (*types.Upload, error) {
+	upload := new(types.Upload)
+
+	err := rows.Scan(
+		&upload.ID,
+		&upload.UserID,
+		&upload.Kind,
+		&upload.TargetID,
+		&upload.ObjectKey,
+		&upload.Filename,
+		&upload.ContentType,
+		&upload.Size,
+		&upload.Checksum,
+		&upload.ExpiresAt,
+		&upload.CreatedAt,
+		&upload.ConfirmedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+func (s *Store) CreateUpload(upload types.Upload) error {
+	_, err := s.db.Exec(`
+		INSERT INTO pending_uploads (id, user_id, kind, target_id, object_key, filename, content_type, size, checksum, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		upload.ID, upload.UserID, upload.Kind, upload.TargetID, upload.ObjectKey, upload.Filename,
+		upload.ContentType, upload.Size, upload.Checksum, upload.ExpiresAt, upload.CreatedAt,
+	)
+
+	return err
+}
+
+func (s *Store) GetUploadByID(id uuid.UUID) (*types.Upload, error) {
+	rows, err := s.db.Query(`
+		SELECT id, user_id, kind, target_id, object_key, filename, content_type, size, checksum, expires_at, created_at, confirmed_at
+		FROM pending_uploads WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	upload := new(types.Upload)
+	for rows.Next() {
+		upload, err = scanRowIntoUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if upload.ID == uuid.Nil {
+		return nil, fmt.Errorf("upload not found")
+	}
+
+	return upload, nil
+}
+
+func (s *Store) ConfirmUpload(id uuid.UUID) error {
+	res, err := s.db.Exec("UPDATE pending_uploads SET confirmed_at = CURRENT_TIMESTAMP WHERE id = ? AND confirmed_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("upload already confirmed")
+	}
+
+	return nil
+}
+
+func (s *Store) ReleaseUpload(id uuid.UUID) error {
+	_, err := s.db.Exec("UPDATE pending_uploads SET confirmed_at = NULL WHERE id = ?", id)
+	return err
+}
+
+func (s *Store) DeleteUpload(id uuid.UUID) error {
+	_, err := s.db.Exec("DELETE FROM pending_uploads WHERE id = ?", id)
+	return err
+}
+
+func (s *Store) GetExpiredUploads(now time.Time) ([]*types.Upload, error) {
+	rows, err := s.db.Query(`
+		SELECT id, user_id, kind, target_id, object_key, filename, content_type, size, checksum, expires_at, created_at, confirmed_at
+		FROM pending_uploads WHERE expires_at <= ?`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := make([]*types.Upload, 0)
+	for rows.Next() {
+		upload, err := scanRowIntoUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, nil
+}
@@ -0,0 +1,67 @@
+package upload
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+)
+
+// Sweeper removes uploads that were never confirmed, along with anything the
+// client managed to put in storage for them.
+type Sweeper struct {
+	store types.UploadStore
+	blobs types.BlobStore
+}
+
+func NewSweeper(store types.UploadStore, blobs types.BlobStore) *Sweeper {
+	return &Sweeper{store: store, blobs: blobs}
+}
+
+// Run sweeps expired uploads every interval until ctx is cancelled.
+func (s *Sweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.SweepExpired(ctx); err != nil {
+			log.Printf("error sweeping uploads: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Sweeper) SweepExpired(ctx context.Context) error {
+	uploads, err := s.store.GetExpiredUploads(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, upload := range uploads {
+		// A confirmed upload's file is in use, only the row is left over
+		if upload.ConfirmedAt != nil {
+			if err := s.store.DeleteUpload(upload.ID); err != nil {
+				log.Printf("error deleting upload %s: %v", upload.ID, err)
+			}
+			continue
+		}
+
+		// The row is kept if the file can't be deleted so the next run retries
+		if err := s.blobs.Delete(ctx, []string{upload.ObjectKey}, nil); err != nil {
+			log.Printf("error deleting upload %s: %v", upload.ID, err)
+			continue
+		}
+
+		if err := s.store.DeleteUpload(upload.ID); err != nil {
+			log.Printf("error deleting upload %s: %v", upload.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -1,28 +1,60 @@
 package user
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ZondaF12/logbook-backend/config"
 	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/lockout"
 	"github.com/ZondaF12/logbook-backend/types"
 	"github.com/ZondaF12/logbook-backend/utils"
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
 type Handler struct {
-	store types.UserStore
+	store  types.UserStore
+	mailer types.Mailer
+	guard  *lockout.Tracker
 }
 
-func NewHandler(store types.UserStore) *Handler {
-	return &Handler{store: store}
+func NewHandler(store types.UserStore, mailer types.Mailer, guard *lockout.Tracker) *Handler {
+	return &Handler{
+		store:  store,
+		mailer: mailer,
+		guard:  guard,
+	}
 }
 
 func (h *Handler) RegisterRoutes(router *echo.Group) {
 	router.POST("/login", h.HandleLogin)
+	router.POST("/login/2fa", h.HandleTwoFactorLogin)
 	router.POST("/register", h.HandleRegister)
+	router.POST("/refresh", h.HandleRefresh)
+	router.POST("/logout", auth.WithJWTAuth(h.HandleLogout, h.store))
+	router.POST("/logout-all", auth.WithJWTAuth(h.HandleLogoutAll, h.store))
+	router.POST("/password/forgot", h.HandleForgotPassword)
+	router.POST("/password/reset", h.HandleResetPassword)
+	router.POST("/email/verify", h.HandleVerifyEmail)
+	router.POST("/email/verify/resend", auth.WithJWTAuth(h.HandleResendVerification, h.store))
+	router.POST("/2fa/enroll", auth.WithJWTAuth(h.HandleEnrollTwoFactor, h.store))
+	router.POST("/2fa/confirm", auth.WithJWTAuth(h.HandleConfirmTwoFactor, h.store))
+	router.POST("/tokens", auth.WithJWTAuth(h.HandleCreateAccessToken, h.store))
+	router.GET("/tokens", auth.WithJWTAuth(h.HandleGetAccessTokens, h.store))
+	router.DELETE("/tokens/:id", auth.WithJWTAuth(h.HandleRevokeAccessToken, h.store))
+	router.GET("/self/security-events", auth.WithJWTAuth(h.HandleGetSecurityEvents, h.store))
+	router.PUT("/self/password", auth.WithJWTAuth(h.HandleChangePassword, h.store))
+	router.PUT("/self/email", auth.WithJWTAuth(h.HandleChangeEmail, h.store))
+	router.POST("/email/change/confirm", h.HandleConfirmEmailChange)
 }
 
 func (h *Handler) HandleLogin(c echo.Context) error {
@@ -38,25 +70,676 @@ func (h *Handler) HandleLogin(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
 	}
 
+	// Slow down or refuse repeated guesses for this account or address
+	if err := h.guard.Check(payload.Email, c.RealIP()); err != nil {
+		return tooManyAttempts(c, err)
+	}
+
 	u, err := h.store.GetUserByEmail(payload.Email)
 	if err != nil {
+		h.loginFailed(c, uuid.Nil, payload.Email)
 		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("not found, invalid email or password"))
 	}
 
 	if !auth.ComparePassword(u.Password, payload.Password) {
+		h.loginFailed(c, u.ID, payload.Email)
 		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("not found, invalid email or password"))
 	}
 
-	secret := []byte(config.Envs.JWTSecret)
-	token, err := auth.CreateJWT(secret, u.ID)
+	// With two factor enabled the password alone only earns a challenge token,
+	// attempts are only reset once the code is verified too
+	if u.TOTPEnabled() {
+		keys, err := auth.Keys()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+
+		challengeId := uuid.New()
+		challenge, err := auth.CreateTwoFactorChallenge(keys, u.ID, challengeId)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+
+		if err := h.store.SetTwoFactorChallenge(u.ID, challengeId); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{
+			"userId":              u.ID.String(),
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+		})
+	}
+
+	if err := h.guard.Success(payload.Email); err != nil {
+		log.Printf("error resetting login attempts: %v", err)
+	}
+
+	return h.startSession(c, u.ID)
+}
+
+func (h *Handler) HandleTwoFactorLogin(c echo.Context) error {
+	// Parse payload
+	var payload types.TwoFactorLoginPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	keys, err := auth.Keys()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	userId, challengeId, err := auth.ParseTwoFactorChallenge(keys, payload.ChallengeToken)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired challenge")
+	}
+
+	// Only the latest challenge issued to the user is accepted, and only once
+	u, err := h.store.GetUserByID(userId)
+	if err != nil || !u.TOTPEnabled() || u.TOTPChallengeID == nil || *u.TOTPChallengeID != challengeId.String() {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired challenge")
+	}
+
+	// Codes are short, so guesses count towards the same lockout as passwords
+	if err := h.guard.Check(u.Email, c.RealIP()); err != nil {
+		return tooManyAttempts(c, err)
+	}
+
+	// Accept either a code from the authenticator that hasn't been used yet or
+	// an unused recovery code
+	if step, ok := auth.MatchTOTP(*u.TOTPSecret, payload.Code, time.Now()); ok {
+		if err := h.store.UseTOTPStep(u.ID, step); err != nil {
+			h.loginFailed(c, u.ID, u.Email)
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid two factor code")
+		}
+	} else if err := h.store.UseRecoveryCode(u.ID, auth.HashRecoveryCode(payload.Code)); err != nil {
+		h.loginFailed(c, u.ID, u.Email)
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid two factor code")
+	}
+
+	if err := h.store.UseTwoFactorChallenge(u.ID, challengeId); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired challenge")
+	}
+
+	if err := h.guard.Success(u.Email); err != nil {
+		log.Printf("error resetting login attempts: %v", err)
+	}
+
+	return h.startSession(c, u.ID)
+}
+
+func (h *Handler) HandleEnrollTwoFactor(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	u, err := h.store.GetUserByID(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if u.TOTPEnabled() {
+		return echo.NewHTTPError(http.StatusBadRequest, "Two factor authentication already enabled")
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if err := h.store.SetTOTPSecret(u.ID, secret); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"secret":           secret,
+		"provisioning_uri": auth.TOTPProvisioningURI(secret, u.Email, "Logbook"),
+	})
+}
+
+func (h *Handler) HandleConfirmTwoFactor(c echo.Context) error {
+	// Parse payload
+	var payload types.TwoFactorCodePayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	u, err := h.store.GetUserByID(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if u.TOTPEnabled() {
+		return echo.NewHTTPError(http.StatusBadRequest, "Two factor authentication already enabled")
+	}
+
+	if u.TOTPSecret == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Two factor enrolment not started")
+	}
+
+	step, ok := auth.MatchTOTP(*u.TOTPSecret, payload.Code, time.Now())
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid two factor code")
+	}
+
+	// The code confirming enrolment can't then be used to log in
+	if err := h.store.UseTOTPStep(u.ID, step); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid two factor code")
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if err := h.store.EnableTOTP(u.ID, hashes); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	// Recovery codes are only ever shown here, we keep just their hashes
+	return c.JSON(http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+func (h *Handler) HandleRefresh(c echo.Context) error {
+	// Parse payload
+	var payload types.RefreshTokenPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	oldHash := auth.HashOpaqueToken(payload.RefreshToken)
+	session, err := h.store.GetSessionByRefreshTokenHash(oldHash)
+	if err != nil {
+		// A token that was already rotated out has been copied, revoke the
+		// session so whoever holds the newer token is logged out too
+		if reused, err := h.store.GetSessionByRotatedRefreshTokenHash(oldHash); err == nil {
+			if err := h.store.RevokeSession(reused.ID); err != nil {
+				log.Printf("error revoking session %s after refresh token reuse: %v", reused.ID, err)
+			}
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired refresh token")
+	}
+
+	if !session.Active() {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired refresh token")
+	}
+
+	// Rotate the refresh token so each one can only be used once
+	refreshToken, newHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if err := h.store.RotateSession(session.ID, oldHash, newHash, auth.RefreshTokenExpiry()); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired refresh token")
+	}
+
+	if err := setTokenHeaders(c, session.UserID, session.ID, refreshToken); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"userId": session.UserID.String()})
+}
+
+func (h *Handler) HandleLogout(c echo.Context) error {
+	// Get session ID from JWT
+	sessionId := auth.GetSessionIDFromContext(c.Request().Context())
+
+	if err := h.store.RevokeSession(sessionId); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, "Logged out")
+}
+
+func (h *Handler) HandleLogoutAll(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	if err := h.store.RevokeUserSessions(userId); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, "Logged out of all sessions")
+}
+
+func (h *Handler) HandleForgotPassword(c echo.Context) error {
+	// Parse payload
+	var payload types.ForgotPasswordPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	// Always respond the same way so the endpoint can't be used to find out
+	// which emails are registered
+	response := "If an account exists for that email, a reset link has been sent"
+
+	u, err := h.store.GetUserByEmail(payload.Email)
+	if err != nil {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	err = h.store.CreatePasswordReset(types.PasswordReset{
+		ID:        uuid.New(),
+		UserID:    u.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(time.Second * time.Duration(config.Envs.PasswordResetExpirationInSeconds)),
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", config.Envs.AppURL, url.QueryEscape(token))
+	err = h.mailer.Send(types.Email{
+		To:      u.Email,
+		Subject: "Reset your Logbook password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Logbook account.\n\n"+
+			"Use the link below to choose a new password. It expires in %d minutes and can only be used once.\n\n%s\n\n"+
+			"If you didn't ask for this you can ignore this email.",
+			config.Envs.PasswordResetExpirationInSeconds/60, link),
+	})
+	if err != nil {
+		// Failing here only for registered emails would give them away
+		log.Printf("error sending password reset email: %v", err)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) HandleResetPassword(c echo.Context) error {
+	// Parse payload
+	var payload types.ResetPasswordPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	reset, err := h.store.GetPasswordResetByTokenHash(auth.HashOpaqueToken(payload.Token))
+	if err != nil || !reset.Usable() {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid or expired reset token")
+	}
+
+	hashedPassword, err := auth.HashPassword(payload.Password)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	// Mark the token used, update the password, sign out every session and
+	// revoke every access token
+	err = h.store.ResetPassword(reset.ID, reset.UserID, hashedPassword)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid or expired reset token")
+	}
+
+	return c.JSON(http.StatusOK, "Password updated")
+}
+
+func (h *Handler) HandleCreateAccessToken(c echo.Context) error {
+	// Parse payload
+	var payload types.CreateAccessTokenPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	for _, scope := range payload.Scopes {
+		if !auth.ValidScope(scope) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown scope %s", scope))
+		}
+	}
+
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	raw, hash, err := auth.NewAccessToken()
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	c.Response().Header().Set("Access-Control-Expose-Headers", "X-Logbook-Token")
+	token := types.AccessToken{
+		ID:        uuid.New(),
+		UserID:    userId,
+		Name:      payload.Name,
+		TokenHash: hash,
+		Scopes:    payload.Scopes,
+		CreatedAt: time.Now(),
+	}
+
+	if payload.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, payload.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := h.store.CreateAccessToken(token); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	// The raw token is only returned once, we keep just its hash
+	return c.JSON(http.StatusCreated, map[string]any{
+		"token":        raw,
+		"access_token": token,
+	})
+}
+
+func (h *Handler) HandleGetAccessTokens(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	tokens, err := h.store.GetUserAccessTokens(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+func (h *Handler) HandleRevokeAccessToken(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	tokenId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid token id")
+	}
+
+	if err := h.store.RevokeAccessToken(userId, tokenId); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	return c.JSON(http.StatusOK, "Access token revoked")
+}
+
+func (h *Handler) HandleChangePassword(c echo.Context) error {
+	// Parse payload
+	var payload types.ChangePasswordPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	// Get user and session IDs from JWT
+	ctx := c.Request().Context()
+	userId := auth.GetUserIDFromContext(ctx)
+	sessionId := auth.GetSessionIDFromContext(ctx)
+
+	u, err := h.store.GetUserByID(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if err := h.checkPassword(c, u, payload.CurrentPassword, "current password is incorrect"); err != nil {
+		return err
+	}
+
+	hashedPassword, err := auth.HashPassword(payload.NewPassword)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	// Keep the session that made the change, sign out everything else and
+	// revoke every access token
+	if err := h.store.UpdatePassword(u.ID, sessionId, hashedPassword); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, "Password updated")
+}
+
+func (h *Handler) HandleChangeEmail(c echo.Context) error {
+	// Parse payload
+	var payload types.ChangeEmailPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	// Get user and session IDs from JWT
+	ctx := c.Request().Context()
+	userId := auth.GetUserIDFromContext(ctx)
+	sessionId := auth.GetSessionIDFromContext(ctx)
+
+	u, err := h.store.GetUserByID(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if err := h.checkPassword(c, u, payload.Password, "password is incorrect"); err != nil {
+		return err
+	}
+
+	if strings.EqualFold(u.Email, payload.Email) {
+		return echo.NewHTTPError(http.StatusBadRequest, "new email is the same as the current one")
+	}
+
+	// Check the new address isn't already taken
+	if _, err := h.store.GetUserByEmail(payload.Email); err == nil {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("user with email %s already exists", payload.Email))
+	}
+
+	// The address only changes once the link sent to it is opened
+	if err := h.store.SetPendingEmail(u.ID, payload.Email); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if err := h.store.RevokeOtherSessions(u.ID, sessionId); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	keys, err := auth.Keys()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	token, err := auth.CreateEmailChangeToken(keys, u.ID, payload.Email)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	link := fmt.Sprintf("%s/confirm-email-change?token=%s", config.Envs.AppURL, url.QueryEscape(token))
+	err = h.mailer.Send(types.Email{
+		To:      payload.Email,
+		Subject: "Confirm your new Logbook email address",
+		Body: fmt.Sprintf("Open the link below to start using this address for your Logbook account. It expires in %d hours.\n\n%s",
+			config.Envs.EmailVerificationExpirationInSeconds/3600, link),
+	})
+	if err != nil {
+		log.Printf("error sending email change confirmation: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Error sending confirmation email")
+	}
+
+	// Let the current address know in case the change wasn't theirs
+	err = h.mailer.Send(types.Email{
+		To:      u.Email,
+		Subject: "Your Logbook email address is being changed",
+		Body: fmt.Sprintf("Someone asked to change the email address on your Logbook account to %s.\n\n"+
+			"If this wasn't you, reset your password straight away.", payload.Email),
+	})
+	if err != nil {
+		log.Printf("error sending email change notice: %v", err)
+	}
+
+	return c.JSON(http.StatusOK, "Confirmation email sent")
+}
+
+func (h *Handler) HandleConfirmEmailChange(c echo.Context) error {
+	// Parse payload
+	var payload types.VerifyEmailPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	keys, err := auth.Keys()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	userId, email, err := auth.ParseEmailChangeToken(keys, payload.Token)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid or expired confirmation link")
+	}
+
+	// Someone may have registered the address since the change was requested
+	if _, err := h.store.GetUserByEmail(email); err == nil {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("user with email %s already exists", email))
+	}
+
+	if err := h.store.ConfirmEmailChange(userId, email); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid or expired confirmation link")
+	}
+
+	return c.JSON(http.StatusOK, "Email updated")
+}
+
+func (h *Handler) HandleGetSecurityEvents(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	events, err := h.guard.SecurityEvents(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, events)
+}
+
+func (h *Handler) loginFailed(c echo.Context, userId uuid.UUID, email string) {
+	err := h.guard.Failure(userId, email, c.RealIP(), truncate(c.Request().UserAgent(), 255))
+	if err != nil {
+		log.Printf("error recording failed login: %v", err)
+	}
+}
+
+// checkPassword confirms the signed in user's password before a sensitive
+// change. Guesses count towards the same lockout as logins so a stolen access
+// token can't be used to brute force the password.
+func (h *Handler) checkPassword(c echo.Context, u *types.User, password, message string) error {
+	if err := h.guard.Check(u.Email, c.RealIP()); err != nil {
+		return tooManyAttempts(c, err)
+	}
+
+	if !auth.ComparePassword(u.Password, password) {
+		h.loginFailed(c, u.ID, u.Email)
+		return echo.NewHTTPError(http.StatusBadRequest, message)
+	}
+
+	if err := h.guard.Success(u.Email); err != nil {
+		log.Printf("error resetting login attempts: %v", err)
+	}
+
+	return nil
+}
+
+func tooManyAttempts(c echo.Context, err error) error {
+	var locked *lockout.LockedError
+	if !errors.As(err, &locked) {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+
+	return echo.NewHTTPError(http.StatusTooManyRequests, locked.Error())
+}
+
+// startSession creates a new session for the user and returns its tokens.
+func (h *Handler) startSession(c echo.Context, userId uuid.UUID) error {
+	session, refreshToken, err := auth.NewSession(userId, truncate(c.Request().UserAgent(), 255), c.RealIP())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if err := h.store.CreateSession(session); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if err := setTokenHeaders(c, userId, session.ID, refreshToken); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"userId": userId.String()})
+}
+
+func setTokenHeaders(c echo.Context, userId, sessionId uuid.UUID, refreshToken string) error {
+	keys, err := auth.Keys()
+	if err != nil {
+		return err
+	}
+
+	token, err := auth.CreateJWT(keys, userId, sessionId)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Access-Control-Expose-Headers", "X-Logbook-Token, X-Logbook-Refresh-Token")
 	c.Response().Header().Set("X-Logbook-Token", token)
+	c.Response().Header().Set("X-Logbook-Refresh-Token", refreshToken)
 
-	return c.JSON(http.StatusOK, map[string]string{"userId": u.ID.String()})
+	return nil
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+
+	return s
 }
 
 func (h *Handler) HandleRegister(c echo.Context) error {
@@ -84,14 +767,95 @@ func (h *Handler) HandleRegister(c echo.Context) error {
 	}
 
 	// Create user
-	err = h.store.CreateUser(types.User{
+	u := types.User{
+		ID:       uuid.New(),
 		Email:    payload.Email,
 		Password: hashedPassword,
-	})
+	}
+	err = h.store.CreateUser(u)
 
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
+	// The account is usable without verification, the user can ask for a new
+	// link if this one doesn't arrive
+	if err := h.sendVerificationEmail(&u); err != nil {
+		log.Printf("error sending verification email: %v", err)
+	}
+
 	return c.JSON(http.StatusCreated, "User Created")
 }
+
+func (h *Handler) HandleVerifyEmail(c echo.Context) error {
+	// Parse payload
+	var payload types.VerifyEmailPayload
+	if err := utils.ParseJSON(c, &payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+	}
+
+	keys, err := auth.Keys()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	userId, email, err := auth.ParseEmailVerificationToken(keys, payload.Token)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid or expired verification link")
+	}
+
+	if err := h.store.MarkEmailVerified(userId, email); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid or expired verification link")
+	}
+
+	return c.JSON(http.StatusOK, "Email verified")
+}
+
+func (h *Handler) HandleResendVerification(c echo.Context) error {
+	// Get user ID from JWT
+	userId := auth.GetUserIDFromContext(c.Request().Context())
+
+	u, err := h.store.GetUserByID(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if u.EmailVerified() {
+		return echo.NewHTTPError(http.StatusBadRequest, "Email already verified")
+	}
+
+	if err := h.sendVerificationEmail(u); err != nil {
+		log.Printf("error sending verification email: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Error sending verification email")
+	}
+
+	return c.JSON(http.StatusOK, "Verification email sent")
+}
+
+func (h *Handler) sendVerificationEmail(u *types.User) error {
+	keys, err := auth.Keys()
+	if err != nil {
+		return err
+	}
+
+	token, err := auth.CreateEmailVerificationToken(keys, u.ID, u.Email)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", config.Envs.AppURL, url.QueryEscape(token))
+
+	return h.mailer.Send(types.Email{
+		To:      u.Email,
+		Subject: "Verify your Logbook email address",
+		Body: fmt.Sprintf("Welcome to Logbook!\n\n"+
+			"Please confirm your email address by opening the link below. It expires in %d hours.\n\n%s",
+			config.Envs.EmailVerificationExpirationInSeconds/3600, link),
+	})
+}
@@ -2,20 +2,218 @@ package user
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/ZondaF12/logbook-backend/service/auth"
+	"github.com/ZondaF12/logbook-backend/service/lockout"
+	"github.com/ZondaF12/logbook-backend/service/mailer"
 	"github.com/ZondaF12/logbook-backend/types"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
+func TestRefresh(t *testing.T) {
+	userStore := &mockUserStore{}
+	handler := NewHandler(userStore, mailer.NewMemoryMailer(false), nil)
+
+	refreshToken, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := types.Session{ID: uuid.New(), UserID: uuid.New(), RefreshTokenHash: hash, ExpiresAt: time.Now().Add(time.Hour)}
+	userStore.CreateSession(session)
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(types.RefreshTokenPayload{RefreshToken: token})
+
+		req := httptest.NewRequest(http.MethodPost, "/refresh", bytes.NewBuffer(marshalled))
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.POST("/refresh", handler.HandleRefresh)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rr := refresh(refreshToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	rotated := rr.Header().Get("X-Logbook-Refresh-Token")
+
+	t.Run("should revoke the session when a rotated token is reused", func(t *testing.T) {
+		rr := refresh(refreshToken)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+
+		if s, _ := userStore.GetSessionByID(session.ID); s.Active() {
+			t.Error("expected the session to be revoked")
+		}
+	})
+
+	t.Run("should not refresh with the newer token once revoked", func(t *testing.T) {
+		rr := refresh(rotated)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+}
+
+func TestChangePasswordLockout(t *testing.T) {
+	password, err := auth.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userId := uuid.New()
+	userStore := &mockUserStore{users: map[string]*types.User{
+		"foo@email.com": {ID: userId, Email: "foo@email.com", Password: password},
+	}}
+	attempts := lockout.NewMemoryStore()
+	handler := NewHandler(userStore, mailer.NewMemoryMailer(false), lockout.NewTracker(attempts, attempts))
+
+	change := func(current string) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(types.ChangePasswordPayload{CurrentPassword: current, NewPassword: "new-password"})
+
+		req := httptest.NewRequest(http.MethodPut, "/self/password", bytes.NewBuffer(marshalled))
+		ctx := context.WithValue(req.Context(), auth.UserKey, userId)
+		req = req.WithContext(context.WithValue(ctx, auth.SessionKey, uuid.New()))
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.PUT("/self/password", handler.HandleChangePassword)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	for i := 0; i <= lockout.AccountPolicy.FreeAttempts; i++ {
+		if rr := change("wrong"); rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	}
+
+	// Even the right password has to wait once guesses are being slowed down
+	rr := change("password")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	password, err := auth.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabledAt := time.Now()
+
+	userStore := &mockUserStore{users: map[string]*types.User{
+		"foo@email.com": {ID: uuid.New(), Email: "foo@email.com", Password: password, TOTPSecret: &secret, TOTPEnabledAt: &enabledAt},
+	}}
+	attempts := lockout.NewMemoryStore()
+	handler := NewHandler(userStore, mailer.NewMemoryMailer(false), lockout.NewTracker(attempts, attempts))
+
+	router := echo.New()
+	router.POST("/login", handler.HandleLogin)
+	router.POST("/login/2fa", handler.HandleTwoFactorLogin)
+
+	post := func(path string, payload any) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(payload)
+
+		req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	login := func() string {
+		rr := post("/login", types.LoginAuthPayload{Email: "foo@email.com", Password: "password"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var response struct {
+			ChallengeToken string `json:"challenge_token"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+
+		return response.ChallengeToken
+	}
+
+	code, err := auth.TOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge := login()
+	if rr := post("/login/2fa", types.TwoFactorLoginPayload{ChallengeToken: challenge, Code: code}); rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	t.Run("should not accept a challenge twice", func(t *testing.T) {
+		rr := post("/login/2fa", types.TwoFactorLoginPayload{ChallengeToken: challenge, Code: code})
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should not accept a code twice", func(t *testing.T) {
+		rr := post("/login/2fa", types.TwoFactorLoginPayload{ChallengeToken: login(), Code: code})
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should not reset attempts on the password alone", func(t *testing.T) {
+		codes := make([]int, 0)
+		for i := 0; i <= lockout.AccountPolicy.FreeAttempts+1; i++ {
+			rr := post("/login", types.LoginAuthPayload{Email: "foo@email.com", Password: "password"})
+			codes = append(codes, rr.Code)
+			if rr.Code != http.StatusOK {
+				break
+			}
+
+			var response struct {
+				ChallengeToken string `json:"challenge_token"`
+			}
+			json.Unmarshal(rr.Body.Bytes(), &response)
+
+			rr = post("/login/2fa", types.TwoFactorLoginPayload{ChallengeToken: response.ChallengeToken, Code: "abcdef"})
+			codes = append(codes, rr.Code)
+			if rr.Code != http.StatusUnauthorized {
+				break
+			}
+		}
+
+		if last := codes[len(codes)-1]; last != http.StatusTooManyRequests {
+			t.Errorf("expected status code %d after repeated wrong codes, got %v", http.StatusTooManyRequests, codes)
+		}
+	})
+}
+
 func TestUserServiceHandlers(t *testing.T) {
 	userStore := &mockUserStore{}
-	handler := NewHandler(userStore)
+	mailSender := mailer.NewMemoryMailer(false)
+	attempts := lockout.NewMemoryStore()
+	handler := NewHandler(userStore, mailSender, lockout.NewTracker(attempts, attempts))
 
 	t.Run("Should fail if the user payload is invalid", func(t *testing.T) {
 		payload := types.RegisterAuthPayload{
@@ -61,19 +259,336 @@ func TestUserServiceHandlers(t *testing.T) {
 		if rr.Code != http.StatusCreated {
 			t.Errorf("expected status code %d, got %d", http.StatusCreated, rr.Code)
 		}
+
+		sent := mailSender.Sent()
+		if len(sent) != 1 || sent[0].To != payload.Email {
+			t.Errorf("expected a verification email to be sent to %s", payload.Email)
+		}
+	})
+
+	t.Run("should reject an unknown refresh token", func(t *testing.T) {
+		payload := types.RefreshTokenPayload{
+			RefreshToken: "not-a-real-token",
+		}
+		marshalled, _ := json.Marshal(payload)
+
+		req, err := http.NewRequest(http.MethodPost, "/refresh", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.POST("/refresh", handler.HandleRefresh)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should not reveal whether an email is registered", func(t *testing.T) {
+		payload := types.ForgotPasswordPayload{
+			Email: "unknown@email.com",
+		}
+		marshalled, _ := json.Marshal(payload)
+		sentBefore := len(mailSender.Sent())
+
+		req, err := http.NewRequest(http.MethodPost, "/password/forgot", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.POST("/password/forgot", handler.HandleForgotPassword)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if sent := len(mailSender.Sent()) - sentBefore; sent != 0 {
+			t.Errorf("expected no email to be sent, got %d", sent)
+		}
+	})
+
+	t.Run("should not reveal a registered email when the mailer fails", func(t *testing.T) {
+		store := &mockUserStore{users: map[string]*types.User{
+			"foo@email.com": {ID: uuid.New(), Email: "foo@email.com"},
+		}}
+		handler := NewHandler(store, failingMailer{}, lockout.NewTracker(attempts, attempts))
+
+		payload := types.ForgotPasswordPayload{
+			Email: "foo@email.com",
+		}
+		marshalled, _ := json.Marshal(payload)
+
+		req, err := http.NewRequest(http.MethodPost, "/password/forgot", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.POST("/password/forgot", handler.HandleForgotPassword)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
 	})
+
+	t.Run("should reject an unknown reset token", func(t *testing.T) {
+		payload := types.ResetPasswordPayload{
+			Token:    "not-a-real-token",
+			Password: "new-password",
+		}
+		marshalled, _ := json.Marshal(payload)
+
+		req, err := http.NewRequest(http.MethodPost, "/password/reset", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.POST("/password/reset", handler.HandleResetPassword)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should lock out repeated failed logins", func(t *testing.T) {
+		payload := types.LoginAuthPayload{
+			Email:    "attacker@email.com",
+			Password: "guess",
+		}
+		marshalled, _ := json.Marshal(payload)
+
+		router := echo.New()
+		router.POST("/login", handler.HandleLogin)
+
+		codes := make([]int, 0)
+		for i := 0; i <= lockout.AccountPolicy.FreeAttempts+1; i++ {
+			req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshalled))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			codes = append(codes, rr.Code)
+		}
+
+		if last := codes[len(codes)-1]; last != http.StatusTooManyRequests {
+			t.Errorf("expected status code %d after repeated failures, got %v", http.StatusTooManyRequests, codes)
+		}
+	})
+
+	t.Run("should reject access tokens with unknown scopes", func(t *testing.T) {
+		payload := types.CreateAccessTokenPayload{
+			Name:   "ci",
+			Scopes: []string{"garage:read", "everything"},
+		}
+		marshalled, _ := json.Marshal(payload)
+
+		req, err := http.NewRequest(http.MethodPost, "/tokens", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := echo.New()
+
+		router.POST("/tokens", handler.HandleCreateAccessToken)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+type failingMailer struct{}
+
+func (failingMailer) Send(email types.Email) error {
+	return fmt.Errorf("smtp unavailable")
 }
 
-type mockUserStore struct{}
+type mockUserStore struct {
+	users    map[string]*types.User
+	sessions []*types.Session
+	rotated  map[string]*types.Session
+}
 
 func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	if u, ok := m.users[email]; ok {
+		return u, nil
+	}
 	return nil, fmt.Errorf("user not found")
 }
 
 func (m *mockUserStore) GetUserByID(id uuid.UUID) (*types.User, error) {
+	for _, u := range m.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
 	return nil, nil
 }
 
 func (m *mockUserStore) CreateUser(user types.User) error {
 	return nil
 }
+
+func (m *mockUserStore) CreateSession(session types.Session) error {
+	m.sessions = append(m.sessions, &session)
+	return nil
+}
+
+func (m *mockUserStore) GetSessionByID(id uuid.UUID) (*types.Session, error) {
+	for _, s := range m.sessions {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("session not found")
+}
+
+func (m *mockUserStore) GetSessionByRefreshTokenHash(hash string) (*types.Session, error) {
+	for _, s := range m.sessions {
+		if s.RefreshTokenHash == hash {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("session not found")
+}
+
+func (m *mockUserStore) GetSessionByRotatedRefreshTokenHash(hash string) (*types.Session, error) {
+	if s, ok := m.rotated[hash]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("session not found")
+}
+
+func (m *mockUserStore) RotateSession(id uuid.UUID, oldHash, newHash string, expiresAt time.Time) error {
+	s, err := m.GetSessionByID(id)
+	if err != nil || s.RefreshTokenHash != oldHash || s.RevokedAt != nil {
+		return fmt.Errorf("session not found or already rotated")
+	}
+	if m.rotated == nil {
+		m.rotated = make(map[string]*types.Session)
+	}
+	m.rotated[oldHash] = s
+	s.RefreshTokenHash = newHash
+	s.ExpiresAt = expiresAt
+	return nil
+}
+
+func (m *mockUserStore) RevokeSession(id uuid.UUID) error {
+	if s, err := m.GetSessionByID(id); err == nil {
+		now := time.Now()
+		s.RevokedAt = &now
+	}
+	return nil
+}
+
+func (m *mockUserStore) RevokeUserSessions(userId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockUserStore) MarkEmailVerified(userId uuid.UUID, email string) error {
+	return nil
+}
+
+func (m *mockUserStore) SetTOTPSecret(userId uuid.UUID, secret string) error {
+	return nil
+}
+
+func (m *mockUserStore) EnableTOTP(userId uuid.UUID, recoveryCodeHashes []string) error {
+	return nil
+}
+
+func (m *mockUserStore) UseRecoveryCode(userId uuid.UUID, codeHash string) error {
+	return fmt.Errorf("invalid recovery code")
+}
+
+func (m *mockUserStore) UseTOTPStep(userId uuid.UUID, step int64) error {
+	u, _ := m.GetUserByID(userId)
+	if u == nil || (u.TOTPLastStep != nil && *u.TOTPLastStep >= step) {
+		return fmt.Errorf("two factor code already used")
+	}
+	u.TOTPLastStep = &step
+	return nil
+}
+
+func (m *mockUserStore) SetTwoFactorChallenge(userId, challengeId uuid.UUID) error {
+	u, _ := m.GetUserByID(userId)
+	id := challengeId.String()
+	u.TOTPChallengeID = &id
+	return nil
+}
+
+func (m *mockUserStore) UseTwoFactorChallenge(userId, challengeId uuid.UUID) error {
+	u, _ := m.GetUserByID(userId)
+	if u == nil || u.TOTPChallengeID == nil || *u.TOTPChallengeID != challengeId.String() {
+		return fmt.Errorf("two factor challenge already used")
+	}
+	u.TOTPChallengeID = nil
+	return nil
+}
+
+func (m *mockUserStore) CreateAccessToken(token types.AccessToken) error {
+	return nil
+}
+
+func (m *mockUserStore) GetAccessTokenByHash(hash string) (*types.AccessToken, error) {
+	return nil, fmt.Errorf("access token not found")
+}
+
+func (m *mockUserStore) GetUserAccessTokens(userId uuid.UUID) ([]*types.AccessToken, error) {
+	return []*types.AccessToken{}, nil
+}
+
+func (m *mockUserStore) RevokeAccessToken(userId, id uuid.UUID) error {
+	return nil
+}
+
+func (m *mockUserStore) TouchAccessToken(id uuid.UUID) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(userId, keepSessionId uuid.UUID, passwordHash string) error {
+	return nil
+}
+
+func (m *mockUserStore) SetPendingEmail(userId uuid.UUID, email string) error {
+	return nil
+}
+
+func (m *mockUserStore) ConfirmEmailChange(userId uuid.UUID, email string) error {
+	return nil
+}
+
+func (m *mockUserStore) RevokeOtherSessions(userId, keepId uuid.UUID) error {
+	return nil
+}
+
+func (m *mockUserStore) CreatePasswordReset(reset types.PasswordReset) error {
+	return nil
+}
+
+func (m *mockUserStore) GetPasswordResetByTokenHash(hash string) (*types.PasswordReset, error) {
+	return nil, fmt.Errorf("password reset not found")
+}
+
+func (m *mockUserStore) ResetPassword(resetId, userId uuid.UUID, passwordHash string) error {
+	return nil
+}
@@ -3,6 +3,8 @@ package user
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ZondaF12/logbook-backend/types"
 	"github.com/google/uuid"
@@ -47,6 +49,14 @@ func scanRowIntoUser(rows *sql.Rows) (*types.User, error) {
 		&user.Email,
 		&user.Password,
 		&user.CreatedAt,
+		&user.EmailVerifiedAt,
+		&user.TOTPSecret,
+		&user.TOTPEnabledAt,
+		&user.PasswordChangedAt,
+		&user.PendingEmail,
+		&user.DeletionScheduledAt,
+		&user.TOTPLastStep,
+		&user.TOTPChallengeID,
 	)
 	if err != nil {
 		return nil, err
@@ -56,7 +66,8 @@ func scanRowIntoUser(rows *sql.Rows) (*types.User, error) {
 }
 
 func (s *Store) GetUserByUsername(username string) (*types.User, error) {
-	rows, err := s.db.Query("SELECT * FROM auth WHERE username = ?", username)
+	// Usernames live on the profile, not the auth record
+	rows, err := s.db.Query("SELECT a.* FROM auth a JOIN profiles p ON p.user_id = a.id WHERE p.username = ?", username)
 	if err != nil {
 		return nil, err
 	}
@@ -98,10 +109,568 @@ func (s *Store) GetUserByID(id uuid.UUID) (*types.User, error) {
 }
 
 func (s *Store) CreateUser(u types.User) error {
-	_, err := s.db.Exec("INSERT INTO auth (id, email, password) VALUES (?, ?, ?)", uuid.New(), u.Email, u.Password)
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+
+	_, err := s.db.Exec("INSERT INTO auth (id, email, password) VALUES (?, ?, ?)", u.ID, u.Email, u.Password)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MarkEmailVerified only verifies the address the token was issued for, so a
+// link sent before an email change can't verify the new address.
+func (s *Store) MarkEmailVerified(userId uuid.UUID, email string) error {
+	res, err := s.db.Exec("UPDATE auth SET email_verified_at = CURRENT_TIMESTAMP WHERE id = ? AND email = ?", userId, email)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+func (s *Store) CreateSession(session types.Session) error {
+	_, err := s.db.Exec(`
+		INSERT INTO sessions (id, user_id, refresh_token_hash, user_agent, ip_address, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		session.ID, session.UserID, session.RefreshTokenHash, session.UserAgent, session.IPAddress, session.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func scanRowIntoSession(rows *sql.Rows) (*types.Session, error) {
+	session := new(types.Session)
+
+	err := rows.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.RefreshTokenHash,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *Store) GetSessionByID(id uuid.UUID) (*types.Session, error) {
+	rows, err := s.db.Query("SELECT * FROM sessions WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	session := new(types.Session)
+	for rows.Next() {
+		session, err = scanRowIntoSession(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if session.ID == uuid.Nil {
+		return nil, fmt.Errorf("session not found")
+	}
+
+	return session, nil
+}
+
+func (s *Store) GetSessionByRefreshTokenHash(hash string) (*types.Session, error) {
+	rows, err := s.db.Query("SELECT * FROM sessions WHERE refresh_token_hash = ?", hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	session := new(types.Session)
+	for rows.Next() {
+		session, err = scanRowIntoSession(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if session.ID == uuid.Nil {
+		return nil, fmt.Errorf("session not found")
+	}
+
+	return session, nil
+}
+
+func (s *Store) GetSessionByRotatedRefreshTokenHash(hash string) (*types.Session, error) {
+	rows, err := s.db.Query(`
+		SELECT sessions.* FROM sessions
+		JOIN rotated_refresh_tokens r ON r.session_id = sessions.id
+		WHERE r.token_hash = ?`, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	session := new(types.Session)
+	for rows.Next() {
+		session, err = scanRowIntoSession(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if session.ID == uuid.Nil {
+		return nil, fmt.Errorf("session not found")
+	}
+
+	return session, nil
+}
+
+// RotateSession swaps the session's refresh token hash. The old hash is part of
+// the WHERE clause so that two concurrent refreshes with the same token cannot
+// both succeed.
+func (s *Store) RotateSession(id uuid.UUID, oldHash, newHash string, expiresAt time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE sessions
+		SET refresh_token_hash = ?, expires_at = ?, last_used_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND refresh_token_hash = ? AND revoked_at IS NULL`,
+		newHash, expiresAt, id, oldHash,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("session not found or already rotated")
+	}
+
+	if _, err := tx.Exec("INSERT INTO rotated_refresh_tokens (token_hash, session_id) VALUES (?, ?)", oldHash, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) RevokeSession(id uuid.UUID) error {
+	_, err := s.db.Exec("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) RevokeUserSessions(userId uuid.UUID) error {
+	_, err := s.db.Exec("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND revoked_at IS NULL", userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) RevokeOtherSessions(userId, keepId uuid.UUID) error {
+	_, err := s.db.Exec("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND id <> ? AND revoked_at IS NULL", userId, keepId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) CreatePasswordReset(reset types.PasswordReset) error {
+	_, err := s.db.Exec(`
+		INSERT INTO password_resets (id, user_id, token_hash, expires_at)
+		VALUES (?, ?, ?, ?)`,
+		reset.ID, reset.UserID, reset.TokenHash, reset.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func scanRowIntoPasswordReset(rows *sql.Rows) (*types.PasswordReset, error) {
+	reset := new(types.PasswordReset)
+
+	err := rows.Scan(
+		&reset.ID,
+		&reset.UserID,
+		&reset.TokenHash,
+		&reset.ExpiresAt,
+		&reset.UsedAt,
+		&reset.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return reset, nil
+}
+
+func (s *Store) GetPasswordResetByTokenHash(hash string) (*types.PasswordReset, error) {
+	rows, err := s.db.Query("SELECT * FROM password_resets WHERE token_hash = ?", hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reset := new(types.PasswordReset)
+	for rows.Next() {
+		reset, err = scanRowIntoPasswordReset(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if reset.ID == uuid.Nil {
+		return nil, fmt.Errorf("password reset not found")
+	}
+
+	return reset, nil
+}
+
+func (s *Store) ResetPassword(resetId, userId uuid.UUID, passwordHash string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Claim the token first so a concurrent request with the same token fails
+	res, err := tx.Exec("UPDATE password_resets SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL", resetId)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("password reset already used")
+	}
+
+	// Any other outstanding reset tokens for the user are no longer needed
+	if _, err := tx.Exec("UPDATE password_resets SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND used_at IS NULL", userId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE auth SET password = ?, password_changed_at = CURRENT_TIMESTAMP WHERE id = ?", passwordHash, userId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND revoked_at IS NULL", userId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE access_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND revoked_at IS NULL", userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetTOTPSecret stores a pending secret during enrolment. It only takes effect
+// once EnableTOTP is called after the user confirms a code.
+func (s *Store) SetTOTPSecret(userId uuid.UUID, secret string) error {
+	_, err := s.db.Exec("UPDATE auth SET totp_secret = ? WHERE id = ? AND totp_enabled_at IS NULL", secret, userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) EnableTOTP(userId uuid.UUID, recoveryCodeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE auth SET totp_enabled_at = CURRENT_TIMESTAMP WHERE id = ? AND totp_secret IS NOT NULL", userId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userId); err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err := tx.Exec("INSERT INTO recovery_codes (id, user_id, code_hash) VALUES (?, ?, ?)", uuid.New(), userId, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) UseRecoveryCode(userId uuid.UUID, codeHash string) error {
+	res, err := s.db.Exec(`
+		UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		userId, codeHash,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("invalid recovery code")
+	}
+
+	return nil
+}
+
+func (s *Store) UseTOTPStep(userId uuid.UUID, step int64) error {
+	res, err := s.db.Exec(`
+		UPDATE auth SET totp_last_step = ?
+		WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)`,
+		step, userId, step,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("two factor code already used")
+	}
+
+	return nil
+}
+
+func (s *Store) SetTwoFactorChallenge(userId, challengeId uuid.UUID) error {
+	_, err := s.db.Exec("UPDATE auth SET totp_challenge_id = ? WHERE id = ?", challengeId, userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) UseTwoFactorChallenge(userId, challengeId uuid.UUID) error {
+	res, err := s.db.Exec("UPDATE auth SET totp_challenge_id = NULL WHERE id = ? AND totp_challenge_id = ?", userId, challengeId)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("two factor challenge already used")
+	}
+
+	return nil
+}
+
+func (s *Store) CreateAccessToken(token types.AccessToken) error {
+	_, err := s.db.Exec(`
+		INSERT INTO access_tokens (id, user_id, name, token_hash, scopes, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		token.ID, token.UserID, token.Name, token.TokenHash, strings.Join(token.Scopes, " "), token.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func scanRowIntoAccessToken(rows *sql.Rows) (*types.AccessToken, error) {
+	token := new(types.AccessToken)
+	var scopes string
+
+	err := rows.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.TokenHash,
+		&scopes,
+		&token.LastUsedAt,
+		&token.ExpiresAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Scopes = strings.Fields(scopes)
+
+	return token, nil
+}
+
+func (s *Store) GetAccessTokenByHash(hash string) (*types.AccessToken, error) {
+	rows, err := s.db.Query("SELECT * FROM access_tokens WHERE token_hash = ?", hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	token := new(types.AccessToken)
+	for rows.Next() {
+		token, err = scanRowIntoAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if token.ID == uuid.Nil {
+		return nil, fmt.Errorf("access token not found")
+	}
+
+	return token, nil
+}
+
+func (s *Store) GetUserAccessTokens(userId uuid.UUID) ([]*types.AccessToken, error) {
+	rows, err := s.db.Query("SELECT * FROM access_tokens WHERE user_id = ? AND revoked_at IS NULL ORDER BY created_at DESC", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]*types.AccessToken, 0)
+	for rows.Next() {
+		token, err := scanRowIntoAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+func (s *Store) RevokeAccessToken(userId, id uuid.UUID) error {
+	res, err := s.db.Exec("UPDATE access_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ? AND revoked_at IS NULL", id, userId)
 	if err != nil {
 		return err
 	}
 
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("access token not found")
+	}
+
+	return nil
+}
+
+// TouchAccessToken records when a token was last used. Writes are throttled
+// to once a minute so busy scripts don't update the row on every request.
+func (s *Store) TouchAccessToken(id uuid.UUID) error {
+	_, err := s.db.Exec(`
+		UPDATE access_tokens SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL 1 MINUTE)`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) UpdatePassword(userId, keepSessionId uuid.UUID, passwordHash string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE auth SET password = ?, password_changed_at = CURRENT_TIMESTAMP WHERE id = ?", passwordHash, userId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND id <> ? AND revoked_at IS NULL", userId, keepSessionId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE access_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND revoked_at IS NULL", userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) SetPendingEmail(userId uuid.UUID, email string) error {
+	_, err := s.db.Exec("UPDATE auth SET pending_email = ? WHERE id = ?", email, userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) ConfirmEmailChange(userId uuid.UUID, email string) error {
+	res, err := s.db.Exec(`
+		UPDATE auth
+		SET email = pending_email, pending_email = NULL, email_verified_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND pending_email = ?`,
+		userId, email,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("no pending email change")
+	}
+
 	return nil
 }
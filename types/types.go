@@ -1,27 +1,267 @@
 package types
 
 import (
+	"context"
+	"io"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type UserStore interface {
+	SessionStore
+	PasswordResetStore
+	AccessTokenStore
+
 	GetUserByEmail(email string) (*User, error)
 	GetUserByID(id uuid.UUID) (*User, error)
 	CreateUser(User) error
+	MarkEmailVerified(userId uuid.UUID, email string) error
+	SetTOTPSecret(userId uuid.UUID, secret string) error
+	// EnableTOTP turns on two factor authentication and replaces any existing
+	// recovery codes with the given hashes.
+	EnableTOTP(userId uuid.UUID, recoveryCodeHashes []string) error
+	UseRecoveryCode(userId uuid.UUID, codeHash string) error
+	// UseTOTPStep records the time step of an accepted code and fails if that
+	// step or a later one was already used, so each code only works once.
+	UseTOTPStep(userId uuid.UUID, step int64) error
+	// SetTwoFactorChallenge replaces the challenge a login can exchange for a
+	// session, UseTwoFactorChallenge consumes it.
+	SetTwoFactorChallenge(userId, challengeId uuid.UUID) error
+	UseTwoFactorChallenge(userId, challengeId uuid.UUID) error
+	// UpdatePassword sets the new password hash and, in the same transaction,
+	// revokes every access token and every session except keepSessionId.
+	UpdatePassword(userId, keepSessionId uuid.UUID, passwordHash string) error
+	SetPendingEmail(userId uuid.UUID, email string) error
+	// ConfirmEmailChange swaps the pending email in as the verified address.
+	ConfirmEmailChange(userId uuid.UUID, email string) error
+}
+
+type PasswordResetStore interface {
+	CreatePasswordReset(PasswordReset) error
+	GetPasswordResetByTokenHash(hash string) (*PasswordReset, error)
+	// ResetPassword marks the reset as used, sets the new password hash and
+	// revokes every session and access token belonging to the user in a single
+	// transaction.
+	ResetPassword(resetId, userId uuid.UUID, passwordHash string) error
+}
+
+type AccessTokenStore interface {
+	CreateAccessToken(AccessToken) error
+	GetAccessTokenByHash(hash string) (*AccessToken, error)
+	GetUserAccessTokens(userId uuid.UUID) ([]*AccessToken, error)
+	RevokeAccessToken(userId, id uuid.UUID) error
+	TouchAccessToken(id uuid.UUID) error
+}
+
+type LoginAttemptStore interface {
+	GetLoginAttempts(key string) (*LoginAttempts, error)
+	// RecordLoginFailure increments the failure count, starting again from one
+	// if the previous failure is older than window.
+	RecordLoginFailure(key string, at time.Time, window time.Duration) (*LoginAttempts, error)
+	LockLogin(key string, until time.Time) error
+	ResetLoginAttempts(key string) error
+}
+
+type SecurityEventStore interface {
+	CreateSecurityEvent(SecurityEvent) error
+	GetUserSecurityEvents(userId uuid.UUID, limit int) ([]*SecurityEvent, error)
+}
+
+type AccountStore interface {
+	ScheduleDeletion(userId uuid.UUID, at time.Time) error
+	CancelDeletion(userId uuid.UUID) error
+	GetAccountsDueForPurge(before time.Time) ([]uuid.UUID, error)
+	GetAccountObjects(userId uuid.UUID) (*AccountObjects, error)
+	// PurgeAccount deletes every row belonging to the user in one transaction,
+	// provided the deletion is still scheduled and due.
+	PurgeAccount(userId uuid.UUID, before time.Time) error
+}
+
+type ExportStore interface {
+	CreateExport(DataExport) error
+	GetExportByID(id uuid.UUID) (*DataExport, error)
+	GetActiveUserExport(userId uuid.UUID) (*DataExport, error)
+	GetPendingExports() ([]*DataExport, error)
+	// ClaimExport moves a pending export to processing. It fails if another
+	// worker got to it first.
+	ClaimExport(id uuid.UUID) error
+	// FailStaleExports fails exports claimed before the given time that never
+	// finished, such as ones a crashed worker was building.
+	FailStaleExports(claimedBefore time.Time, reason string) error
+	CompleteExport(id uuid.UUID, objectKey string, size int64, expiresAt time.Time) error
+	FailExport(id uuid.UUID, reason string) error
+	GetExpiredExports(before time.Time) ([]*DataExport, error)
+	ExpireExport(id uuid.UUID) error
+	GetPersonalData(userId uuid.UUID) (*PersonalData, error)
+}
+
+type Mailer interface {
+	Send(Email) error
+}
+
+type SessionStore interface {
+	CreateSession(Session) error
+	GetSessionByID(id uuid.UUID) (*Session, error)
+	GetSessionByRefreshTokenHash(hash string) (*Session, error)
+	// GetSessionByRotatedRefreshTokenHash returns the session a refresh token
+	// was rotated out of.
+	GetSessionByRotatedRefreshTokenHash(hash string) (*Session, error)
+	// RotateSession swaps the refresh token hash and remembers the old one so
+	// its reuse can be spotted.
+	RotateSession(id uuid.UUID, oldHash, newHash string, expiresAt time.Time) error
+	RevokeSession(id uuid.UUID) error
+	RevokeUserSessions(userId uuid.UUID) error
+	RevokeOtherSessions(userId, keepId uuid.UUID) error
 }
 
 type ProfileStore interface {
 	GetProfileByUserId(userId uuid.UUID) (*Profile, error)
 	CreateProfile(Profile) error
 	UpdateAvatar(userId uuid.UUID, avatar string) error
+	// IsUsernameAvailable reports whether userId may take the username. Names
+	// held by other profiles or still reserved after a rename are unavailable.
+	IsUsernameAvailable(username string, userId uuid.UUID) (bool, error)
+	// UpdateProfile applies the fields set in the payload. When the username
+	// changes the old one is reserved for its previous owner until
+	// reserveOldUntil. A new username that is no longer available fails the
+	// whole update.
+	UpdateProfile(userId uuid.UUID, payload UpdateProfilePayload, reserveOldUntil time.Time) error
 }
 
 type FollowerStore interface {
-	FollowUser(followerId, followingId uuid.UUID) error
+	FollowUser(followerId, followingId uuid.UUID, status string) error
 	UnfollowUser(followerId, followingId uuid.UUID) error
+	// GetFollower returns the follow whatever its status, or nil if there is
+	// none.
 	GetFollower(followerId, followingId uuid.UUID) (*Follower, error)
+	GetIncomingFollowRequests(userId uuid.UUID) ([]*FollowRequest, error)
+	GetOutgoingFollowRequests(userId uuid.UUID) ([]*FollowRequest, error)
+	AcceptFollowRequest(id, followingId uuid.UUID) error
+	RejectFollowRequest(id, followingId uuid.UUID) error
+	// GetFollowers and GetFollowing return up to page.Limit+1 entries so the
+	// caller can tell whether there is another page.
+	GetFollowers(userId, viewerId uuid.UUID, page PageRequest) ([]*FollowListEntry, error)
+	GetFollowing(userId, viewerId uuid.UUID, page PageRequest) ([]*FollowListEntry, error)
+}
+
+type SafetyStore interface {
+	// BlockUser also removes any follows between the two users.
+	BlockUser(blockerId, blockedId uuid.UUID) error
+	UnblockUser(blockerId, blockedId uuid.UUID) error
+	// IsBlocked reports whether either user has blocked the other.
+	IsBlocked(userId, otherId uuid.UUID) (bool, error)
+	GetBlockedUsers(userId uuid.UUID) ([]*UserRelation, error)
+	MuteUser(muterId, mutedId uuid.UUID) error
+	UnmuteUser(muterId, mutedId uuid.UUID) error
+	GetMutedUsers(userId uuid.UUID) ([]*UserRelation, error)
+	GetMutedUserIDs(userId uuid.UUID) ([]uuid.UUID, error)
+}
+
+type SearchStore interface {
+	// SearchUsers returns up to limit+1 public profiles matching the search,
+	// best matches first.
+	SearchUsers(viewerId uuid.UUID, search UserSearch, offset, limit int) ([]*ProfileSummary, error)
+}
+
+type FeedStore interface {
+	FeedCache
+
+	// GetFeed returns up to page.Limit+1 items from the accounts userId
+	// follows, newest first.
+	GetFeed(userId uuid.UUID, page PageRequest) ([]*FeedItem, error)
+	// GetAudience returns the users whose feed shows userId's posts.
+	GetAudience(userId uuid.UUID) ([]uuid.UUID, error)
+}
+
+// FeedCache drops the feed pages kept for users whose feed has to change
+// straight away, such as after a block, mute or unfollow.
+type FeedCache interface {
+	Forget(userIds ...uuid.UUID)
+}
+
+// FeedPublisher pushes new items to the feeds of the author's followers as
+// they are posted.
+type FeedPublisher interface {
+	Publish(authorId uuid.UUID, item FeedItem)
+}
+
+type SocialStore interface {
+	// GetLogOwner returns the ID of the user whose vehicle the log belongs to.
+	GetLogOwner(logId uuid.UUID) (uuid.UUID, error)
+	LikeLog(logId, userId uuid.UUID) error
+	UnlikeLog(logId, userId uuid.UUID) error
+	CreateComment(Comment) error
+	GetCommentByID(id uuid.UUID) (*Comment, error)
+	// GetLogComments returns up to page.Limit+1 comments oldest first,
+	// leaving out comments by users blocked either way by viewerId.
+	GetLogComments(logId, viewerId uuid.UUID, page PageRequest) ([]*Comment, error)
+	UpdateComment(id uuid.UUID, body string) error
+	DeleteComment(id uuid.UUID) error
+	CountUserCommentsSince(userId uuid.UUID, since time.Time) (int, error)
+}
+
+type NotificationStore interface {
+	// CreateNotification does nothing and returns false if the user already
+	// has a notification with the same dedupe key.
+	CreateNotification(Notification) (bool, error)
+	// GetNotifications returns up to page.Limit+1 notifications newest first.
+	GetNotifications(userId uuid.UUID, page PageRequest) ([]*Notification, error)
+	CountUnread(userId uuid.UUID) (int, error)
+	MarkRead(id, userId uuid.UUID) error
+	MarkAllRead(userId uuid.UUID) error
+	// GetPreferences returns every notification type, enabled unless the user
+	// turned it off.
+	GetPreferences(userId uuid.UUID) (map[string]bool, error)
+	SetPreferences(userId uuid.UUID, preferences map[string]bool) error
+	GetVehicleReminderDates() ([]*Vehicle, error)
+}
+
+// Notifier delivers notifications. It never fails the action that caused
+// the notification.
+type Notifier interface {
+	Notify(Notification)
+}
+
+// Hub fans events out to a user's connected clients. Recent events are kept
+// so a client that reconnects can resume from the last event it saw.
+type Hub interface {
+	Publish(userId uuid.UUID, eventType string, data any)
+	// Subscribe replays the kept events after lastEventId, then delivers new
+	// events until cancel is called. The channel is closed if the subscriber
+	// falls too far behind.
+	Subscribe(userId uuid.UUID, lastEventId string) (events <-chan Event, cancel func())
+}
+
+// BlobStore keeps uploaded files. Keys are relative to the configured prefix,
+// locations are the URLs files are served from and are what records store.
+type BlobStore interface {
+	// Put stores the object and returns its location.
+	Put(ctx context.Context, key, contentType string, body io.Reader, size int64) (string, error)
+	// Get opens the object for reading. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the keys and everything under the prefixes. Deleting a
+	// key that doesn't exist is not an error.
+	Delete(ctx context.Context, keys []string, prefixes []string) error
+	// Stat returns blob.ErrNotFound if there is no object with the key.
+	Stat(ctx context.Context, key string) (*BlobInfo, error)
+	// SignedURL returns a URL the object can be downloaded from as filename
+	// until it expires.
+	SignedURL(ctx context.Context, key, filename string, expires time.Duration) (string, error)
+	// SignedUploadURL returns a URL a client can PUT exactly one object of
+	// the given type and size to until it expires.
+	SignedUploadURL(ctx context.Context, key, contentType string, size int64, expires time.Duration) (string, error)
+	// Location returns where the object with the key is served from.
+	Location(key string) string
+	// KeyFromLocation turns a location returned by Put back into its key.
+	KeyFromLocation(location string) string
+}
+
+type BlobInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModifiedAt  time.Time
 }
 
 type GarageStore interface {
@@ -36,11 +276,34 @@ type GarageStore interface {
 type MediaStore interface {
 	AddNewVehicleMedia(Media) error
 	AddNewLogMedia(Media) error
+	GetMediaByID(id uuid.UUID) (*MediaItem, error)
+	GetVehicleMedia(vehicleId uuid.UUID) ([]*MediaItem, error)
+	GetLogMedia(logId uuid.UUID) ([]*MediaItem, error)
+	// ReorderMedia sets the position of each item to its index in ids.
+	ReorderMedia(ids []uuid.UUID) error
+	// SetVehicleCover makes the item the vehicle's only cover photo.
+	SetVehicleCover(vehicleId, mediaId uuid.UUID) error
+	UpdateCaption(id uuid.UUID, caption string) error
+	DeleteMedia(id uuid.UUID) error
+}
+
+type UploadStore interface {
+	CreateUpload(Upload) error
+	GetUploadByID(id uuid.UUID) (*Upload, error)
+	// ConfirmUpload fails if the upload was already confirmed
+	ConfirmUpload(id uuid.UUID) error
+	// ReleaseUpload undoes ConfirmUpload when the upload couldn't be attached
+	ReleaseUpload(id uuid.UUID) error
+	DeleteUpload(id uuid.UUID) error
+	GetExpiredUploads(now time.Time) ([]*Upload, error)
 }
 
 type LogbookStore interface {
 	CreateLog(CreateLogPayload) (uuid.UUID, error)
-	GetLogsByVehicleId(vehicleId uuid.UUID) ([]*Log, error)
+	GetLogByID(id uuid.UUID) (*Log, error)
+	// GetLogsByVehicleId leaves comments between the viewer and users they
+	// blocked, or who blocked them, out of the comment counts.
+	GetLogsByVehicleId(vehicleId, viewerId uuid.UUID) ([]*Log, error)
 }
 
 type RegisterAuthPayload struct {
@@ -53,6 +316,52 @@ type LoginAuthPayload struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=3,max=100"`
+}
+
+type VerifyEmailPayload struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type TwoFactorLoginPayload struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+type TwoFactorCodePayload struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type CreateAccessTokenPayload struct {
+	Name          string   `json:"name" validate:"required,min=1,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"min=0,max=365"`
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=3,max=100"`
+}
+
+type ChangeEmailPayload struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required"`
+}
+
 type Auth struct {
 	ID        uuid.UUID `json:"id"`
 	Email     string    `json:"email"`
@@ -61,16 +370,185 @@ type Auth struct {
 }
 
 type User struct {
+	ID                  uuid.UUID  `json:"id"`
+	Name                string     `json:"name"`
+	Username            string     `json:"username"`
+	Email               string     `json:"email"`
+	Password            string     `json:"password"`
+	Bio                 string     `json:"bio"`
+	Public              bool       `json:"public"`
+	CreatedAt           time.Time  `json:"created_at"`
+	EmailVerifiedAt     *time.Time `json:"email_verified_at"`
+	TOTPSecret          *string    `json:"-"`
+	TOTPEnabledAt       *time.Time `json:"totp_enabled_at"`
+	PasswordChangedAt   *time.Time `json:"password_changed_at"`
+	PendingEmail        *string    `json:"pending_email"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+	TOTPLastStep        *int64     `json:"-"`
+	TOTPChallengeID     *string    `json:"-"`
+}
+
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+func (u *User) TOTPEnabled() bool {
+	return u.TOTPEnabledAt != nil && u.TOTPSecret != nil
+}
+
+type Session struct {
+	ID               uuid.UUID  `json:"id"`
+	UserID           uuid.UUID  `json:"user_id"`
+	RefreshTokenHash string     `json:"-"`
+	UserAgent        string     `json:"user_agent"`
+	IPAddress        string     `json:"ip_address"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	LastUsedAt       time.Time  `json:"last_used_at"`
+}
+
+// Active reports whether the session can still be used to authenticate
+// requests or be refreshed.
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+type AccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (t *AccessToken) Active() bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+
+	return t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt)
+}
+
+func (t *AccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+type LoginAttempts struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt *time.Time `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+type SecurityEvent struct {
 	ID        uuid.UUID `json:"id"`
-	Name      string    `json:"name"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password"`
-	Bio       string    `json:"bio"`
-	Public    bool      `json:"public"`
+	UserID    uuid.UUID `json:"user_id"`
+	Type      string    `json:"type"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type PasswordReset struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Usable reports whether the reset token has neither been used nor expired.
+func (r *PasswordReset) Usable() bool {
+	return r.UsedAt == nil && time.Now().Before(r.ExpiresAt)
+}
+
+// AccountObjects locates the stored files belonging to an account.
+type AccountObjects struct {
+	Locations  []string    `json:"locations"`
+	VehicleIDs []uuid.UUID `json:"vehicle_ids"`
+	LogIDs     []uuid.UUID `json:"log_ids"`
+}
+
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Status      string     `json:"status"`
+	ObjectKey   string     `json:"-"`
+	Size        int64      `json:"size"`
+	Error       string     `json:"error,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ClaimedAt   *time.Time `json:"-"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+// AccountData is the auth record as it appears in a personal data export,
+// without the password hash or two factor secret.
+type AccountData struct {
+	ID                  uuid.UUID  `json:"id"`
+	Email               string     `json:"email"`
+	CreatedAt           time.Time  `json:"created_at"`
+	EmailVerifiedAt     *time.Time `json:"email_verified_at"`
+	TOTPEnabledAt       *time.Time `json:"totp_enabled_at"`
+	PasswordChangedAt   *time.Time `json:"password_changed_at"`
+	PendingEmail        *string    `json:"pending_email"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+}
+
+// PersonalData is everything we hold about a user.
+type PersonalData struct {
+	Account        AccountData      `json:"account"`
+	Profile        *Profile         `json:"profile"`
+	Followers      []*Follower      `json:"followers"`
+	Following      []*Follower      `json:"following"`
+	Blocks         []*UserRelation  `json:"blocks"`
+	Mutes          []*UserRelation  `json:"mutes"`
+	Likes          []*LogLike       `json:"likes"`
+	Comments       []*Comment       `json:"comments"`
+	Notifications  []*Notification  `json:"notifications"`
+	Vehicles       []*Vehicle       `json:"vehicles"`
+	Logs           []*Log           `json:"logs"`
+	Media          []*Media         `json:"media"`
+	Sessions       []*Session       `json:"sessions"`
+	AccessTokens   []*AccessToken   `json:"access_tokens"`
+	SecurityEvents []*SecurityEvent `json:"security_events"`
+}
+
+// Cursor points at the last item of a page, the next page starts after it.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+type PageRequest struct {
+	After *Cursor
+	Limit int
+}
+
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
 type Profile struct {
 	ID        uuid.UUID `json:"id"`
 	UserID    uuid.UUID `json:"user_id"`
@@ -81,18 +559,164 @@ type Profile struct {
 	Public    bool      `json:"public"`
 	Followers int       `json:"followers"`
 	Following int       `json:"following"`
+
+	UsernameChangedAt *time.Time `json:"username_changed_at,omitempty"`
+}
+
+// ProfileSummary is the part of a profile anyone can see, including people
+// who aren't allowed to see a private profile in full.
+type ProfileSummary struct {
+	ID       uuid.UUID `json:"id"`
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+	Name     string    `json:"name"`
+	Avatar   string    `json:"avatar"`
+	Public   bool      `json:"public"`
+}
+
+func (p *Profile) Summary() *ProfileSummary {
+	return &ProfileSummary{
+		ID:       p.ID,
+		UserID:   p.UserID,
+		Username: p.Username,
+		Name:     p.Name,
+		Avatar:   p.Avatar,
+		Public:   p.Public,
+	}
+}
+
+// FollowListEntry is a user in a followers or following list.
+type FollowListEntry struct {
+	ProfileSummary
+	// FollowsBack reports whether the caller follows this user.
+	FollowsBack bool      `json:"follows_back"`
+	FollowedAt  time.Time `json:"followed_at"`
+	FollowID    uuid.UUID `json:"-"`
+}
+
+// UserRelation is a user the caller has blocked or muted.
+type UserRelation struct {
+	ProfileSummary
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserSearch finds users by username or name, by the vehicles they own, or
+// both.
+type UserSearch struct {
+	Query string `query:"q" validate:"omitempty,min=2,max=100"`
+	Make  string `query:"make" validate:"max=100"`
+	Model string `query:"model" validate:"max=100"`
+}
+
+const (
+	FeedItemVehicle      = "vehicle"
+	FeedItemLog          = "log"
+	FeedItemVehicleImage = "vehicle_image"
+)
+
+// FeedItem is a vehicle, log entry or vehicle image in the home feed. ID is
+// the ID of that vehicle, log or media record.
+type FeedItem struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	User      *ProfileSummary `json:"user"`
+	VehicleID uuid.UUID       `json:"vehicle_id"`
+	Make      string          `json:"make"`
+	Model     string          `json:"model"`
+	Nickname  string          `json:"nickname,omitempty"`
+	Title     string          `json:"title,omitempty"`
+	Category  int             `json:"category,omitempty"`
+	ImageURL  string          `json:"image_url,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+const (
+	NotificationFollow          = "follow"
+	NotificationFollowRequest   = "follow_request"
+	NotificationComment         = "comment"
+	NotificationReply           = "reply"
+	NotificationLike            = "like"
+	NotificationVehicleReminder = "vehicle_reminder"
+)
+
+var NotificationTypes = []string{
+	NotificationFollow,
+	NotificationFollowRequest,
+	NotificationComment,
+	NotificationReply,
+	NotificationLike,
+	NotificationVehicleReminder,
+}
+
+const (
+	EventNotification = "notification"
+	EventFeedItem     = "feed_item"
+)
+
+// Event is a message pushed to a user's connected clients.
+type Event struct {
+	ID   string
+	Type string
+	Data any
+}
+
+// Notification is sent to UserID because of something ActorID did. SubjectID
+// is the log or vehicle it is about, if any. Reminders have no actor.
+type Notification struct {
+	ID        uuid.UUID       `json:"id"`
+	UserID    uuid.UUID       `json:"user_id"`
+	ActorID   *uuid.UUID      `json:"actor_id"`
+	Type      string          `json:"type"`
+	SubjectID *uuid.UUID      `json:"subject_id"`
+	Message   string          `json:"message,omitempty"`
+	DedupeKey *string         `json:"-"`
+	CreatedAt time.Time       `json:"created_at"`
+	ReadAt    *time.Time      `json:"read_at"`
+	Actor     *ProfileSummary `json:"actor,omitempty"`
 }
 
 type CreateProfilePayload struct {
-	Username string `json:"username" validate:"required,min=3,max=100"`
+	Username string `json:"username" validate:"required,min=3,max=100,username"`
 	Name     string `json:"name" validate:"required,min=3,max=100"`
 }
 
+// UpdateProfilePayload only changes the fields that are present.
+type UpdateProfilePayload struct {
+	Username *string `json:"username" validate:"omitempty,min=3,max=100,username"`
+	Name     *string `json:"name" validate:"omitempty,min=3,max=100"`
+	Bio      *string `json:"bio" validate:"omitempty,max=255"`
+	Public   *bool   `json:"public"`
+}
+
+// Empty reports whether the payload has nothing to update.
+func (p UpdateProfilePayload) Empty() bool {
+	return p.Username == nil && p.Name == nil && p.Bio == nil && p.Public == nil
+}
+
+const (
+	FollowStatusPending  = "pending"
+	FollowStatusAccepted = "accepted"
+)
+
 type Follower struct {
 	ID          uuid.UUID `json:"id"`
-	FollowerID  uuid.UUID `json:"follower_i"`
+	FollowerID  uuid.UUID `json:"follower_id"`
 	FollowingID uuid.UUID `json:"following_id"`
 	CreatedAt   time.Time `json:"created_at"`
+	Status      string    `json:"status"`
+}
+
+// Accepted reports whether the follow is active rather than a pending
+// request.
+func (f *Follower) Accepted() bool {
+	return f.Status == FollowStatusAccepted
+}
+
+// FollowRequest is a pending follow, User is the other side of the request.
+type FollowRequest struct {
+	ID        uuid.UUID       `json:"id"`
+	User      *ProfileSummary `json:"user"`
+	CreatedAt time.Time       `json:"created_at"`
 }
 
 type FollowUserPayload struct {
@@ -116,24 +740,24 @@ type NewVehiclePostData struct {
 }
 
 type Vehicle struct {
-	ID            uuid.UUID `json:"id,omitempty"`
-	UserID        uuid.UUID `json:"user_id,omitempty"`
-	Registration  string    `json:"registration,omitempty"`
-	Color         string    `json:"color,omitempty"`
-	Description   string    `json:"description,omitempty"`
-	EngineSize    uint16    `json:"engine_size,omitempty"`
-	Make          string    `json:"make,omitempty"`
-	Model         string    `json:"model,omitempty"`
-	MotDate       string    `json:"mot_date,omitempty"`
-	Registered    string    `json:"registered,omitempty"`
-	InsuranceDate string    `json:"insurance_date,omitempty"`
-	ServiceDate   string    `json:"service_date,omitempty"`
-	TaxDate       string    `json:"tax_date,omitempty"`
-	Year          uint16    `json:"year,omitempty"`
-	Mileage       uint32    `json:"mileage,omitempty"`
-	Nickname      string    `json:"nickname,omitempty"`
-	CreatedAt     time.Time `json:"created_at,omitempty"`
-	Images        string    `json:"images,omitempty"`
+	ID            uuid.UUID    `json:"id,omitempty"`
+	UserID        uuid.UUID    `json:"user_id,omitempty"`
+	Registration  string       `json:"registration,omitempty"`
+	Color         string       `json:"color,omitempty"`
+	Description   string       `json:"description,omitempty"`
+	EngineSize    uint16       `json:"engine_size,omitempty"`
+	Make          string       `json:"make,omitempty"`
+	Model         string       `json:"model,omitempty"`
+	MotDate       string       `json:"mot_date,omitempty"`
+	Registered    string       `json:"registered,omitempty"`
+	InsuranceDate string       `json:"insurance_date,omitempty"`
+	ServiceDate   string       `json:"service_date,omitempty"`
+	TaxDate       string       `json:"tax_date,omitempty"`
+	Year          uint16       `json:"year,omitempty"`
+	Mileage       uint32       `json:"mileage,omitempty"`
+	Nickname      string       `json:"nickname,omitempty"`
+	CreatedAt     time.Time    `json:"created_at,omitempty"`
+	Images        []*MediaItem `json:"images"`
 }
 
 type UpdateVehiclePatchData struct {
@@ -204,14 +828,77 @@ type MotTests struct {
 }
 
 type Media struct {
-	ID         *uuid.UUID `json:"id"`
-	Filename   *string    `json:"filename"`
-	FileType   *string    `json:"file_type"`
-	S3Location *string    `json:"s3_location"`
-	UploadedAt *time.Time `json:"uploaded_at"`
-	UserID     *uuid.UUID `json:"user_id,omitempty"`
-	VehicleID  *uuid.UUID `json:"vehicle_id,omitempty"`
-	LogID      *uuid.UUID `json:"log_id,omitempty"`
+	ID         *uuid.UUID  `json:"id"`
+	Filename   *string     `json:"filename"`
+	FileType   *string     `json:"file_type"`
+	S3Location *string     `json:"s3_location"`
+	UploadedAt *time.Time  `json:"uploaded_at"`
+	UserID     *uuid.UUID  `json:"user_id,omitempty"`
+	VehicleID  *uuid.UUID  `json:"vehicle_id,omitempty"`
+	LogID      *uuid.UUID  `json:"log_id,omitempty"`
+	Renditions *Renditions `json:"-"`
+}
+
+// Renditions are the storage keys of the resized copies made of an uploaded
+// image. The original is never kept, so none of its metadata is either.
+type Renditions struct {
+	Thumbnail string
+	Medium    string
+	Full      string
+}
+
+// ImageURLs are where each size of an image can be loaded from. Media
+// uploaded before renditions existed, and files that aren't images, only
+// have a full URL.
+type ImageURLs struct {
+	Thumbnail string `json:"thumbnail,omitempty"`
+	Medium    string `json:"medium,omitempty"`
+	Full      string `json:"full"`
+}
+
+// Preview is the size shown in feeds, the medium rendition when there is one.
+func (u ImageURLs) Preview() string {
+	if u.Medium != "" {
+		return u.Medium
+	}
+
+	return u.Full
+}
+
+const (
+	UploadVehicleImage = "vehicle_image"
+	UploadLogMedia     = "log_media"
+	UploadAvatar       = "avatar"
+)
+
+// Upload is a file the client was given a signed URL to upload directly to
+// storage. It becomes media once the client confirms it.
+type Upload struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"-"`
+	Kind        string     `json:"kind"`
+	TargetID    *uuid.UUID `json:"target_id"`
+	ObjectKey   string     `json:"-"`
+	Filename    string     `json:"filename"`
+	ContentType string     `json:"content_type"`
+	Size        int64      `json:"size"`
+	Checksum    string     `json:"checksum"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ConfirmedAt *time.Time `json:"-"`
+	UploadURL   string     `json:"upload_url,omitempty"`
+}
+
+// CreateUploadPayload describes the file about to be uploaded. TargetID is
+// the vehicle or log it belongs to, avatars have none. Checksum is the hex
+// encoded SHA-256 of the file.
+type CreateUploadPayload struct {
+	Kind        string     `json:"kind" validate:"required,oneof=vehicle_image log_media avatar"`
+	TargetID    *uuid.UUID `json:"target_id" validate:"required_unless=Kind avatar"`
+	Filename    string     `json:"filename" validate:"required,max=255"`
+	ContentType string     `json:"content_type" validate:"required"`
+	Size        int64      `json:"size" validate:"required,min=1"`
+	Checksum    string     `json:"checksum" validate:"required,len=64,hexadecimal"`
 }
 
 type CreateLogPayload struct {
@@ -225,20 +912,75 @@ type CreateLogPayload struct {
 }
 
 type Log struct {
-	ID          uuid.UUID   `json:"id"`
-	VehicleID   uuid.UUID   `json:"vehicle_id"`
-	Title       string      `json:"title"`
-	Category    int         `json:"category"`
-	Date        string      `json:"date"`
-	Description string      `json:"description"`
-	Notes       string      `json:"notes"`
-	Cost        float32     `json:"cost"`
-	CreatedAt   time.Time   `json:"created_at"`
-	Media       []*LogMedia `json:"media"`
-}
-
-type LogMedia struct {
-	Filename   *string `json:"filename"`
-	FileType   *string `json:"file_type"`
-	S3Location *string `json:"s3_location"`
+	ID          uuid.UUID    `json:"id"`
+	VehicleID   uuid.UUID    `json:"vehicle_id"`
+	Title       string       `json:"title"`
+	Category    int          `json:"category"`
+	Date        string       `json:"date"`
+	Description string       `json:"description"`
+	Notes       string       `json:"notes"`
+	Cost        float32      `json:"cost"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Media       []*MediaItem `json:"media"`
+	Likes       int          `json:"likes"`
+	Comments    int          `json:"comments"`
+}
+
+type LogLike struct {
+	LogID     uuid.UUID `json:"log_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Comment is a comment on a log entry. Replies point at the comment they
+// answer through ParentID.
+type Comment struct {
+	ID        uuid.UUID       `json:"id"`
+	LogID     uuid.UUID       `json:"log_id"`
+	UserID    uuid.UUID       `json:"user_id"`
+	ParentID  *uuid.UUID      `json:"parent_id"`
+	Body      string          `json:"body"`
+	CreatedAt time.Time       `json:"created_at"`
+	EditedAt  *time.Time      `json:"edited_at"`
+	Author    *ProfileSummary `json:"author,omitempty"`
+}
+
+type CreateCommentPayload struct {
+	Body     string     `json:"body" validate:"required,min=1,max=1000"`
+	ParentID *uuid.UUID `json:"parent_id"`
+}
+
+type UpdateCommentPayload struct {
+	Body string `json:"body" validate:"required,min=1,max=1000"`
+}
+
+// MediaItem is a file attached to a vehicle or log. Stores fill in where it
+// is kept, handlers turn that into URLs for each size.
+type MediaItem struct {
+	ID         uuid.UUID   `json:"id"`
+	VehicleID  *uuid.UUID  `json:"vehicle_id,omitempty"`
+	LogID      *uuid.UUID  `json:"log_id,omitempty"`
+	Filename   string      `json:"filename"`
+	FileType   string      `json:"file_type"`
+	Caption    string      `json:"caption"`
+	Position   int         `json:"position"`
+	Cover      bool        `json:"cover"`
+	UploadedAt time.Time   `json:"uploaded_at"`
+	Location   string      `json:"-"`
+	Renditions *Renditions `json:"-"`
+	URLs       ImageURLs   `json:"urls"`
+}
+
+// ReorderMediaPayload lists every media item of a vehicle or log in the
+// order they should be shown.
+type ReorderMediaPayload struct {
+	MediaIDs []uuid.UUID `json:"media_ids" validate:"required,min=1"`
+}
+
+type SetCoverPayload struct {
+	MediaID uuid.UUID `json:"media_id" validate:"required"`
+}
+
+type UpdateMediaPayload struct {
+	Caption *string `json:"caption" validate:"required,max=500"`
 }
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// EncodeCursor turns a cursor into the opaque string handed to clients.
+func EncodeCursor(cursor types.Cursor) string {
+	raw := fmt.Sprintf("%d|%s", cursor.CreatedAt.UnixNano(), cursor.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (*types.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	nanos, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &types.Cursor{CreatedAt: time.Unix(0, n), ID: parsed}, nil
+}
+
+// ParsePage reads the cursor and limit query parameters. A missing cursor
+// starts from the first page.
+func ParsePage(c echo.Context) (*types.PageRequest, error) {
+	page := &types.PageRequest{Limit: DefaultPageLimit}
+
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxPageLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", MaxPageLimit)
+		}
+		page.Limit = n
+	}
+
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		after, err := DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		page.After = after
+	}
+
+	return page, nil
+}
+
+// NewPage builds a page from items fetched with a limit one higher than
+// requested, the extra item only tells us there is a next page.
+func NewPage[T any](items []T, limit int, cursorOf func(T) types.Cursor) types.Page[T] {
+	page := types.Page[T]{Items: items}
+
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.NextCursor = EncodeCursor(cursorOf(page.Items[limit-1]))
+	}
+
+	return page
+}
+
+// EncodeOffsetCursor is the cursor for results that are ranked rather than
+// ordered by time, such as search, where the next page starts at an offset.
+func EncodeOffsetCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("o|%d", offset)))
+}
+
+func DecodeOffsetCursor(s string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+
+	offset, ok := strings.CutPrefix(string(raw), "o|")
+	if !ok {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+
+	n, err := strconv.Atoi(offset)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+
+	return n, nil
+}
+
+// ParseOffsetPage reads the limit and an offset cursor from the query
+// parameters.
+func ParseOffsetPage(c echo.Context) (offset int, limit int, err error) {
+	limit = DefaultPageLimit
+	if l := c.QueryParam("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", MaxPageLimit)
+		}
+	}
+
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		offset, err = DecodeOffsetCursor(cursor)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return offset, limit, nil
+}
+
+// NewOffsetPage builds a page from items fetched with a limit one higher than
+// requested.
+func NewOffsetPage[T any](items []T, offset, limit int) types.Page[T] {
+	page := types.Page[T]{Items: items}
+
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.NextCursor = EncodeOffsetCursor(offset + limit)
+	}
+
+	return page
+}
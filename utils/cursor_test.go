@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZondaF12/logbook-backend/types"
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := types.Cursor{CreatedAt: time.Now(), ID: uuid.New()}
+
+	decoded, err := DecodeCursor(EncodeCursor(cursor))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.ID != cursor.ID {
+		t.Errorf("expected %+v, got %+v", cursor, decoded)
+	}
+}
+
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	for _, s := range []string{"", "not base64!", "bm9waXBl"} {
+		if _, err := DecodeCursor(s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestOffsetCursor(t *testing.T) {
+	offset, err := DecodeOffsetCursor(EncodeOffsetCursor(40))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if offset != 40 {
+		t.Errorf("expected offset 40, got %d", offset)
+	}
+
+	// Time cursors aren't offsets
+	if _, err := DecodeOffsetCursor(EncodeCursor(types.Cursor{CreatedAt: time.Now(), ID: uuid.New()})); err == nil {
+		t.Error("expected a time cursor to be rejected")
+	}
+}
@@ -0,0 +1,10 @@
+package utils
+
+// ProfileSummaryColumns select a profile summary from a LEFT JOIN on profiles
+// p, users who haven't created a profile yet come back with empty fields. Scan
+// them into ID, Username, Name, Avatar and Public in that order.
+const ProfileSummaryColumns = `p.id,
+			COALESCE(p.username, ''),
+			COALESCE(p.name, ''),
+			COALESCE(p.avatar, ''),
+			COALESCE(p.public, FALSE)`
@@ -3,6 +3,7 @@ package utils
 import (
 	"encoding/json"
 	"net/http"
+	"regexp"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
@@ -10,6 +11,15 @@ import (
 
 var Validate = validator.New()
 
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+
+func init() {
+	// Usernames end up in URLs and mentions, so keep them to a safe set
+	Validate.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return usernamePattern.MatchString(fl.Field().String())
+	})
+}
+
 func ParseJSON(c echo.Context, payload any) error {
 	if c.Request().Body == nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid payload")